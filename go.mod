@@ -6,8 +6,10 @@ require (
 	github.com/olekukonko/tablewriter v0.0.5
 	github.com/shirou/gopsutil/v4 v4.26.7
 	github.com/urfave/cli/v2 v2.27.6
-	golang.org/x/term v0.20.0
-	golang.org/x/text v0.24.0
+	golang.org/x/crypto v0.48.0
+	golang.org/x/net v0.50.0
+	golang.org/x/term v0.40.0
+	golang.org/x/text v0.34.0
 )
 
 require (
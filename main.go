@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -26,33 +27,213 @@ func main() {
 					&cli.BoolFlag{Name: "dns", Usage: "Check DNS information"},
 					&cli.BoolFlag{Name: "http", Usage: "Check HTTP status code and headers"},
 					&cli.BoolFlag{Name: "ssl", Usage: "Check SSL/TLS certificate"},
-					&cli.BoolFlag{Name: "whois", Usage: "Look up WHOIS information"},
+					&cli.BoolFlag{Name: "whois", Usage: "Look up domain registration data (RDAP, falling back to WHOIS)"},
 					&cli.BoolFlag{Name: "trace", Usage: "Perform traceroute to the website"},
+					&cli.BoolFlag{Name: "tls-scan", Usage: "Enumerate TLS versions, cipher suites and ALPN protocols"},
+					&cli.BoolFlag{Name: "dnssec", Usage: "Validate the DNSSEC chain of trust from the root"},
+					&cli.BoolFlag{Name: "email", Usage: "Check SPF, DMARC, DKIM, MTA-STS, TLS-RPT and BIMI for the domain"},
+					&cli.BoolFlag{Name: "protocols", Usage: "Report ALPN, HTTP/2 support and Alt-Svc, comparing HTTP/1.1 and HTTP/2 timings"},
+					&cli.BoolFlag{Name: "http3", Usage: "Also try an HTTP/3 (QUIC) request in the protocol check (implies --protocols)"},
+					&cli.BoolFlag{Name: "dual-stack", Usage: "Run ping, TCP connect, HTTP latency and TLS against every A and AAAA address separately"},
+					&cli.BoolFlag{Name: "per-ip", Usage: "Check HTTP status, latency and certificate against every resolved address, flagging inconsistent backends"},
+					&cli.BoolFlag{Name: "page", Usage: "Analyse the page: weight, requests, mixed content and broken internal links"},
+					&cli.BoolFlag{Name: "wellknown", Usage: "Check robots.txt, sitemaps, security.txt and other well-known endpoints"},
+					&cli.BoolFlag{Name: "mtr", Usage: "Continuously probe each hop on the path (MTR-style)"},
 					&cli.BoolFlag{Name: "full", Usage: "Run all checks"},
 					&cli.IntFlag{Name: "timeout", Value: 10, Usage: "Timeout in seconds"},
 					&cli.IntFlag{Name: "count", Value: 4, Usage: "Ping count"},
+					&cli.IntFlag{Name: "latency-count", Value: 3, Usage: "Number of HTTP requests for the latency check"},
+					&cli.IntFlag{Name: "page-depth", Value: 1, Usage: "Link levels to crawl in the page check (1 checks the target page only)"},
+					&cli.IntFlag{Name: "cycles", Value: 10, Usage: "Number of MTR probe cycles"},
+					&cli.StringFlag{Name: "mtr-json", Usage: "Write the MTR report as JSON to this file ('-' for stdout)"},
+					&cli.StringFlag{Name: "trace-proto", Value: "udp", Usage: "Traceroute/MTR probe protocol: udp, icmp or tcp"},
+					&cli.IntFlag{Name: "trace-port", Usage: "Destination port for udp/tcp traceroute probes (default 33434 for udp, 80 for tcp)"},
+					&cli.BoolFlag{Name: "ipv4", Aliases: []string{"4"}, Usage: "Use IPv4 for traceroute/MTR"},
+					&cli.BoolFlag{Name: "ipv6", Aliases: []string{"6"}, Usage: "Use IPv6 for traceroute/MTR"},
+					&cli.StringSliceFlag{Name: "asn-db", Usage: "Offline ASN/geo database (.mmdb or IP-to-ASN TSV) used to annotate addresses; repeatable"},
+					&cli.StringFlag{Name: "resolver", Usage: "DNS server for the DNS check: IP[:port], tcp://, tls:// (DoT) or https:// (DoH)"},
+					&cli.StringSliceFlag{Name: "compare-resolvers", Usage: "Compare answers from several resolvers side by side ('system' for the system resolver)"},
+					&cli.StringFlag{Name: "trust-anchor", Usage: "Root DS records (file or inline, ';'-separated) to validate DNSSEC against instead of the IANA anchors"},
+					&cli.StringSliceFlag{Name: "dkim-selector", Usage: "DKIM selector to check with --email (e.g. google, selector1); repeatable"},
+					&cli.StringFlag{Name: "rdap-bootstrap", Usage: "RDAP bootstrap file (IANA dns.json format) to use instead of the built-in one"},
+					&cli.StringFlag{Name: "whois-server", Usage: "WHOIS server (host[:port]) to query directly instead of RDAP"},
+					&cli.StringFlag{Name: "targets-file", Usage: "Check every URL or host in this file (one per line, '-' for stdin) and print a summary matrix"},
+					&cli.IntFlag{Name: "concurrency", Value: 5, Usage: "Targets checked at once with --targets-file"},
+					&cli.BoolFlag{Name: "detail", Usage: "Print per-target detail after the --targets-file summary"},
+					&cli.IntSliceFlag{Name: "expect-status", Usage: "Assert the final HTTP status is one of these codes (repeatable)"},
+					&cli.DurationFlag{Name: "max-latency", Usage: "Assert the average request time is at most this (e.g. 500ms)"},
+					&cli.StringSliceFlag{Name: "expect-header", Usage: "Assert a response header is present, or contains a value with 'Name: value' (repeatable)"},
+					&cli.StringSliceFlag{Name: "expect-body", Usage: "Assert the response body contains this text (repeatable)"},
+					&cli.StringSliceFlag{Name: "expect-body-regex", Usage: "Assert the response body matches this regular expression (repeatable)"},
+					&cli.StringSliceFlag{Name: "expect-json", Usage: "Assert a JSON body value with 'path=value', or that 'path' exists (e.g. data.items[0].id=42; repeatable)"},
+					&cli.IntFlag{Name: "min-cert-days", Usage: "Assert the certificate is valid for at least this many more days"},
+					&cli.StringSliceFlag{Name: "expect-dns", Usage: "Assert the host resolves to this address or CNAME target (repeatable)"},
+					&cli.StringFlag{Name: "assert-file", Usage: "Read further assertions from this file, one 'name value' per line"},
+					&cli.IntFlag{Name: "max-redirects", Value: 10, Usage: "Maximum redirects to follow in the HTTP check"},
+					&cli.BoolFlag{Name: "no-follow", Usage: "Do not follow redirects in the HTTP check"},
+					&cli.IntFlag{Name: "port", Usage: "Port for the SSL check and TLS scan (default 443)"},
+					&cli.StringFlag{Name: "starttls", Usage: "Upgrade with STARTTLS first: smtp, imap, pop3, ldap, postgres, ftp or none (guessed from --port)"},
+					&cli.StringFlag{Name: "sni", Usage: "Server name to send and verify the certificate against (e.g. when the target is a backend IP)"},
+					&cli.BoolFlag{Name: "revocation", Usage: "Query the certificate's OCSP responders and CRLs directly"},
+					&cli.StringFlag{Name: "ocsp-url", Usage: "OCSP responder to query instead of the one in the certificate (implies --revocation)"},
+					&cli.StringFlag{Name: "ca-file", Usage: "PEM bundle to verify certificates against instead of the system roots"},
+					&cli.StringFlag{Name: "method", Aliases: []string{"X"}, Usage: "HTTP method for the latency and HTTP checks (default GET, or POST with --data)"},
+					&cli.StringSliceFlag{Name: "header", Aliases: []string{"H"}, Usage: "Extra request header 'Name: value' (repeatable; 'Host: name' overrides the Host header)"},
+					&cli.StringFlag{Name: "user", Usage: "Basic auth credentials as user:password"},
+					&cli.StringFlag{Name: "bearer", Usage: "Bearer token to send in the Authorization header"},
+					&cli.StringFlag{Name: "data", Usage: "Request body; @file reads it from a file, @- from stdin"},
+					&cli.StringFlag{Name: "user-agent", Usage: "User-Agent header for the HTTP requests"},
+					&cli.StringFlag{Name: "cert", Usage: "PEM client certificate for mutual TLS (may also hold the key)"},
+					&cli.StringFlag{Name: "key", Usage: "PEM private key for --cert"},
+					&cli.BoolFlag{Name: "insecure", Aliases: []string{"k"}, Usage: "Do not verify the server certificate in the latency and HTTP checks"},
+					&cli.StringFlag{Name: "proxy", Usage: "Proxy URL for the HTTP requests ('none' to ignore HTTP(S)_PROXY)"},
+					&cli.StringSliceFlag{Name: "resolve", Usage: "Send requests for host:port to this IP, as host:port:ip (repeatable), e.g. to test one backend"},
 				},
 				Action: func(c *cli.Context) error {
 					target := ""
 					if c.Args().Len() > 0 {
 						target = c.Args().Get(0)
 					}
-					if target == "" {
+					if target == "" && c.String("targets-file") == "" {
 						return cli.Exit("missing target. Example: sysinformer web example.com --full", 1)
 					}
-					return sysinformer.RunWebDiagnostics(sysinformer.WebDiagOptions{
-						Target:     target,
-						Ping:       c.Bool("ping"),
-						Latency:    c.Bool("latency"),
-						DNS:        c.Bool("dns"),
-						HTTP:       c.Bool("http"),
-						SSL:        c.Bool("ssl"),
-						Whois:      c.Bool("whois"),
-						Trace:      c.Bool("trace"),
-						Full:       c.Bool("full"),
-						TimeoutSec: c.Int("timeout"),
-						Count:      c.Int("count"),
+					var body []byte
+					if c.IsSet("data") {
+						b, err := sysinformer.ReadRequestBody(c.String("data"))
+						if err != nil {
+							return cli.Exit("reading --data: "+err.Error(), 1)
+						}
+						body = b
+					}
+					if c.Bool("ipv4") && c.Bool("ipv6") {
+						return errors.New("--ipv4 and --ipv6 cannot be used together")
+					}
+					ipVersion := 0
+					if c.Bool("ipv4") {
+						ipVersion = 4
+					}
+					if c.Bool("ipv6") {
+						ipVersion = 6
+					}
+					// A zero MaxRedirects means the default, so --max-redirects 0 is passed as no-follow.
+					noFollow := c.Bool("no-follow") || c.Int("max-redirects") == 0
+					// --min-cert-days 0 is a real assertion (not expired), so only an unset flag is skipped.
+					var minCertDays *int
+					if c.IsSet("min-cert-days") {
+						days := c.Int("min-cert-days")
+						if days < 0 {
+							return errors.New("--min-cert-days must not be negative")
+						}
+						minCertDays = &days
+					}
+					err := sysinformer.RunWebDiagnostics(sysinformer.WebDiagOptions{
+						Target:       target,
+						Ping:         c.Bool("ping"),
+						Latency:      c.Bool("latency"),
+						DNS:          c.Bool("dns"),
+						HTTP:         c.Bool("http"),
+						SSL:          c.Bool("ssl"),
+						Whois:        c.Bool("whois"),
+						Trace:        c.Bool("trace"),
+						MTR:          c.Bool("mtr"),
+						Full:         c.Bool("full"),
+						TimeoutSec:   c.Int("timeout"),
+						Count:        c.Int("count"),
+						LatencyCount: c.Int("latency-count"),
+						Cycles:       c.Int("cycles"),
+						MTRJSON:      c.String("mtr-json"),
+						TraceProto:   c.String("trace-proto"),
+						TracePort:    c.Int("trace-port"),
+						IPVersion:    ipVersion,
+						ASNDBs:       c.StringSlice("asn-db"),
+						MaxRedirects: c.Int("max-redirects"),
+						NoFollow:     noFollow,
+						CAFile:       c.String("ca-file"),
+						TLSScan:      c.Bool("tls-scan"),
+						Port:         c.Int("port"),
+						StartTLS:     c.String("starttls"),
+						SNI:          c.String("sni"),
+						Revocation:   c.Bool("revocation") || c.IsSet("ocsp-url"),
+						OCSPURL:      c.String("ocsp-url"),
+						Resolver:     c.String("resolver"),
+						Compare:      c.StringSlice("compare-resolvers"),
+						DNSSEC:       c.Bool("dnssec"),
+						TrustAnchor:  c.String("trust-anchor"),
+						Email:        c.Bool("email"),
+						DKIM:         c.StringSlice("dkim-selector"),
+						RDAP:         c.String("rdap-bootstrap"),
+						WhoisServer:  c.String("whois-server"),
+						TargetsFile:  c.String("targets-file"),
+						Concurrency:  c.Int("concurrency"),
+						Detail:       c.Bool("detail"),
+						Assertions: sysinformer.WebAssertions{
+							Status:       c.IntSlice("expect-status"),
+							MaxLatency:   c.Duration("max-latency"),
+							Headers:      c.StringSlice("expect-header"),
+							BodyContains: c.StringSlice("expect-body"),
+							BodyRegex:    c.StringSlice("expect-body-regex"),
+							JSON:         c.StringSlice("expect-json"),
+							MinCertDays:  minCertDays,
+							DNS:          c.StringSlice("expect-dns"),
+						},
+						AssertFile: c.String("assert-file"),
+						Method:     c.String("method"),
+						Headers:    c.StringSlice("header"),
+						BasicAuth:  c.String("user"),
+						Bearer:     c.String("bearer"),
+						Body:       body,
+						UserAgent:  c.String("user-agent"),
+						ClientCert: c.String("cert"),
+						ClientKey:  c.String("key"),
+						Insecure:   c.Bool("insecure"),
+						Proxy:      c.String("proxy"),
+						Resolve:    c.StringSlice("resolve"),
+						Protocols:  c.Bool("protocols"),
+						HTTP3:      c.Bool("http3"),
+						DualStack:  c.Bool("dual-stack"),
+						PerIP:      c.Bool("per-ip"),
+						Page:       c.Bool("page"),
+						PageDepth:  c.Int("page-depth"),
+						WellKnown:  c.Bool("wellknown"),
 					})
+					// Failed assertions and targets are already listed; only the exit code is left to set.
+					var failed *sysinformer.AssertionFailure
+					var batchFailed *sysinformer.BatchFailure
+					if errors.As(err, &failed) || errors.As(err, &batchFailed) {
+						return cli.Exit("", 1)
+					}
+					return err
+				},
+			},
+			{
+				Name:  "certs",
+				Usage: "Check certificate expiry across many TLS endpoints",
+				Flags: []cli.Flag{
+					&cli.StringFlag{Name: "file", Aliases: []string{"f"}, Required: true, Usage: "File with one host[:port] [sni] per line ('-' for stdin)"},
+					&cli.IntFlag{Name: "concurrency", Value: 10, Usage: "Endpoints checked at once"},
+					&cli.IntFlag{Name: "warn-days", Value: 30, Usage: "Warn when a certificate expires within this many days"},
+					&cli.IntFlag{Name: "crit-days", Value: 7, Usage: "Critical when a certificate expires within this many days"},
+					&cli.StringFlag{Name: "format", Value: "table", Usage: "Output format: table, json or csv"},
+					&cli.StringFlag{Name: "ca-file", Usage: "PEM bundle to verify certificates against instead of the system roots"},
+					&cli.IntFlag{Name: "timeout", Value: 10, Usage: "Timeout in seconds per endpoint"},
+				},
+				Action: func(c *cli.Context) error {
+					code, err := sysinformer.RunCerts(sysinformer.CertsOptions{
+						File:        c.String("file"),
+						Concurrency: c.Int("concurrency"),
+						WarnDays:    c.Int("warn-days"),
+						CritDays:    c.Int("crit-days"),
+						Format:      c.String("format"),
+						CAFile:      c.String("ca-file"),
+						TimeoutSec:  c.Int("timeout"),
+					})
+					if err != nil {
+						return cli.Exit("Error: "+err.Error(), code)
+					}
+					if code != 0 {
+						return cli.Exit("", code)
+					}
+					return nil
 				},
 			},
 		},
@@ -63,8 +244,10 @@ func main() {
 			&cli.BoolFlag{Name: "disks", Aliases: []string{"d"}, Usage: "Show disk information"},
 			&cli.BoolFlag{Name: "network", Aliases: []string{"n"}, Usage: "Show network information"},
 			&cli.BoolFlag{Name: "latency", Aliases: []string{"l"}, Usage: "Show latency information"},
+			&cli.StringFlag{Name: "latency-targets", Usage: "Latency target groups: config file path or inline 'group=host:port/method,...;group=...'"},
 			&cli.BoolFlag{Name: "services", Aliases: []string{"S"}, Usage: "Show services information"},
 			&cli.BoolFlag{Name: "containers", Aliases: []string{"C"}, Usage: "Show container information"},
+			&cli.StringSliceFlag{Name: "asn-db", Usage: "Offline ASN/geo database (.mmdb or IP-to-ASN TSV) used to annotate the WAN address; repeatable"},
 			&cli.BoolFlag{Name: "all", Aliases: []string{"a"}, Usage: "Show all information"},
 		},
 		Action: func(c *cli.Context) error {
@@ -74,7 +257,7 @@ func main() {
 			showMemory := c.Bool("memory")
 			showDisks := c.Bool("disks")
 			showNetwork := c.Bool("network")
-			showLatency := c.Bool("latency")
+			showLatency := c.Bool("latency") || c.IsSet("latency-targets")
 			showServices := c.Bool("services")
 			showContainers := c.Bool("containers")
 
@@ -99,11 +282,15 @@ func main() {
 			}
 
 			if showAll || showNetwork {
-				sysinformer.PrintNetworkInfo()
+				enrich, err := sysinformer.LoadIPEnricher(c.StringSlice("asn-db"))
+				if err != nil {
+					fmt.Println("Error loading ASN database:", err)
+				}
+				sysinformer.PrintNetworkInfo(enrich)
 			}
 
 			if showAll || showLatency {
-				sysinformer.PrintLatencyInfo()
+				sysinformer.PrintLatencyInfo(c.String("latency-targets"))
 			}
 
 			if showAll || showServices {
@@ -118,5 +305,6 @@ func main() {
 	}
 	if err := app.Run(os.Args); err != nil {
 		fmt.Println("Error:", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,244 @@
+package sysinformer
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ASNInfo is what the offline databases know about an address.
+type ASNInfo struct {
+	ASN     uint64
+	Org     string
+	Country string
+}
+
+func (a ASNInfo) String() string {
+	parts := []string{}
+	if a.ASN != 0 {
+		parts = append(parts, fmt.Sprintf("AS%d", a.ASN))
+	}
+	if a.Org != "" {
+		parts = append(parts, a.Org)
+	}
+	if a.Country != "" {
+		parts = append(parts, a.Country)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func (a ASNInfo) asnString() string {
+	if a.ASN == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("AS%d", a.ASN)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+type asnRange struct {
+	start, end netip.Addr
+	info       ASNInfo
+}
+
+// IPEnricher annotates addresses with ASN, AS name and country from offline databases:
+// MaxMind-format .mmdb files (GeoLite2-ASN, GeoLite2-Country, ipinfo and similar) and
+// IP-to-ASN TSV dumps (range_start, range_end, AS_number, country_code, AS_description).
+// A nil *IPEnricher is valid and never finds anything.
+type IPEnricher struct {
+	mmdbs  []*mmdbReader
+	ranges []asnRange
+}
+
+// LoadIPEnricher opens every database in paths. Files ending in .mmdb are read as MaxMind
+// DBs; anything else is read as a TSV dump. A nil enricher is returned for no paths.
+func LoadIPEnricher(paths []string) (*IPEnricher, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	e := &IPEnricher{}
+	for _, p := range paths {
+		if strings.HasSuffix(strings.ToLower(p), ".mmdb") {
+			db, err := openMMDB(p)
+			if err != nil {
+				return nil, err
+			}
+			e.mmdbs = append(e.mmdbs, db)
+			continue
+		}
+		if err := e.loadTSV(p); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(e.ranges, func(i, j int) bool { return e.ranges[i].start.Less(e.ranges[j].start) })
+	return e, nil
+}
+
+func (e *IPEnricher) loadTSV(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		l := scanner.Text()
+		if strings.TrimSpace(l) == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		fields := strings.Split(l, "\t")
+		if len(fields) < 3 {
+			return fmt.Errorf("%s:%d: expected tab-separated range_start, range_end, AS_number", path, lineNo)
+		}
+		start, err1 := netip.ParseAddr(fields[0])
+		end, err2 := netip.ParseAddr(fields[1])
+		if err1 != nil || err2 != nil {
+			// Tolerate a header line.
+			if lineNo == 1 {
+				continue
+			}
+			return fmt.Errorf("%s:%d: invalid address range", path, lineNo)
+		}
+		asn, err := strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(fields[2]), "AS"), 10, 32)
+		if err != nil {
+			return fmt.Errorf("%s:%d: invalid AS number %q", path, lineNo, fields[2])
+		}
+		if asn == 0 {
+			// AS0 marks unrouted space in these dumps.
+			continue
+		}
+		info := ASNInfo{ASN: asn}
+		if len(fields) > 3 && fields[3] != "None" {
+			info.Country = fields[3]
+		}
+		if len(fields) > 4 {
+			info.Org = fields[4]
+		}
+		e.ranges = append(e.ranges, asnRange{start: start.Unmap(), end: end.Unmap(), info: info})
+	}
+	return scanner.Err()
+}
+
+// Lookup returns what the loaded databases know about ip. Fields found in several
+// databases are taken from the first one that has them.
+func (e *IPEnricher) Lookup(ip net.IP) (ASNInfo, bool) {
+	var info ASNInfo
+	if e == nil || ip == nil {
+		return info, false
+	}
+	merge := func(o ASNInfo) {
+		if info.ASN == 0 {
+			info.ASN = o.ASN
+		}
+		if info.Org == "" {
+			info.Org = o.Org
+		}
+		if info.Country == "" {
+			info.Country = o.Country
+		}
+	}
+	for _, db := range e.mmdbs {
+		rec, err := db.lookup(ip)
+		if err != nil || rec == nil {
+			continue
+		}
+		merge(mmdbASNInfo(rec))
+	}
+	if addr, ok := netip.AddrFromSlice(ip); ok {
+		merge(e.lookupRange(addr.Unmap()))
+	}
+	return info, info != ASNInfo{}
+}
+
+// LookupString is Lookup for a textual address.
+func (e *IPEnricher) LookupString(s string) (ASNInfo, bool) {
+	return e.Lookup(net.ParseIP(s))
+}
+
+func (e *IPEnricher) Enabled() bool {
+	return e != nil
+}
+
+func (e *IPEnricher) lookupRange(addr netip.Addr) ASNInfo {
+	i := sort.Search(len(e.ranges), func(i int) bool { return addr.Less(e.ranges[i].start) })
+	if i == 0 {
+		return ASNInfo{}
+	}
+	r := e.ranges[i-1]
+	if addr.BitLen() != r.start.BitLen() || r.end.Less(addr) {
+		return ASNInfo{}
+	}
+	return r.info
+}
+
+// mmdbASNInfo understands the field names used by GeoLite2/GeoIP2 ASN and country
+// databases as well as the flatter ipinfo/iptoasn style layouts.
+func mmdbASNInfo(rec interface{}) ASNInfo {
+	var info ASNInfo
+	m, ok := rec.(map[string]interface{})
+	if !ok {
+		return info
+	}
+	if v, ok := m["autonomous_system_number"]; ok {
+		info.ASN = toUint64(v)
+	}
+	if info.ASN == 0 {
+		if s, ok := m["asn"].(string); ok {
+			info.ASN, _ = strconv.ParseUint(strings.TrimPrefix(strings.ToUpper(s), "AS"), 10, 32)
+		} else {
+			info.ASN = toUint64(m["asn"])
+		}
+	}
+	info.Org = mmdbString(m, "autonomous_system_organization")
+	if info.Org == "" {
+		info.Org = mmdbString(m, "as_name")
+	}
+	if info.Org == "" {
+		info.Org = mmdbString(m, "name")
+	}
+	info.Country = mmdbString(m, "country", "iso_code")
+	if info.Country == "" {
+		info.Country = mmdbString(m, "registered_country", "iso_code")
+	}
+	if info.Country == "" {
+		info.Country = mmdbString(m, "country_code")
+	}
+	if info.Country == "" {
+		info.Country = mmdbString(m, "country")
+	}
+	return info
+}
+
+// annotateTraceRows appends ASN, AS name and country columns to traceroute rows
+// ([hop, ip, hostname, time]). The ASN of the first hop in a new AS is prefixed with "»"
+// so boundaries along the path stand out.
+func (e *IPEnricher) annotateTraceRows(rows [][]string) [][]string {
+	out := make([][]string, 0, len(rows))
+	var prev uint64
+	for _, r := range rows {
+		info, _ := e.LookupString(r[1])
+		asn := info.asnString()
+		if info.ASN != 0 {
+			if prev != 0 && info.ASN != prev {
+				asn = "» " + asn
+			}
+			prev = info.ASN
+		}
+		row := append(append([]string{}, r...), asn, orDash(info.Org), orDash(info.Country))
+		out = append(out, row)
+	}
+	return out
+}
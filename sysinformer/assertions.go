@@ -0,0 +1,422 @@
+package sysinformer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxAssertBody = 10 << 20
+
+// WebAssertions are the expectations of a synthetic check. Any that fail make the web
+// command exit non-zero.
+type WebAssertions struct {
+	Status       []int         // acceptable final status codes
+	MaxLatency   time.Duration // average total request time
+	Headers      []string      // "Name" (present) or "Name: value" (value contains)
+	BodyContains []string
+	BodyRegex    []string
+	JSON         []string // "path=value" or "path" (exists), e.g. "data.items[0].id=42"
+	MinCertDays  *int     // nil when not asserted; 0 asserts the certificate has not expired
+	DNS          []string // addresses or CNAME targets the host must resolve to
+}
+
+func (a WebAssertions) empty() bool {
+	return len(a.Status) == 0 && a.MaxLatency == 0 && len(a.Headers) == 0 && len(a.BodyContains) == 0 &&
+		len(a.BodyRegex) == 0 && len(a.JSON) == 0 && a.MinCertDays == nil && len(a.DNS) == 0
+}
+
+func (a WebAssertions) needsBody() bool {
+	return len(a.Status) > 0 || len(a.Headers) > 0 || len(a.BodyContains) > 0 || len(a.BodyRegex) > 0 || len(a.JSON) > 0
+}
+
+// AssertionFailure is returned by RunWebDiagnostics when assertions fail.
+type AssertionFailure struct {
+	Failed int
+	Total  int
+}
+
+func (e *AssertionFailure) Error() string {
+	return fmt.Sprintf("%d of %d assertions failed", e.Failed, e.Total)
+}
+
+// LoadAssertions reads a spec file with one assertion per line, named like the flags
+// without their expect- prefix:
+//
+//	status 200
+//	max-latency 300ms
+//	header Content-Type: application/json
+//	body "ok"
+//	body-regex ^\{.*\}$
+//	json data.items[0].id = 42
+//	cert-days 14
+//	dns 93.184.216.34
+func LoadAssertions(path string) (WebAssertions, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return WebAssertions{}, err
+	}
+	defer f.Close()
+	return parseAssertions(f)
+}
+
+func parseAssertions(r io.Reader) (WebAssertions, error) {
+	var a WebAssertions
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		l := strings.TrimSpace(sc.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		key, value, _ := strings.Cut(l, " ")
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return a, fmt.Errorf("line %d: %s needs a value", lineNo, key)
+		}
+		var err error
+		switch strings.ToLower(key) {
+		case "status":
+			var code int
+			if code, err = strconv.Atoi(value); err == nil {
+				a.Status = append(a.Status, code)
+			}
+		case "max-latency":
+			a.MaxLatency, err = time.ParseDuration(value)
+		case "header":
+			a.Headers = append(a.Headers, value)
+		case "body":
+			a.BodyContains = append(a.BodyContains, unquote(value))
+		case "body-regex":
+			_, err = regexp.Compile(value)
+			a.BodyRegex = append(a.BodyRegex, value)
+		case "json":
+			a.JSON = append(a.JSON, value)
+		case "cert-days":
+			var days int
+			if days, err = strconv.Atoi(value); err == nil && days < 0 {
+				err = fmt.Errorf("cert-days must not be negative")
+			}
+			a.MinCertDays = &days
+		case "dns":
+			a.DNS = append(a.DNS, value)
+		default:
+			return a, fmt.Errorf("line %d: unknown assertion %q", lineNo, key)
+		}
+		if err != nil {
+			return a, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+	}
+	return a, sc.Err()
+}
+
+func unquote(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
+
+// merge appends the assertions in b, read from a file, to those given as flags in a.
+// Single-valued ones are taken from b only when the flag was not given.
+func (a WebAssertions) merge(b WebAssertions) WebAssertions {
+	for _, code := range b.Status {
+		if !slices.Contains(a.Status, code) {
+			a.Status = append(a.Status, code)
+		}
+	}
+	a.Headers = append(a.Headers, b.Headers...)
+	a.BodyContains = append(a.BodyContains, b.BodyContains...)
+	a.BodyRegex = append(a.BodyRegex, b.BodyRegex...)
+	a.JSON = append(a.JSON, b.JSON...)
+	a.DNS = append(a.DNS, b.DNS...)
+	if a.MaxLatency == 0 {
+		a.MaxLatency = b.MaxLatency
+	}
+	if a.MinCertDays == nil {
+		a.MinCertDays = b.MinCertDays
+	}
+	return a
+}
+
+// jsonPathRe splits "data.items[0].id" into its keys and indexes.
+var jsonPathRe = regexp.MustCompile(`[^.\[\]]+|\[\d+\]`)
+
+// jsonLookup walks a decoded JSON document along a dotted path with [n] indexes.
+func jsonLookup(doc interface{}, path string) (interface{}, bool) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	cur := doc
+	for _, tok := range jsonPathRe.FindAllString(path, -1) {
+		if strings.HasPrefix(tok, "[") {
+			i, _ := strconv.Atoi(tok[1 : len(tok)-1])
+			arr, ok := cur.([]interface{})
+			if !ok || i >= len(arr) {
+				return nil, false
+			}
+			cur = arr[i]
+			continue
+		}
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if cur, ok = obj[tok]; !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+// jsonString formats a JSON value for comparison: strings bare, everything else as JSON.
+func jsonString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, _ := json.Marshal(v)
+	return string(b)
+}
+
+type assertResult struct {
+	Name     string
+	Expected string
+	Actual   string
+	Pass     bool
+}
+
+type assertRun struct {
+	results []assertResult
+}
+
+func (r *assertRun) add(name, expected, actual string, pass bool) {
+	r.results = append(r.results, assertResult{Name: name, Expected: expected, Actual: actual, Pass: pass})
+}
+
+func (r *assertRun) checkHTTP(a WebAssertions, targetURL string, timeout time.Duration, opts HTTPCheckOptions) {
+	client, err := opts.Request.client(timeout, true)
+	if err != nil {
+		r.add("HTTP request", "response", err.Error(), false)
+		return
+	}
+	maxRedirects := opts.MaxRedirects
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if opts.NoFollow || len(via) > maxRedirects {
+			return http.ErrUseLastResponse
+		}
+		return nil
+	}
+	req, err := opts.Request.request(targetURL)
+	if err != nil {
+		r.add("HTTP request", "response", err.Error(), false)
+		return
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		r.add("HTTP request", "response", err.Error(), false)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxAssertBody))
+	if err != nil {
+		r.add("HTTP body", "readable", err.Error(), false)
+		return
+	}
+
+	if len(a.Status) > 0 {
+		pass := false
+		want := make([]string, 0, len(a.Status))
+		for _, code := range a.Status {
+			want = append(want, strconv.Itoa(code))
+			pass = pass || resp.StatusCode == code
+		}
+		r.add("Status", strings.Join(want, " or "), strconv.Itoa(resp.StatusCode), pass)
+	}
+	for _, h := range a.Headers {
+		name, value, hasValue := strings.Cut(h, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		got := resp.Header.Values(name)
+		actual := orDash(strings.Join(got, ", "))
+		if !hasValue {
+			r.add("Header "+name, "present", truncateForDisplay(actual, 60), len(got) > 0)
+			continue
+		}
+		pass := false
+		for _, v := range got {
+			pass = pass || strings.Contains(strings.ToLower(v), strings.ToLower(value))
+		}
+		r.add("Header "+name, "contains "+value, truncateForDisplay(actual, 60), pass)
+	}
+	for _, s := range a.BodyContains {
+		if bytes.Contains(body, []byte(s)) {
+			r.add("Body contains", strconv.Quote(s), "found", true)
+		} else {
+			r.add("Body contains", strconv.Quote(s), "not found", false)
+		}
+	}
+	for _, expr := range a.BodyRegex {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			r.add("Body matches", expr, "invalid regex: "+err.Error(), false)
+			continue
+		}
+		m := re.Find(body)
+		actual := "no match"
+		if m != nil {
+			actual = truncateForDisplay(string(m), 40)
+		}
+		r.add("Body matches", expr, actual, m != nil)
+	}
+	if len(a.JSON) > 0 {
+		var doc interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		jsonErr := dec.Decode(&doc)
+		for _, spec := range a.JSON {
+			path, want, hasWant := strings.Cut(spec, "=")
+			path, want = strings.TrimSpace(path), unquote(strings.TrimSpace(want))
+			expected := "exists"
+			if hasWant {
+				expected = want
+			}
+			if jsonErr != nil {
+				r.add("JSON "+path, expected, "body is not JSON", false)
+				continue
+			}
+			v, ok := jsonLookup(doc, path)
+			switch {
+			case !ok:
+				r.add("JSON "+path, expected, "missing", false)
+			case !hasWant:
+				r.add("JSON "+path, expected, truncateForDisplay(jsonString(v), 40), true)
+			default:
+				got := jsonString(v)
+				r.add("JSON "+path, expected, truncateForDisplay(got, 40), got == want)
+			}
+		}
+	}
+}
+
+func (r *assertRun) checkLatency(max time.Duration, targetURL string, count int, timeout time.Duration, reqOpts HTTPRequestOptions) {
+	client, err := reqOpts.client(timeout, false)
+	if err != nil {
+		r.add("Latency", "≤ "+max.String(), err.Error(), false)
+		return
+	}
+	var total time.Duration
+	ok := 0
+	for i := 0; i < count; i++ {
+		req, err := reqOpts.request(targetURL)
+		if err != nil {
+			break
+		}
+		if t, _, err := timedRequest(client, req); err == nil {
+			total += t.Total
+			ok++
+		}
+	}
+	if ok == 0 {
+		r.add("Latency", "≤ "+max.String(), "all requests failed", false)
+		return
+	}
+	avg := total / time.Duration(ok)
+	r.add("Latency", "≤ "+max.String(), fmt.Sprintf("%s ms avg", formatMs(avg)), avg <= max)
+}
+
+func (r *assertRun) checkCert(minDays int, domain string, timeout time.Duration, opts SSLCheckOptions) {
+	roots, err := loadCertPool(opts.CAFile)
+	if err != nil {
+		r.add("Certificate days", fmt.Sprintf("≥ %d", minDays), err.Error(), false)
+		return
+	}
+	insp, err := inspectCert(domain, timeout, opts, roots)
+	if err != nil {
+		r.add("Certificate days", fmt.Sprintf("≥ %d", minDays), err.Error(), false)
+		return
+	}
+	days := daysUntil(insp.State.PeerCertificates[0].NotAfter, insp.Now)
+	r.add("Certificate days", fmt.Sprintf("≥ %d", minDays), strconv.Itoa(days), days >= minDays)
+	if len(insp.Problems) > 0 {
+		r.add("Certificate valid", "trusted", insp.Problems[0], false)
+	}
+}
+
+func (r *assertRun) checkDNS(want []string, domain string, resolver *net.Resolver, timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	var answers []string
+	if cname, err := resolver.LookupCNAME(ctx, domain); err == nil && !strings.EqualFold(strings.TrimSuffix(cname, "."), domain) {
+		answers = append(answers, strings.TrimSuffix(cname, "."))
+	}
+	addrs, err := resolver.LookupHost(ctx, domain)
+	if err != nil {
+		for _, w := range want {
+			r.add("DNS", w, err.Error(), false)
+		}
+		return
+	}
+	answers = append(answers, addrs...)
+	for _, w := range want {
+		pass := false
+		for _, a := range answers {
+			if strings.EqualFold(strings.TrimSuffix(w, "."), a) || (net.ParseIP(w) != nil && net.ParseIP(w).Equal(net.ParseIP(a))) {
+				pass = true
+			}
+		}
+		r.add("DNS", w, strings.Join(answers, ", "), pass)
+	}
+}
+
+// CheckAssertions evaluates a against the target and prints one row per assertion. It
+// returns an *AssertionFailure when any assertion fails.
+func CheckAssertions(a WebAssertions, targetURL, domain string, opts WebDiagOptions, resolver *net.Resolver) error {
+	fmt.Println("")
+	PrintSectionHeader("ASSERTIONS")
+
+	timeout := time.Duration(opts.TimeoutSec) * time.Second
+	run := &assertRun{}
+	if len(a.DNS) > 0 {
+		run.checkDNS(a.DNS, domain, resolver, timeout)
+	}
+	if a.needsBody() {
+		run.checkHTTP(a, targetURL, timeout, HTTPCheckOptions{
+			MaxRedirects: opts.MaxRedirects,
+			NoFollow:     opts.NoFollow,
+			Request:      opts.requestOptions(),
+		})
+	}
+	if a.MaxLatency > 0 {
+		run.checkLatency(a.MaxLatency, targetURL, opts.LatencyCount, timeout, opts.requestOptions())
+	}
+	if a.MinCertDays != nil {
+		run.checkCert(*a.MinCertDays, domain, timeout, opts.sslOptions())
+	}
+
+	rows := make([][]string, 0, len(run.results))
+	failed := 0
+	for _, res := range run.results {
+		verdict := VerdictPass
+		if !res.Pass {
+			verdict = VerdictFail
+			failed++
+		}
+		rows = append(rows, []string{res.Name, res.Expected, res.Actual, colorVerdict(verdict)})
+	}
+	RenderTable([]string{"Assertion", "Expected", "Actual", "Result"}, rows)
+	if failed > 0 {
+		fmt.Printf("\033[91m%d of %d assertions failed\033[0m\n", failed, len(run.results))
+		return &AssertionFailure{Failed: failed, Total: len(run.results)}
+	}
+	fmt.Printf("\033[92mAll %d assertions passed\033[0m\n", len(run.results))
+	return nil
+}
@@ -0,0 +1,133 @@
+package sysinformer
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func intPtr(n int) *int { return &n }
+
+func TestWebAssertionsMergeFlagsWin(t *testing.T) {
+	flags := WebAssertions{Status: []int{200}, MaxLatency: 200 * time.Millisecond, MinCertDays: intPtr(0), Headers: []string{"X-A"}}
+	file := WebAssertions{Status: []int{200, 204}, MaxLatency: time.Second, MinCertDays: intPtr(14), Headers: []string{"X-B"}}
+	got := flags.merge(file)
+	want := WebAssertions{
+		Status:      []int{200, 204},
+		MaxLatency:  200 * time.Millisecond,
+		MinCertDays: intPtr(0),
+		Headers:     []string{"X-A", "X-B"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merge = %+v, want %+v", got, want)
+	}
+	if got := (WebAssertions{}).merge(file); got.MinCertDays == nil || *got.MinCertDays != 14 {
+		t.Errorf("unset MinCertDays not taken from the file: %v", got.MinCertDays)
+	}
+}
+
+func TestParseAssertions(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    WebAssertions
+		wantErr string
+	}{
+		{
+			name: "every key",
+			in: `# comment
+status 200
+STATUS 204
+
+max-latency 250ms
+header Content-Type: application/json
+body "hello world"
+body-regex ^\{
+json data.items[0].id=42
+cert-days 0
+dns 203.0.113.10
+`,
+			want: WebAssertions{
+				Status:       []int{200, 204},
+				MaxLatency:   250 * time.Millisecond,
+				Headers:      []string{"Content-Type: application/json"},
+				BodyContains: []string{"hello world"},
+				BodyRegex:    []string{`^\{`},
+				JSON:         []string{"data.items[0].id=42"},
+				MinCertDays:  intPtr(0),
+				DNS:          []string{"203.0.113.10"},
+			},
+		},
+		{name: "empty file", in: "\n# nothing\n", want: WebAssertions{}},
+		{name: "unknown key", in: "status 200\nexpect 200\n", wantErr: `line 2: unknown assertion "expect"`},
+		{name: "missing value", in: "status\n", wantErr: "line 1: status needs a value"},
+		{name: "bad status", in: "status ok\n", wantErr: "line 1:"},
+		{name: "bad duration", in: "max-latency 5\n", wantErr: "line 1:"},
+		{name: "bad regex", in: "body-regex (\n", wantErr: "line 1:"},
+		{name: "negative cert days", in: "cert-days -1\n", wantErr: "line 1: cert-days must not be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseAssertions(strings.NewReader(tt.in))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJSONLookup(t *testing.T) {
+	body := `{"data": {"items": [{"id": 42, "big": 12345678901234567890, "price": 1.50}, {"id": 7}],
+		"name": "widget", "ok": true, "none": null, "tags": ["a", "b"]}}`
+	var doc interface{}
+	// Decoded as the JSON assertion does, so numbers keep their literal text.
+	dec := json.NewDecoder(bytes.NewReader([]byte(body)))
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path   string
+		want   string
+		wantOK bool
+	}{
+		{"data.name", "widget", true},
+		{"$.data.name", "widget", true},
+		{".data.name", "widget", true},
+		{"data.items[0].id", "42", true},
+		{"data.items[1].id", "7", true},
+		{"data.items[0].big", "12345678901234567890", true},
+		{"data.items[0].price", "1.50", true},
+		{"data.ok", "true", true},
+		{"data.none", "null", true},
+		{"data.tags", `["a","b"]`, true},
+		{"data.tags[1]", "b", true},
+		{"data.items[2].id", "", false},
+		{"data.missing", "", false},
+		{"data.name.first", "", false},
+		{"data.items.id", "", false},
+		{"data[0]", "", false},
+	}
+	for _, tt := range tests {
+		v, ok := jsonLookup(doc, tt.path)
+		if ok != tt.wantOK {
+			t.Errorf("jsonLookup(%q) ok = %v, want %v", tt.path, ok, tt.wantOK)
+			continue
+		}
+		if ok && jsonString(v) != tt.want {
+			t.Errorf("jsonLookup(%q) = %s, want %s", tt.path, jsonString(v), tt.want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package sysinformer
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backendProbe is what the per-IP check measured against one backend address.
+type backendProbe struct {
+	IP net.IP
+
+	Status   int
+	Location string // redirect target, when Status is a redirect
+	Server   string
+	HTTPErr  string
+
+	Latency    time.Duration // average total request time
+	LatencyErr string
+
+	CertErr      string
+	CertInfo     bool // CertErr is informational: the target is plain HTTP
+	Fingerprint  string
+	Subject      string
+	NotAfter     time.Time
+	CertDays     int
+	CertProblems []string
+}
+
+func (p backendProbe) failed() bool {
+	return p.HTTPErr != "" || p.LatencyErr != "" || (p.CertErr != "" && !p.CertInfo) || len(p.CertProblems) > 0 || p.Status >= 500
+}
+
+func probeBackend(ip net.IP, u *url.URL, opts WebDiagOptions, roots *x509.CertPool) backendProbe {
+	timeout := time.Duration(opts.TimeoutSec) * time.Second
+	host, port := u.Hostname(), targetPort(u)
+	p := backendProbe{IP: ip}
+
+	reqOpts := opts.requestOptions().pinnedTo(host, port, ip)
+	client, err := reqOpts.client(timeout, false)
+	if err != nil {
+		p.HTTPErr = err.Error()
+		return p
+	}
+	// Each backend's own answer is what matters, so redirects are reported, not followed.
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	var totals []time.Duration
+	for i := 0; i < opts.LatencyCount; i++ {
+		req, err := reqOpts.request(u.String())
+		if err != nil {
+			p.HTTPErr = err.Error()
+			break
+		}
+		t, resp, err := timedRequest(client, req)
+		if err != nil {
+			p.LatencyErr = err.Error()
+			continue
+		}
+		p.Status = resp.StatusCode
+		p.Location = resp.Header.Get("Location")
+		p.Server = resp.Header.Get("Server")
+		totals = append(totals, t.Total)
+	}
+	if len(totals) > 0 {
+		p.LatencyErr = ""
+		p.Latency = averageDuration(totals)
+	} else if p.HTTPErr == "" {
+		p.HTTPErr, p.LatencyErr = p.LatencyErr, ""
+	}
+
+	insp, err := inspectCert(ip.String(), timeout, opts.sslOptionsFor(u), roots)
+	if err != nil {
+		p.CertErr = err.Error()
+		p.CertInfo = u.Scheme != "https"
+	} else {
+		leaf := insp.State.PeerCertificates[0]
+		p.Fingerprint = certFingerprint(leaf)
+		p.Subject = describeName(leaf.Subject.CommonName, leaf.Subject.Organization)
+		p.NotAfter = leaf.NotAfter
+		p.CertDays = daysUntil(leaf.NotAfter, insp.Now)
+		p.CertProblems = insp.Problems
+	}
+	return p
+}
+
+// majority returns the most common non-empty value, and whether values disagree at all.
+func majority(values []string) (string, bool) {
+	counts := map[string]int{}
+	best := ""
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		counts[v]++
+		if counts[v] > counts[best] {
+			best = v
+		}
+	}
+	return best, len(counts) > 1
+}
+
+// CheckBackends resolves every A and AAAA address of the target and runs the HTTP status,
+// latency and certificate checks against each one with the real Host header and SNI. It is
+// meant for DNS round robin, where one broken node only fails some of the requests: status
+// codes, certificates and response times that differ from the other addresses are
+// highlighted.
+func CheckBackends(targetURL string, opts WebDiagOptions, resolver *net.Resolver) {
+	fmt.Println("")
+	PrintSectionHeader("BACKENDS")
+
+	timeout := time.Duration(opts.TimeoutSec) * time.Second
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		fmt.Printf("Invalid URL: %v\n", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ips, err := resolveAddrs(ctx, resolver, u.Hostname())
+	cancel()
+	if err != nil {
+		fmt.Printf("Could not resolve %s: %v\n", u.Hostname(), err)
+		return
+	}
+	roots, err := loadCertPool(opts.CAFile)
+	if err != nil {
+		fmt.Printf("Could not load trust roots: %v\n", err)
+		return
+	}
+
+	probes := make([]backendProbe, len(ips))
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probes[i] = probeBackend(ip, u, opts, roots)
+		}()
+	}
+	wg.Wait()
+
+	statuses := make([]string, len(probes))
+	fingerprints := make([]string, len(probes))
+	latencies := make([]time.Duration, len(probes))
+	for i, p := range probes {
+		if p.Status != 0 {
+			statuses[i] = strconv.Itoa(p.Status) + " " + p.Location
+		}
+		fingerprints[i] = p.Fingerprint
+		latencies[i] = p.Latency
+	}
+	commonStatus, statusDiffers := majority(statuses)
+	commonCert, certDiffers := majority(fingerprints)
+	slow := slowMarker(latencies)
+
+	rows := make([][]string, 0, len(probes))
+	var notes []string
+	for i, p := range probes {
+		status := "-"
+		switch {
+		case p.HTTPErr != "":
+			status = colorCell("\033[91m", "failed")
+		case p.Status != 0:
+			status = strconv.Itoa(p.Status)
+			if p.Location != "" {
+				status += " -> " + truncateForDisplay(p.Location, 40)
+			}
+			if statusDiffers && statuses[i] != commonStatus {
+				status = colorCell("\033[93m", status+" (differs)")
+			}
+		}
+
+		cert, expires := "-", "-"
+		switch {
+		case p.CertInfo:
+		case p.CertErr != "":
+			cert = colorCell("\033[91m", "failed")
+		default:
+			cert = p.Fingerprint[:16]
+			switch {
+			case len(p.CertProblems) > 0:
+				cert = colorCell("\033[91m", cert+" (invalid)")
+			case certDiffers && p.Fingerprint != commonCert:
+				cert = colorCell("\033[93m", cert+" (differs)")
+			}
+			expires = expiryStatus(p.CertDays, SSL_WARN_DAYS, SSL_CRIT_DAYS)
+		}
+
+		verdict := VerdictPass
+		switch {
+		case p.failed() || (p.CertErr == "" && p.CertDays <= SSL_CRIT_DAYS):
+			verdict = VerdictFail
+		case (statusDiffers && statuses[i] != commonStatus) || (certDiffers && p.Fingerprint != commonCert) ||
+			slow[i] || p.Status >= 400 || (p.CertErr == "" && p.CertDays <= SSL_WARN_DAYS):
+			verdict = VerdictWarn
+		}
+		rows = append(rows, []string{
+			p.IP.String(), status, timingCell(p.Latency, p.LatencyErr, slow[i]), cert, expires,
+			orDash(truncateForDisplay(p.Server, 24)), colorVerdict(verdict),
+		})
+
+		certCheck := "certificate"
+		if p.CertInfo {
+			certCheck = "certificate (info, plain HTTP target)"
+		}
+		for _, n := range []struct{ check, err string }{{"HTTP", p.HTTPErr}, {"latency", p.LatencyErr}, {certCheck, p.CertErr}} {
+			if n.err != "" {
+				notes = append(notes, fmt.Sprintf("%s %s: %s", p.IP, n.check, n.err))
+			}
+		}
+		for _, problem := range p.CertProblems {
+			notes = append(notes, fmt.Sprintf("%s certificate: %s", p.IP, problem))
+		}
+	}
+
+	RenderTable([]string{"Address", "Status", "Latency (ms)", "Certificate (SHA-256)", "Expires", "Server", "Verdict"}, rows)
+	for _, n := range notes {
+		fmt.Println(truncateForDisplay(n, 160))
+	}
+
+	if certDiffers {
+		// List every distinct certificate with the addresses serving it.
+		byCert := map[string][]string{}
+		subjects := map[string]backendProbe{}
+		var fps []string
+		for _, p := range probes {
+			if p.Fingerprint == "" {
+				continue
+			}
+			if _, seen := byCert[p.Fingerprint]; !seen {
+				fps = append(fps, p.Fingerprint)
+				subjects[p.Fingerprint] = p
+			}
+			byCert[p.Fingerprint] = append(byCert[p.Fingerprint], p.IP.String())
+		}
+		sort.SliceStable(fps, func(i, j int) bool { return len(byCert[fps[i]]) > len(byCert[fps[j]]) })
+		certRows := make([][]string, 0, len(fps))
+		for _, fp := range fps {
+			p := subjects[fp]
+			certRows = append(certRows, []string{fp[:16], p.Subject, p.NotAfter.Format("2006-01-02"), strings.Join(byCert[fp], "\n")})
+		}
+		fmt.Printf("%d different certificates are served:\n", len(fps))
+		RenderTable([]string{"Certificate (SHA-256)", "Subject", "Not After", "Addresses"}, certRows)
+	}
+
+	summary := fmt.Sprintf("%d addresses", len(probes))
+	if statusDiffers {
+		summary += "; status codes differ"
+	}
+	if certDiffers {
+		summary += "; certificates differ"
+	}
+	if n := countTrue(slow); n > 0 {
+		summary += fmt.Sprintf("; %d much slower than the fastest", n)
+	}
+	if !statusDiffers && !certDiffers && countTrue(slow) == 0 {
+		summary += "; responses consistent"
+	}
+	fmt.Println(summary)
+}
+
+func countTrue(bs []bool) int {
+	n := 0
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return n
+}
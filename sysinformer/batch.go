@@ -0,0 +1,425 @@
+package sysinformer
+
+import (
+	"bufio"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DEFAULT_BATCH_CONCURRENCY = 5
+
+// batchResult holds what the batch run measured for one target. Empty error strings and
+// zero "ran" flags mean a check succeeded or was not selected.
+type batchResult struct {
+	Target string
+	URL    string
+	Domain string
+	Err    string // target could not be validated; nothing else ran
+
+	DNSRan bool
+	Addrs  []string
+	DNSErr string
+
+	HTTPRan   bool
+	Status    int
+	FinalURL  string
+	Redirects int
+	HTTPErr   string
+
+	LatencyRan bool
+	Latencies  []time.Duration
+	LatencyErr string
+
+	CertRan      bool
+	CertNotAfter time.Time
+	CertDays     int
+	CertProblems []string
+	CertErr      string
+
+	PingRan  bool
+	PingLoss float64
+	PingErr  string
+}
+
+// LoadWebTargets reads one URL or host per line. Blank lines and '#' comments are ignored.
+func LoadWebTargets(r io.Reader) ([]string, error) {
+	var out []string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out, sc.Err()
+}
+
+func checkBatchTarget(target string, opts WebDiagOptions, resolver *net.Resolver, roots *x509.CertPool, checks batchChecks) batchResult {
+	timeout := time.Duration(opts.TimeoutSec) * time.Second
+	r := batchResult{Target: target}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	nURL, domain, err := validateTargetWith(ctx, target, resolver)
+	if err != nil {
+		r.Err = err.Error()
+		return r
+	}
+	r.URL, r.Domain = nURL, domain
+
+	if checks.dns {
+		r.DNSRan = true
+		if ips, err := resolver.LookupIPAddr(ctx, domain); err != nil {
+			r.DNSErr = err.Error()
+		} else {
+			for _, ip := range ips {
+				r.Addrs = append(r.Addrs, ip.IP.String())
+			}
+			sort.Strings(r.Addrs)
+		}
+	}
+	if checks.http {
+		r.HTTPRan = true
+		reqOpts := opts.requestOptions()
+		client, err := reqOpts.client(timeout, true)
+		var chain *redirectChain
+		if err == nil {
+			chain, err = followRedirects(client, reqOpts, nURL, opts.MaxRedirects, opts.NoFollow)
+		}
+		if err != nil {
+			r.HTTPErr = err.Error()
+		} else {
+			r.Status = chain.Final.StatusCode
+			r.FinalURL = chain.Hops[len(chain.Hops)-1].URL
+			r.Redirects = len(chain.Hops) - 1
+		}
+	}
+	if checks.latency {
+		r.LatencyRan = true
+		reqOpts := opts.requestOptions()
+		client, err := reqOpts.client(timeout, false)
+		if err != nil {
+			r.LatencyErr = err.Error()
+		}
+		for i := 0; client != nil && i < opts.LatencyCount; i++ {
+			req, err := reqOpts.request(nURL)
+			if err != nil {
+				r.LatencyErr = err.Error()
+				break
+			}
+			t, _, err := timedRequest(client, req)
+			if err != nil {
+				r.LatencyErr = err.Error()
+				continue
+			}
+			r.Latencies = append(r.Latencies, t.Total)
+		}
+	}
+	if checks.ssl {
+		r.CertRan = true
+		sslOpts := opts.sslOptions()
+		if u, err := url.Parse(nURL); err == nil {
+			sslOpts = opts.sslOptionsFor(u)
+		}
+		insp, err := inspectCert(domain, timeout, sslOpts, roots)
+		if err != nil {
+			r.CertErr = err.Error()
+		} else {
+			r.CertNotAfter = insp.State.PeerCertificates[0].NotAfter
+			r.CertDays = daysUntil(r.CertNotAfter, insp.Now)
+			r.CertProblems = insp.Problems
+		}
+	}
+	if checks.ping {
+		r.PingRan = true
+		text, err := runPing(domain, opts.Count, timeout)
+		if loss, ok := parsePingLoss(text); ok {
+			r.PingLoss = loss
+		} else if err != nil {
+			r.PingErr = err.Error()
+		} else {
+			r.PingErr = "could not parse ping output"
+		}
+	}
+	return r
+}
+
+func (r batchResult) avgLatency() time.Duration {
+	if len(r.Latencies) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, d := range r.Latencies {
+		total += d
+	}
+	return total / time.Duration(len(r.Latencies))
+}
+
+// failed reports whether any selected check failed for the target.
+func (r batchResult) failed() bool {
+	return r.Err != "" || r.DNSErr != "" || r.HTTPErr != "" || r.Status >= 400 ||
+		(r.LatencyRan && len(r.Latencies) == 0) || r.CertErr != "" || len(r.CertProblems) > 0 ||
+		r.CertDays < 0 || r.PingErr != "" || r.PingLoss >= 100
+}
+
+func colorHTTPStatus(code int) string {
+	s := strconv.Itoa(code)
+	switch {
+	case code >= 400:
+		return colorCell("\033[91m", s)
+	case code >= 300:
+		return colorCell("\033[93m", s)
+	}
+	return colorCell("\033[92m", s)
+}
+
+func (r batchResult) matrixRow() []string {
+	fail := func(s string) string { return colorCell("\033[91m", s) }
+	row := []string{r.Target, "-", "-", "-", "-", "-"}
+	if r.Err != "" {
+		row[1] = fail("unresolvable")
+		return row
+	}
+	if r.DNSRan {
+		row[1] = colorCell("\033[92m", fmt.Sprintf("ok (%d)", len(r.Addrs)))
+		if r.DNSErr != "" {
+			row[1] = fail("FAIL")
+		}
+	}
+	if r.HTTPRan {
+		if r.HTTPErr != "" {
+			row[2] = fail("error")
+		} else {
+			row[2] = colorHTTPStatus(r.Status)
+			if r.Redirects > 0 {
+				row[2] += fmt.Sprintf(" (%d→)", r.Redirects)
+			}
+		}
+	}
+	if r.LatencyRan {
+		if len(r.Latencies) == 0 {
+			row[3] = fail("failed")
+		} else {
+			row[3] = formatMs(r.avgLatency()) + " ms"
+		}
+	}
+	if r.CertRan {
+		switch {
+		case r.CertErr != "":
+			row[4] = fail("error")
+		case len(r.CertProblems) > 0 && r.CertDays >= 0:
+			row[4] = fail(fmt.Sprintf("invalid, %dd", r.CertDays))
+		default:
+			row[4] = expiryStatus(r.CertDays, SSL_WARN_DAYS, SSL_CRIT_DAYS)
+		}
+	}
+	if r.PingRan {
+		switch {
+		case r.PingErr != "":
+			row[5] = fail("error")
+		case r.PingLoss >= 100:
+			row[5] = fail("100%")
+		case r.PingLoss > 0:
+			row[5] = colorCell("\033[93m", fmt.Sprintf("%.0f%%", r.PingLoss))
+		default:
+			row[5] = colorCell("\033[92m", "0%")
+		}
+	}
+	return row
+}
+
+func (r batchResult) detailRows() [][]string {
+	rows := [][]string{{"URL", orDash(r.URL)}}
+	if r.Err != "" {
+		return append(rows, []string{"Error", r.Err})
+	}
+	if r.DNSRan {
+		rows = append(rows, []string{"Addresses", orDash(firstNonEmpty(r.DNSErr, strings.Join(r.Addrs, "\n")))})
+	}
+	if r.HTTPRan {
+		v := r.HTTPErr
+		if v == "" {
+			v = fmt.Sprintf("%d %s", r.Status, http.StatusText(r.Status))
+			if r.Redirects > 0 {
+				v += fmt.Sprintf(" after %d redirects\n%s", r.Redirects, r.FinalURL)
+			}
+		}
+		rows = append(rows, []string{"HTTP", v})
+	}
+	if r.LatencyRan {
+		parts := make([]string, 0, len(r.Latencies))
+		for _, d := range r.Latencies {
+			parts = append(parts, formatMs(d))
+		}
+		v := strings.Join(parts, ", ") + " ms"
+		if len(parts) == 0 {
+			v = r.LatencyErr
+		} else if r.LatencyErr != "" {
+			v += "\n" + r.LatencyErr
+		}
+		rows = append(rows, []string{"Latency", v})
+	}
+	if r.CertRan {
+		v := r.CertErr
+		if v == "" {
+			v = "expires " + r.CertNotAfter.Format("2006-01-02")
+			if len(r.CertProblems) > 0 {
+				v += "\n" + strings.Join(r.CertProblems, "\n")
+			}
+		}
+		rows = append(rows, []string{"Certificate", v})
+	}
+	if r.PingRan {
+		rows = append(rows, []string{"Ping", firstNonEmpty(r.PingErr, fmt.Sprintf("%.0f%% packet loss", r.PingLoss))})
+	}
+	return rows
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// batchChecks are the checks a batch run performs for every target.
+type batchChecks struct {
+	ping, latency, dns, http, ssl bool
+}
+
+// BatchFailure is returned by RunBatchWebDiagnostics when any target has a failed check.
+type BatchFailure struct {
+	Failed int
+	Total  int
+}
+
+func (e *BatchFailure) Error() string {
+	return fmt.Sprintf("%d of %d targets failed", e.Failed, e.Total)
+}
+
+// batchUnsupported returns the flags set in o for checks that only run against a single
+// target.
+func (o WebDiagOptions) batchUnsupported() []string {
+	var flags []string
+	for _, f := range []struct {
+		set  bool
+		name string
+	}{
+		{o.Whois, "--whois"}, {o.Trace, "--trace"}, {o.MTR, "--mtr"}, {o.TLSScan, "--tls-scan"},
+		{o.DNSSEC, "--dnssec"}, {o.Email, "--email"}, {o.Protocols, "--protocols"}, {o.HTTP3, "--http3"},
+		{o.DualStack, "--dual-stack"}, {o.PerIP, "--per-ip"}, {o.Page, "--page"}, {o.WellKnown, "--wellknown"},
+		{len(o.Compare) > 0, "--compare-resolvers"}, {o.Revocation || o.OCSPURL != "", "--revocation"},
+	} {
+		if f.set {
+			flags = append(flags, f.name)
+		}
+	}
+	return flags
+}
+
+// RunBatchWebDiagnostics runs the selected ping, latency, DNS, HTTP and SSL checks against
+// every target in opts.TargetsFile, opts.Concurrency targets at a time, and prints a
+// summary matrix followed by per-target detail when opts.Detail is set. It returns a
+// *BatchFailure when any target fails.
+func RunBatchWebDiagnostics(opts WebDiagOptions) error {
+	if flags := opts.batchUnsupported(); len(flags) > 0 {
+		return fmt.Errorf("%s cannot be combined with --targets-file, which runs only --ping, --latency, --dns, --http and --ssl",
+			strings.Join(flags, ", "))
+	}
+	var in io.Reader = os.Stdin
+	if opts.TargetsFile != "-" {
+		f, err := os.Open(opts.TargetsFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	targets, err := LoadWebTargets(in)
+	if err != nil {
+		return err
+	}
+	if len(targets) == 0 {
+		return fmt.Errorf("no targets in %s", opts.TargetsFile)
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DEFAULT_BATCH_CONCURRENCY
+	}
+
+	dnsOpts, err := opts.dnsOptions()
+	if err != nil {
+		return err
+	}
+	roots, err := loadCertPool(opts.CAFile)
+	if err != nil {
+		return fmt.Errorf("loading trust roots: %w", err)
+	}
+	all := opts.Full || !(opts.Ping || opts.Latency || opts.DNS || opts.HTTP || opts.SSL)
+	checks := batchChecks{
+		ping:    opts.Ping || all,
+		latency: opts.Latency || all,
+		dns:     opts.DNS || all,
+		http:    opts.HTTP || all,
+		ssl:     opts.SSL || all,
+	}
+
+	PrintPanel("Website Diagnostic", fmt.Sprintf("%d targets, %d at a time", len(targets), opts.Concurrency))
+
+	results := make([]batchResult, len(targets))
+	resolver := dnsOpts.Resolver.Resolver()
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = checkBatchTarget(t, opts, resolver, roots, checks)
+		}()
+	}
+	wg.Wait()
+
+	rows := make([][]string, 0, len(results))
+	failed := 0
+	for _, r := range results {
+		rows = append(rows, r.matrixRow())
+		if r.failed() {
+			failed++
+		}
+	}
+	fmt.Println("")
+	PrintSectionHeader("SUMMARY")
+	RenderTable([]string{"Target", "DNS", "HTTP", "Latency", "Cert", "Ping loss"}, rows)
+	fmt.Printf("%d targets: %d ok, %d with failures\n", len(results), len(results)-failed, failed)
+
+	if opts.Detail {
+		for _, r := range results {
+			fmt.Println("")
+			PrintSectionHeader(r.Target)
+			RenderKeyValueTable("Check", "Result", r.detailRows())
+		}
+	}
+
+	PrintPanel("Diagnostic complete", "")
+	if failed > 0 {
+		return &BatchFailure{Failed: failed, Total: len(results)}
+	}
+	return nil
+}
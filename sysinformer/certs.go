@@ -0,0 +1,343 @@
+package sysinformer
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Certificate states reported by the certs command, from worst to best.
+const (
+	CertStatusError    = "error"
+	CertStatusInvalid  = "invalid"
+	CertStatusExpired  = "expired"
+	CertStatusCritical = "critical"
+	CertStatusWarning  = "warning"
+	CertStatusOK       = "ok"
+)
+
+// Exit codes returned by the certs command for CI use.
+const (
+	CERTS_EXIT_OK      = 0
+	CERTS_EXIT_WARN    = 1
+	CERTS_EXIT_CRIT    = 2
+	CERTS_EXIT_UNKNOWN = 3 // bad options or endpoint list; nothing was checked
+)
+
+const DEFAULT_CERTS_CONCURRENCY = 10
+
+// CertsOptions configures a bulk certificate expiry run.
+type CertsOptions struct {
+	File        string
+	Concurrency int
+	WarnDays    int    // negative for SSL_WARN_DAYS; 0 warns only on expiry
+	CritDays    int    // negative for SSL_CRIT_DAYS
+	Format      string // table, json or csv
+	CAFile      string
+	TimeoutSec  int
+}
+
+// CertResult is the outcome for one endpoint.
+type CertResult struct {
+	Endpoint   string    `json:"endpoint"`
+	ServerName string    `json:"server_name"`
+	Subject    string    `json:"subject,omitempty"`
+	Issuer     string    `json:"issuer,omitempty"`
+	NotAfter   time.Time `json:"not_after,omitzero"`
+	DaysLeft   int       `json:"days_left"`
+	Status     string    `json:"status"`
+	Problems   []string  `json:"problems,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+func certStatusRank(s string) int {
+	switch s {
+	case CertStatusError:
+		return 0
+	case CertStatusInvalid:
+		return 1
+	case CertStatusExpired:
+		return 2
+	case CertStatusCritical:
+		return 3
+	case CertStatusWarning:
+		return 4
+	}
+	return 5
+}
+
+func colorCertStatus(s string) string {
+	switch s {
+	case CertStatusOK:
+		return colorCell("\033[92m", s)
+	case CertStatusWarning:
+		return colorCell("\033[93m", s)
+	}
+	return colorCell("\033[91m", s)
+}
+
+// certEndpoint is one line of the endpoints file: host[:port] with an optional SNI.
+type certEndpoint struct {
+	Host string
+	Port int
+	SNI  string
+}
+
+// LoadCertEndpoints reads host[:port] entries, one per line, optionally followed by a
+// server name to send instead of the host. Blank lines and '#' comments are ignored.
+func LoadCertEndpoints(r io.Reader) ([]certEndpoint, error) {
+	var out []certEndpoint
+	sc := bufio.NewScanner(r)
+	lineNo := 0
+	for sc.Scan() {
+		lineNo++
+		line := sc.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		ep, err := parseCertEndpoint(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if len(fields) > 1 {
+			ep.SNI = fields[1]
+		}
+		out = append(out, ep)
+	}
+	return out, sc.Err()
+}
+
+func parseCertEndpoint(s string) (certEndpoint, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(s, "https://"), "http://")
+	s = strings.TrimSuffix(s, "/")
+	ep := certEndpoint{Host: s, Port: DEFAULT_TLS_PORT}
+	if host, port, err := net.SplitHostPort(s); err == nil {
+		p, err := strconv.Atoi(port)
+		if err != nil || p <= 0 || p > 65535 {
+			return ep, fmt.Errorf("invalid port in %q", s)
+		}
+		ep.Host, ep.Port = host, p
+	}
+	ep.Host = strings.Trim(ep.Host, "[]")
+	if ep.Host == "" {
+		return ep, fmt.Errorf("missing host in %q", s)
+	}
+	return ep, nil
+}
+
+func checkCertEndpoint(ep certEndpoint, opts CertsOptions, roots *x509.CertPool) CertResult {
+	sslOpts := SSLCheckOptions{Port: ep.Port, SNI: ep.SNI}
+	r := CertResult{
+		Endpoint:   net.JoinHostPort(ep.Host, strconv.Itoa(ep.Port)),
+		ServerName: sslOpts.endpoint(ep.Host).ServerName,
+	}
+	insp, err := inspectCert(ep.Host, time.Duration(opts.TimeoutSec)*time.Second, sslOpts, roots)
+	if err != nil {
+		r.Status, r.Error = CertStatusError, err.Error()
+		return r
+	}
+	leaf := insp.State.PeerCertificates[0]
+	r.Subject = describeName(leaf.Subject.CommonName, leaf.Subject.Organization)
+	r.Issuer = describeName(leaf.Issuer.CommonName, leaf.Issuer.Organization)
+	r.NotAfter = leaf.NotAfter
+	r.DaysLeft = daysUntil(leaf.NotAfter, insp.Now)
+	r.Problems = insp.Problems
+
+	// Expiry of any certificate in the chain counts, not just the leaf.
+	for _, c := range insp.State.PeerCertificates[1:] {
+		if d := daysUntil(c.NotAfter, insp.Now); d < r.DaysLeft {
+			r.DaysLeft = d
+			r.NotAfter = c.NotAfter
+		}
+	}
+	switch {
+	case insp.Now.After(r.NotAfter):
+		r.Status = CertStatusExpired
+	case len(insp.Problems) > 0:
+		r.Status = CertStatusInvalid
+	case r.DaysLeft <= opts.CritDays:
+		r.Status = CertStatusCritical
+	case r.DaysLeft <= opts.WarnDays:
+		r.Status = CertStatusWarning
+	default:
+		r.Status = CertStatusOK
+	}
+	return r
+}
+
+// CheckCerts inspects every endpoint concurrently and returns the results sorted so
+// that failures come first, then by days until expiry.
+func CheckCerts(endpoints []certEndpoint, opts CertsOptions) ([]CertResult, error) {
+	roots, err := loadCertPool(opts.CAFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading trust roots: %w", err)
+	}
+	results := make([]CertResult, len(endpoints))
+	sem := make(chan struct{}, opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, ep := range endpoints {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = checkCertEndpoint(ep, opts, roots)
+		}()
+	}
+	wg.Wait()
+
+	sort.SliceStable(results, func(i, j int) bool {
+		ri, rj := results[i], results[j]
+		if (ri.Status == CertStatusError) != (rj.Status == CertStatusError) {
+			return ri.Status == CertStatusError
+		}
+		return ri.DaysLeft < rj.DaysLeft
+	})
+	return results, nil
+}
+
+// certsExitCode maps the worst result to a CI exit code.
+func certsExitCode(results []CertResult) int {
+	code := CERTS_EXIT_OK
+	for _, r := range results {
+		switch {
+		case certStatusRank(r.Status) <= certStatusRank(CertStatusCritical):
+			return CERTS_EXIT_CRIT
+		case r.Status == CertStatusWarning:
+			code = CERTS_EXIT_WARN
+		}
+	}
+	return code
+}
+
+func writeCertsJSON(w io.Writer, results []CertResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+func writeCertsCSV(w io.Writer, results []CertResult) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"endpoint", "server_name", "status", "days_left", "not_after", "subject", "issuer", "problems", "error"})
+	for _, r := range results {
+		notAfter, days := "", ""
+		if !r.NotAfter.IsZero() {
+			notAfter = r.NotAfter.UTC().Format(time.RFC3339)
+			days = strconv.Itoa(r.DaysLeft)
+		}
+		cw.Write([]string{
+			r.Endpoint, r.ServerName, r.Status, days, notAfter,
+			r.Subject, r.Issuer, strings.Join(r.Problems, "; "), r.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func printCertsTable(results []CertResult) {
+	rows := make([][]string, 0, len(results))
+	counts := map[string]int{}
+	for _, r := range results {
+		counts[r.Status]++
+		expires, days := "-", "-"
+		if !r.NotAfter.IsZero() {
+			expires = r.NotAfter.Format("2006-01-02")
+			days = strconv.Itoa(r.DaysLeft)
+		}
+		detail := r.Error
+		if detail == "" {
+			detail = strings.Join(r.Problems, "\n")
+		}
+		endpoint := r.Endpoint
+		if host, _, _ := net.SplitHostPort(r.Endpoint); host != r.ServerName {
+			endpoint += "\nSNI\u00a0" + r.ServerName
+		}
+		rows = append(rows, []string{
+			endpoint,
+			colorCertStatus(r.Status),
+			days,
+			expires,
+			orDash(r.Subject),
+			orDash(r.Issuer),
+			orDash(truncateForDisplay(detail, 80)),
+		})
+	}
+	RenderTable([]string{"Endpoint", "Status", "Days", "Expires", "Subject", "Issuer", "Detail"}, rows)
+	fmt.Printf("%d endpoints: %d ok, %d warning, %d critical, %d expired, %d invalid, %d error\n",
+		len(results), counts[CertStatusOK], counts[CertStatusWarning], counts[CertStatusCritical],
+		counts[CertStatusExpired], counts[CertStatusInvalid], counts[CertStatusError])
+}
+
+// RunCerts checks every endpoint listed in opts.File, prints the results in the requested
+// format and returns the exit code (0 ok, 1 warning, 2 critical/expired/invalid/error, 3
+// when the run itself failed).
+func RunCerts(opts CertsOptions) (int, error) {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = DEFAULT_CERTS_CONCURRENCY
+	}
+	if opts.TimeoutSec <= 0 {
+		opts.TimeoutSec = 10
+	}
+	if opts.WarnDays < 0 {
+		opts.WarnDays = SSL_WARN_DAYS
+	}
+	if opts.CritDays < 0 {
+		opts.CritDays = SSL_CRIT_DAYS
+	}
+	format := strings.ToLower(opts.Format)
+	if format == "" {
+		format = "table"
+	}
+	if format != "table" && format != "json" && format != "csv" {
+		return CERTS_EXIT_UNKNOWN, fmt.Errorf("unknown format %q (use table, json or csv)", opts.Format)
+	}
+
+	var in io.Reader = os.Stdin
+	if opts.File != "-" {
+		f, err := os.Open(opts.File)
+		if err != nil {
+			return CERTS_EXIT_UNKNOWN, err
+		}
+		defer f.Close()
+		in = f
+	}
+	endpoints, err := LoadCertEndpoints(in)
+	if err != nil {
+		return CERTS_EXIT_UNKNOWN, err
+	}
+	if len(endpoints) == 0 {
+		return CERTS_EXIT_UNKNOWN, fmt.Errorf("no endpoints in %s", opts.File)
+	}
+
+	results, err := CheckCerts(endpoints, opts)
+	if err != nil {
+		return CERTS_EXIT_UNKNOWN, err
+	}
+	switch format {
+	case "json":
+		err = writeCertsJSON(os.Stdout, results)
+	case "csv":
+		err = writeCertsCSV(os.Stdout, results)
+	default:
+		PrintPanel("Certificate Expiry", fmt.Sprintf("%d endpoints, warn ≤%dd, crit ≤%dd", len(endpoints), opts.WarnDays, opts.CritDays))
+		printCertsTable(results)
+	}
+	if err != nil {
+		return CERTS_EXIT_UNKNOWN, err
+	}
+	return certsExitCode(results), nil
+}
@@ -0,0 +1,444 @@
+package sysinformer
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Record types dnsmessage has no constants for.
+const (
+	dnsTypeDS     dnsmessage.Type = 43
+	dnsTypeDNSKEY dnsmessage.Type = 48
+	dnsTypeCAA    dnsmessage.Type = 257
+)
+
+const dnsMaxCNAMEChain = 10
+
+// SRV services looked up for the domain; SRV records only exist under service labels.
+var commonSRVServices = []string{
+	"_sip._tcp", "_sip._udp", "_sips._tcp", "_xmpp-client._tcp", "_xmpp-server._tcp",
+	"_submission._tcp", "_submissions._tcp", "_imaps._tcp", "_pop3s._tcp",
+	"_autodiscover._tcp", "_caldavs._tcp", "_carddavs._tcp", "_ldap._tcp", "_kerberos._udp",
+}
+
+// dnsRecord is one row of the DNS record table.
+type dnsRecord struct {
+	Type  string
+	Name  string
+	Value string
+	TTL   uint32
+}
+
+// systemDNSServer returns the first nameserver from /etc/resolv.conf.
+func systemDNSServer() (*DNSServer, error) {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return ParseDNSServer(fields[1])
+		}
+	}
+	return nil, errors.New("no nameserver in /etc/resolv.conf")
+}
+
+func dnsTypeName(t dnsmessage.Type) string {
+	switch t {
+	case dnsTypeDS:
+		return "DS"
+	case dnsTypeDNSKEY:
+		return "DNSKEY"
+	case dnsTypeCAA:
+		return "CAA"
+	}
+	return strings.TrimPrefix(t.String(), "Type")
+}
+
+// query sends a single recursive question to s. dnssec sets the EDNS0 DO bit so that
+// RRSIGs are returned alongside the answer, and the CD bit so that a validating resolver
+// hands back data it considers bogus instead of failing, letting us report why.
+func (s *DNSServer) query(ctx context.Context, name string, qtype dnsmessage.Type, dnssec bool) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(dnsFQDN(name))
+	if err != nil {
+		return nil, err
+	}
+	var idb [2]byte
+	rand.Read(idb[:])
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: binary.BigEndian.Uint16(idb[:]), RecursionDesired: true, CheckingDisabled: dnssec})
+	b.EnableCompression()
+	if err := b.StartQuestions(); err != nil {
+		return nil, err
+	}
+	if err := b.Question(dnsmessage.Question{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}); err != nil {
+		return nil, err
+	}
+	if err := b.StartAdditionals(); err != nil {
+		return nil, err
+	}
+	var opt dnsmessage.ResourceHeader
+	if err := opt.SetEDNS0(dnsMaxUDP, dnsmessage.RCodeSuccess, dnssec); err != nil {
+		return nil, err
+	}
+	if err := b.OPTResource(opt, dnsmessage.OPTResource{}); err != nil {
+		return nil, err
+	}
+	q, err := b.Finish()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.exchange(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	var m dnsmessage.Message
+	if err := m.Unpack(resp); err != nil {
+		return nil, fmt.Errorf("malformed response: %w", err)
+	}
+	if m.Header.ID != binary.BigEndian.Uint16(idb[:]) {
+		return nil, errors.New("response ID does not match query")
+	}
+	return &m, nil
+}
+
+func dnsFQDN(name string) string {
+	if strings.HasSuffix(name, ".") {
+		return name
+	}
+	return name + "."
+}
+
+func trimDot(n dnsmessage.Name) string {
+	s := strings.TrimSuffix(n.String(), ".")
+	if s == "" {
+		return "."
+	}
+	return s
+}
+
+// formatDNSRecord renders the data of one resource record.
+func formatDNSRecord(r dnsmessage.Resource) string {
+	switch b := r.Body.(type) {
+	case *dnsmessage.AResource:
+		return net.IP(b.A[:]).String()
+	case *dnsmessage.AAAAResource:
+		return net.IP(b.AAAA[:]).String()
+	case *dnsmessage.CNAMEResource:
+		return trimDot(b.CNAME)
+	case *dnsmessage.NSResource:
+		return trimDot(b.NS)
+	case *dnsmessage.PTRResource:
+		return trimDot(b.PTR)
+	case *dnsmessage.MXResource:
+		return fmt.Sprintf("%d %s", b.Pref, trimDot(b.MX))
+	case *dnsmessage.TXTResource:
+		return strings.Join(b.TXT, "")
+	case *dnsmessage.SRVResource:
+		return fmt.Sprintf("%d %d %d %s", b.Priority, b.Weight, b.Port, trimDot(b.Target))
+	case *dnsmessage.SOAResource:
+		return fmt.Sprintf("%s %s\nserial %d, refresh %d, retry %d, expire %d, minimum %d",
+			trimDot(b.NS), trimDot(b.MBox), b.Serial, b.Refresh, b.Retry, b.Expire, b.MinTTL)
+	case *dnsmessage.UnknownResource:
+		switch b.Type {
+		case dnsTypeCAA:
+			return formatCAA(b.Data)
+		case dnsTypeDS:
+			return formatDS(b.Data)
+		case dnsTypeDNSKEY:
+			return formatDNSKEY(b.Data)
+		}
+		return hex.EncodeToString(b.Data)
+	}
+	return r.Body.GoString()
+}
+
+// formatCAA renders RFC 8659 CAA data as: flags tag "value".
+func formatCAA(d []byte) string {
+	if len(d) < 2 || len(d) < 2+int(d[1]) {
+		return hex.EncodeToString(d)
+	}
+	tag := string(d[2 : 2+int(d[1])])
+	return fmt.Sprintf("%d %s %q", d[0], tag, string(d[2+int(d[1]):]))
+}
+
+// formatDS renders RFC 4034 DS data as: key tag, algorithm, digest type, digest.
+func formatDS(d []byte) string {
+	if len(d) < 4 {
+		return hex.EncodeToString(d)
+	}
+	digest := strings.ToUpper(hex.EncodeToString(d[4:]))
+	return fmt.Sprintf("%d %d %d %s", binary.BigEndian.Uint16(d), d[2], d[3], truncateForDisplay(digest, 24))
+}
+
+// formatDNSKEY renders RFC 4034 DNSKEY data as: flags, protocol, algorithm, role, key tag.
+func formatDNSKEY(d []byte) string {
+	if len(d) < 4 {
+		return hex.EncodeToString(d)
+	}
+	flags := binary.BigEndian.Uint16(d)
+	role := "ZSK"
+	if flags&0x0001 != 0 {
+		role = "KSK"
+	}
+	return fmt.Sprintf("%d %d %d (%s, key tag %d)", flags, d[2], d[3], role, dnsKeyTag(d))
+}
+
+// dnsKeyTag computes the RFC 4034 Appendix B key tag of DNSKEY RDATA.
+func dnsKeyTag(rdata []byte) uint16 {
+	var ac uint32
+	for i, b := range rdata {
+		if i&1 == 1 {
+			ac += uint32(b)
+		} else {
+			ac += uint32(b) << 8
+		}
+	}
+	ac += ac >> 16 & 0xFFFF
+	return uint16(ac & 0xFFFF)
+}
+
+// reverseDNSName returns the in-addr.arpa or ip6.arpa name for ip.
+func reverseDNSName(ip net.IP) string {
+	if v4 := ip.To4(); v4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa", v4[3], v4[2], v4[1], v4[0])
+	}
+	const hexDigits = "0123456789abcdef"
+	var b strings.Builder
+	for i := len(ip) - 1; i >= 0; i-- {
+		b.WriteByte(hexDigits[ip[i]&0xF])
+		b.WriteByte('.')
+		b.WriteByte(hexDigits[ip[i]>>4])
+		b.WriteByte('.')
+	}
+	b.WriteString("ip6.arpa")
+	return b.String()
+}
+
+// formatTTL shows the TTL in seconds followed by a compact form such as "1d2h".
+func formatTTL(ttl uint32) string {
+	units := []struct {
+		secs uint32
+		name string
+	}{{86400, "d"}, {3600, "h"}, {60, "m"}, {1, "s"}}
+	var human strings.Builder
+	rest := ttl
+	for _, u := range units {
+		if n := rest / u.secs; n > 0 {
+			fmt.Fprintf(&human, "%d%s", n, u.name)
+			rest -= n * u.secs
+		}
+	}
+	if ttl == 0 {
+		human.WriteString("0s")
+	}
+	return fmt.Sprintf("%d (%s)", ttl, human.String())
+}
+
+// answersOfType returns the answers of type t owned by name.
+func answersOfType(m *dnsmessage.Message, name string, t dnsmessage.Type) []dnsmessage.Resource {
+	var out []dnsmessage.Resource
+	for _, r := range m.Answers {
+		if r.Header.Type == t && strings.EqualFold(r.Header.Name.String(), dnsFQDN(name)) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+func rcodeError(name string, m *dnsmessage.Message) error {
+	switch m.Header.RCode {
+	case dnsmessage.RCodeSuccess:
+		return nil
+	case dnsmessage.RCodeNameError:
+		return fmt.Errorf("%s: no such domain (NXDOMAIN)", name)
+	}
+	return fmt.Errorf("%s: %s", name, strings.TrimPrefix(m.Header.RCode.String(), "RCode"))
+}
+
+// lookupDNSRecords queries s for the records of domain and returns them in table order:
+// the CNAME chain, addresses with their PTRs, then NS, SOA, MX, TXT, CAA, SRV, DS and DNSKEY.
+// Failed queries are returned in errs, keyed by record type, so one timeout does not read
+// as a missing record.
+func lookupDNSRecords(ctx context.Context, s *DNSServer, domain string) (records []dnsRecord, errs map[string]string, err error) {
+	rec := func(r dnsmessage.Resource) dnsRecord {
+		return dnsRecord{Type: dnsTypeName(r.Header.Type), Name: trimDot(r.Header.Name), Value: formatDNSRecord(r), TTL: r.Header.TTL}
+	}
+	errs = map[string]string{}
+	var errMu sync.Mutex
+	// queryType returns the response for one lookup, or nil after recording the failure
+	// under typ. NXDOMAIN is an answer (no records), not a failure.
+	queryType := func(name string, t dnsmessage.Type, typ string) *dnsmessage.Message {
+		resp, err := s.query(ctx, name, t, false)
+		if err == nil && resp.Header.RCode != dnsmessage.RCodeNameError {
+			err = rcodeError(name, resp)
+		}
+		if err != nil {
+			errMu.Lock()
+			if _, ok := errs[typ]; !ok {
+				errs[typ] = s.annotateErr(err).Error()
+			}
+			errMu.Unlock()
+			return nil
+		}
+		return resp
+	}
+
+	// Follow the CNAME chain through the A answer; the canonical name owns the records.
+	m, err := s.query(ctx, domain, dnsmessage.TypeA, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := rcodeError(domain, m); err != nil {
+		return nil, nil, err
+	}
+	name := domain
+	for i := 0; i < dnsMaxCNAMEChain; i++ {
+		cn := answersOfType(m, name, dnsmessage.TypeCNAME)
+		if len(cn) == 0 {
+			break
+		}
+		records = append(records, rec(cn[0]))
+		name = cn[0].Body.(*dnsmessage.CNAMEResource).CNAME.String()
+	}
+	canonical := strings.TrimSuffix(name, ".")
+
+	types := []dnsmessage.Type{
+		dnsmessage.TypeA, dnsmessage.TypeAAAA, dnsmessage.TypeNS, dnsmessage.TypeSOA,
+		dnsmessage.TypeMX, dnsmessage.TypeTXT, dnsTypeCAA, dnsTypeDS, dnsTypeDNSKEY,
+	}
+	results := make([][]dnsRecord, len(types))
+	srvResults := make([][]dnsRecord, len(commonSRVServices))
+	var wg sync.WaitGroup
+	for i, t := range types {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp := m
+			if t != dnsmessage.TypeA {
+				if resp = queryType(canonical, t, dnsTypeName(t)); resp == nil {
+					return
+				}
+			}
+			for _, r := range answersOfType(resp, canonical, t) {
+				results[i] = append(results[i], rec(r))
+			}
+			if t == dnsmessage.TypeSOA && len(results[i]) == 0 {
+				// A name below the zone apex has no SOA of its own; the zone's SOA comes
+				// back in the authority section, owned (and so labelled) by the zone.
+				for _, r := range resp.Authorities {
+					if r.Header.Type == dnsmessage.TypeSOA {
+						results[i] = append(results[i], rec(r))
+					}
+				}
+			}
+		}()
+	}
+	for i, svc := range commonSRVServices {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// SRV owner names are not aliased by the queried name's CNAME, so the
+			// services are looked up under the name as given.
+			srvName := svc + "." + strings.TrimSuffix(domain, ".")
+			resp := queryType(srvName, dnsmessage.TypeSRV, "SRV")
+			if resp == nil {
+				return
+			}
+			for _, r := range answersOfType(resp, srvName, dnsmessage.TypeSRV) {
+				srvResults[i] = append(srvResults[i], rec(r))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// PTR for each address, placed right after the address records.
+	addrs := append(append([]dnsRecord{}, results[0]...), results[1]...)
+	ptrs := make([][]dnsRecord, len(addrs))
+	for i, a := range addrs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rev := reverseDNSName(net.ParseIP(a.Value))
+			resp := queryType(rev, dnsmessage.TypePTR, "PTR")
+			if resp == nil {
+				return
+			}
+			for _, r := range answersOfType(resp, rev, dnsmessage.TypePTR) {
+				ptrs[i] = append(ptrs[i], rec(r))
+			}
+		}()
+	}
+	wg.Wait()
+
+	records = append(records, addrs...)
+	for _, p := range ptrs {
+		records = append(records, p...)
+	}
+	// results[2:7] is NS..CAA and results[7:] is DS, DNSKEY.
+	for _, r := range results[2:7] {
+		records = append(records, r...)
+	}
+	for _, r := range srvResults {
+		records = append(records, r...)
+	}
+	for _, r := range results[7:] {
+		records = append(records, r...)
+	}
+	return records, errs, nil
+}
+
+// printDNSRecords renders records as one table, followed by the record types whose
+// queries failed. Addresses are annotated with ASN data when enrich is enabled.
+func printDNSRecords(records []dnsRecord, errs map[string]string, enrich *IPEnricher) {
+	rows := make([][]string, 0, len(records))
+	for _, r := range records {
+		value := r.Value
+		if (r.Type == "A" || r.Type == "AAAA") && enrich.Enabled() {
+			if info, ok := enrich.LookupString(r.Value); ok {
+				value += "\n" + info.String()
+			}
+		}
+		rows = append(rows, []string{r.Type, r.Name, value, formatTTL(r.TTL)})
+	}
+	RenderTable([]string{"Type", "Name", "Value", "TTL"}, rows)
+
+	for _, t := range []string{"AAAA", "PTR", "NS", "SOA", "MX", "TXT", "CAA", "SRV", "DS", "DNSKEY"} {
+		if e, ok := errs[t]; ok {
+			fmt.Printf("%s lookup failed: %s\n", t, e)
+		}
+	}
+	var missing []string
+	for _, t := range []string{"CAA", "DS", "DNSKEY"} {
+		if _, failed := errs[t]; failed {
+			continue
+		}
+		found := false
+		for _, r := range records {
+			if r.Type == t {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, t)
+		}
+	}
+	if len(missing) > 0 {
+		fmt.Printf("No %s records\n", strings.Join(missing, "/"))
+	}
+}
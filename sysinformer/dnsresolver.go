@@ -0,0 +1,395 @@
+package sysinformer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DNS transports understood by --resolver.
+const (
+	DNSTransportUDP   = "udp"
+	DNSTransportTCP   = "tcp"
+	DNSTransportTLS   = "tls"   // DNS over TLS, RFC 7858
+	DNSTransportHTTPS = "https" // DNS over HTTPS, RFC 8484
+)
+
+const (
+	DNS_PORT     = "53"
+	DNS_TLS_PORT = "853"
+	dnsMaxUDP    = 4096
+)
+
+// DNSServer is a resolver to send queries to. A nil *DNSServer means the system resolver.
+type DNSServer struct {
+	Spec       string // as given on the command line
+	Transport  string
+	Addr       string // host:port for udp/tcp/tls
+	URL        string // endpoint for https
+	ServerName string // TLS server name for tls/https
+}
+
+// ParseDNSServer accepts "1.1.1.1", "1.1.1.1:53", "tcp://1.1.1.1", "tls://1.1.1.1:853",
+// "tls://dns.google" and "https://cloudflare-dns.com/dns-query".
+func ParseDNSServer(spec string) (*DNSServer, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, errors.New("empty resolver")
+	}
+	s := &DNSServer{Spec: spec, Transport: DNSTransportUDP}
+	rest := spec
+	if i := strings.Index(spec, "://"); i >= 0 {
+		s.Transport, rest = strings.ToLower(spec[:i]), spec[i+3:]
+	}
+
+	switch s.Transport {
+	case DNSTransportHTTPS:
+		u, err := url.Parse(spec)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid DoH URL %q", spec)
+		}
+		if u.Path == "" {
+			u.Path = "/dns-query"
+		}
+		s.URL, s.ServerName = u.String(), u.Hostname()
+		return s, nil
+	case DNSTransportUDP, DNSTransportTCP, DNSTransportTLS:
+	default:
+		return nil, fmt.Errorf("unknown resolver scheme %q (use udp, tcp, tls or https)", s.Transport)
+	}
+
+	port := DNS_PORT
+	if s.Transport == DNSTransportTLS {
+		port = DNS_TLS_PORT
+	}
+	host := strings.TrimSuffix(rest, "/")
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
+	host = strings.Trim(host, "[]")
+	if host == "" {
+		return nil, fmt.Errorf("invalid resolver %q", spec)
+	}
+	s.Addr, s.ServerName = net.JoinHostPort(host, port), host
+	return s, nil
+}
+
+// String names the resolver for table headers.
+func (s *DNSServer) String() string {
+	if s == nil {
+		return "system"
+	}
+	return s.Spec
+}
+
+// annotateErr replaces the server in a *net.DNSError, which the Go resolver fills in
+// from resolv.conf even when a custom Dial sent the query elsewhere.
+func (s *DNSServer) annotateErr(err error) error {
+	var dnsErr *net.DNSError
+	if s != nil && errors.As(err, &dnsErr) {
+		dnsErr.Server = s.String()
+	}
+	return err
+}
+
+// exchange sends one wire-format query and returns the wire-format response.
+func (s *DNSServer) exchange(ctx context.Context, query []byte) ([]byte, error) {
+	switch s.Transport {
+	case DNSTransportHTTPS:
+		return s.exchangeHTTPS(ctx, query)
+	case DNSTransportUDP:
+		resp, err := s.exchangeUDP(ctx, query)
+		// Retry over TCP when the answer was truncated (TC bit).
+		if err == nil && len(resp) > 2 && resp[2]&0x02 != 0 {
+			return s.exchangeStream(ctx, query, false)
+		}
+		return resp, err
+	}
+	return s.exchangeStream(ctx, query, s.Transport == DNSTransportTLS)
+}
+
+func (s *DNSServer) exchangeUDP(ctx context.Context, query []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "udp", s.Addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, dnsMaxUDP)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		// Ignore stray datagrams that don't answer our query ID.
+		if n >= 2 && bytes.Equal(buf[:2], query[:2]) {
+			return buf[:n], nil
+		}
+	}
+}
+
+// exchangeStream uses the two-byte length framing shared by TCP and DoT.
+func (s *DNSServer) exchangeStream(ctx context.Context, query []byte, useTLS bool) ([]byte, error) {
+	var d net.Dialer
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = (&tls.Dialer{NetDialer: &d, Config: &tls.Config{ServerName: s.ServerName}}).DialContext(ctx, "tcp", s.Addr)
+	} else {
+		conn, err = d.DialContext(ctx, "tcp", s.Addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	msg := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(msg, uint16(len(query)))
+	copy(msg[2:], query)
+	if _, err := conn.Write(msg); err != nil {
+		return nil, err
+	}
+	var l [2]byte
+	if _, err := io.ReadFull(conn, l[:]); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, binary.BigEndian.Uint16(l[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+var dohClient = &http.Client{}
+
+func (s *DNSServer) exchangeHTTPS(ctx context.Context, query []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.URL, bytes.NewReader(query))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server returned %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 65535))
+}
+
+// Resolver returns a *net.Resolver that sends every query to s, or the default resolver
+// when s is nil.
+func (s *DNSServer) Resolver() *net.Resolver {
+	if s == nil {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return &exchangeConn{ctx: ctx, server: s}, nil
+		},
+	}
+}
+
+// exchangeConn lets the Go resolver talk to any transport. It is not a PacketConn, so the
+// resolver writes length-prefixed queries and expects length-prefixed responses.
+type exchangeConn struct {
+	ctx    context.Context
+	server *DNSServer
+	mu     sync.Mutex
+	out    bytes.Buffer
+	in     bytes.Buffer
+}
+
+func (c *exchangeConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.out.Write(b)
+	for c.out.Len() >= 2 {
+		n := int(binary.BigEndian.Uint16(c.out.Bytes()))
+		if c.out.Len() < 2+n {
+			break
+		}
+		query := make([]byte, n)
+		copy(query, c.out.Bytes()[2:2+n])
+		c.out.Next(2 + n)
+		resp, err := c.server.exchange(c.ctx, query)
+		if err != nil {
+			return 0, err
+		}
+		binary.Write(&c.in, binary.BigEndian, uint16(len(resp)))
+		c.in.Write(resp)
+	}
+	return len(b), nil
+}
+
+func (c *exchangeConn) Read(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.in.Len() == 0 {
+		return 0, io.EOF
+	}
+	return c.in.Read(b)
+}
+
+func (c *exchangeConn) Close() error                       { return nil }
+func (c *exchangeConn) LocalAddr() net.Addr                { return exchangeAddr{} }
+func (c *exchangeConn) RemoteAddr() net.Addr               { return exchangeAddr{} }
+func (c *exchangeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *exchangeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *exchangeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+type exchangeAddr struct{}
+
+func (exchangeAddr) Network() string { return "dns" }
+func (exchangeAddr) String() string  { return "dns" }
+
+// resolverAnswers holds one resolver's answers, keyed by record type.
+type resolverAnswers struct {
+	Server  *DNSServer
+	Answers map[string][]string
+	Errors  map[string]string
+}
+
+var compareRecordTypes = []string{"A", "AAAA", "CNAME", "MX", "NS", "TXT"}
+
+// lookupForCompare runs the comparison lookups against one resolver.
+func lookupForCompare(ctx context.Context, s *DNSServer, domain string) resolverAnswers {
+	r := s.Resolver()
+	out := resolverAnswers{Server: s, Answers: map[string][]string{}, Errors: map[string]string{}}
+	record := func(typ string, vals []string, err error) {
+		if err != nil {
+			var dnsErr *net.DNSError
+			if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+				return
+			}
+			out.Errors[typ] = s.annotateErr(err).Error()
+			return
+		}
+		sort.Strings(vals)
+		out.Answers[typ] = vals
+	}
+
+	ips, err := r.LookupIP(ctx, "ip4", domain)
+	record("A", ipStrings(ips), err)
+	ips, err = r.LookupIP(ctx, "ip6", domain)
+	record("AAAA", ipStrings(ips), err)
+	cname, err := r.LookupCNAME(ctx, domain)
+	if err == nil && strings.TrimSuffix(cname, ".") == strings.TrimSuffix(domain, ".") {
+		cname = ""
+	}
+	var cnames []string
+	if cname != "" {
+		cnames = []string{strings.TrimSuffix(cname, ".")}
+	}
+	record("CNAME", cnames, err)
+	mx, err := r.LookupMX(ctx, domain)
+	var mxs []string
+	for _, m := range mx {
+		mxs = append(mxs, fmt.Sprintf("%d\u00a0%s", m.Pref, strings.TrimSuffix(m.Host, ".")))
+	}
+	record("MX", mxs, err)
+	ns, err := r.LookupNS(ctx, domain)
+	var nss []string
+	for _, n := range ns {
+		nss = append(nss, strings.TrimSuffix(n.Host, "."))
+	}
+	record("NS", nss, err)
+	txt, err := r.LookupTXT(ctx, domain)
+	record("TXT", txt, err)
+	return out
+}
+
+func ipStrings(ips []net.IP) []string {
+	out := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		out = append(out, ip.String())
+	}
+	return out
+}
+
+// CompareResolvers queries every resolver concurrently and prints one row per record type
+// with a column per resolver. Rows where the resolvers disagree are highlighted.
+func CompareResolvers(domain string, servers []*DNSServer, timeout time.Duration) {
+	fmt.Println("")
+	PrintSectionHeader("DNS RESOLVER COMPARISON")
+
+	results := make([]resolverAnswers, len(servers))
+	var wg sync.WaitGroup
+	for i, s := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			defer cancel()
+			results[i] = lookupForCompare(ctx, s, domain)
+		}()
+	}
+	wg.Wait()
+
+	headers := []string{"Record"}
+	for _, s := range servers {
+		headers = append(headers, s.String())
+	}
+	var rows [][]string
+	differing := 0
+	for _, typ := range compareRecordTypes {
+		cells := make([]string, len(results))
+		seen := map[string]bool{}
+		empty := true
+		for i, r := range results {
+			switch {
+			case r.Errors[typ] != "":
+				cells[i] = "error: " + truncateForDisplay(r.Errors[typ], 40)
+				empty = false
+			case len(r.Answers[typ]) == 0:
+				cells[i] = "-"
+			default:
+				cells[i] = strings.Join(r.Answers[typ], "\n")
+				empty = false
+			}
+			seen[cells[i]] = true
+		}
+		if empty {
+			continue
+		}
+		label := typ
+		if len(seen) > 1 {
+			differing++
+			label = colorCell("\033[93m", typ+" ≠")
+		}
+		rows = append(rows, append([]string{label}, cells...))
+	}
+	if len(rows) == 0 {
+		fmt.Println("No records returned by any resolver")
+		return
+	}
+	RenderTable(headers, rows)
+	if differing > 0 {
+		fmt.Printf("\033[93m%d record type(s) differ between resolvers\033[0m\n", differing)
+	} else {
+		fmt.Println("\033[92mAll resolvers agree\033[0m")
+	}
+}
@@ -0,0 +1,194 @@
+package sysinformer
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestParseDNSServer(t *testing.T) {
+	tests := []struct {
+		spec, transport, addr, url, serverName string
+	}{
+		{"1.1.1.1", DNSTransportUDP, "1.1.1.1:53", "", "1.1.1.1"},
+		{"1.1.1.1:5353", DNSTransportUDP, "1.1.1.1:5353", "", "1.1.1.1"},
+		{"tcp://9.9.9.9", DNSTransportTCP, "9.9.9.9:53", "", "9.9.9.9"},
+		{"tls://dns.google", DNSTransportTLS, "dns.google:853", "", "dns.google"},
+		{"TLS://1.1.1.1:8853/", DNSTransportTLS, "1.1.1.1:8853", "", "1.1.1.1"},
+		{"[2606:4700:4700::1111]:53", DNSTransportUDP, "[2606:4700:4700::1111]:53", "", "2606:4700:4700::1111"},
+		{"2606:4700:4700::1111", DNSTransportUDP, "[2606:4700:4700::1111]:53", "", "2606:4700:4700::1111"},
+		{"https://cloudflare-dns.com", DNSTransportHTTPS, "", "https://cloudflare-dns.com/dns-query", "cloudflare-dns.com"},
+		{"https://dns.google/resolve", DNSTransportHTTPS, "", "https://dns.google/resolve", "dns.google"},
+	}
+	for _, tt := range tests {
+		s, err := ParseDNSServer(tt.spec)
+		if err != nil {
+			t.Errorf("ParseDNSServer(%q): %v", tt.spec, err)
+			continue
+		}
+		if s.Transport != tt.transport || s.Addr != tt.addr || s.URL != tt.url || s.ServerName != tt.serverName {
+			t.Errorf("ParseDNSServer(%q) = %+v", tt.spec, *s)
+		}
+	}
+	for _, spec := range []string{"", "  ", "quic://1.1.1.1", "https://", "tcp://"} {
+		if s, err := ParseDNSServer(spec); err == nil {
+			t.Errorf("ParseDNSServer(%q) = %+v, want an error", spec, *s)
+		}
+	}
+}
+
+// dnsTestAnswer answers query with one A record, marked truncated and without answers
+// when truncate is set.
+func dnsTestAnswer(t *testing.T, query []byte, truncate bool) []byte {
+	t.Helper()
+	var p dnsmessage.Parser
+	h, err := p.Start(query)
+	if err != nil {
+		t.Errorf("server: bad query: %v", err)
+		return nil
+	}
+	q, err := p.Question()
+	if err != nil {
+		t.Errorf("server: bad question: %v", err)
+		return nil
+	}
+	b := dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: h.ID, Response: true, Truncated: truncate, RecursionAvailable: true})
+	b.StartQuestions()
+	b.Question(q)
+	b.StartAnswers()
+	if !truncate && q.Type == dnsmessage.TypeA {
+		b.AResource(dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: 60}, dnsmessage.AResource{A: [4]byte{192, 0, 2, 1}})
+	}
+	resp, err := b.Finish()
+	if err != nil {
+		t.Errorf("server: %v", err)
+	}
+	return resp
+}
+
+func TestExchangeRetriesTruncatedOverTCP(t *testing.T) {
+	// UDP and TCP on the same port, as a real server listens.
+	var udp net.PacketConn
+	var tcp net.Listener
+	for i := 0; i < 10 && tcp == nil; i++ {
+		u, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l, err := net.Listen("tcp", u.LocalAddr().String()); err == nil {
+			udp, tcp = u, l
+		} else {
+			u.Close()
+		}
+	}
+	if tcp == nil {
+		t.Skip("no port free for both UDP and TCP")
+	}
+	defer udp.Close()
+	defer tcp.Close()
+
+	var udpQueries, tcpQueries atomic.Int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			udpQueries.Add(1)
+			udp.WriteTo(dnsTestAnswer(t, buf[:n], true), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return
+			}
+			var l [2]byte
+			if _, err := io.ReadFull(conn, l[:]); err == nil {
+				query := make([]byte, binary.BigEndian.Uint16(l[:]))
+				if _, err := io.ReadFull(conn, query); err == nil {
+					tcpQueries.Add(1)
+					resp := dnsTestAnswer(t, query, false)
+					conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(resp))), resp...))
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	s, err := ParseDNSServer(udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m, err := s.query(ctx, "example.com", dnsmessage.TypeA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Header.Truncated || len(answersOfType(m, "example.com", dnsmessage.TypeA)) != 1 {
+		t.Fatalf("got %+v, want the full answer from the TCP retry", m.Header)
+	}
+	if udpQueries.Load() != 1 || tcpQueries.Load() != 1 {
+		t.Errorf("%d UDP and %d TCP queries, want 1 of each", udpQueries.Load(), tcpQueries.Load())
+	}
+}
+
+func TestExchangeDoH(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fail" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/dns-message" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		query, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/dns-message")
+		w.Write(dnsTestAnswer(t, query, false))
+	}))
+	defer srv.Close()
+	saved := dohClient
+	dohClient = srv.Client()
+	defer func() { dohClient = saved }()
+
+	s, err := ParseDNSServer(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.URL != srv.URL+"/dns-query" {
+		t.Fatalf("URL = %s", s.URL)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	m, err := s.query(ctx, "example.com", dnsmessage.TypeA, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(answersOfType(m, "example.com", dnsmessage.TypeA)) != 1 {
+		t.Fatalf("answers = %v", m.Answers)
+	}
+
+	// The same server through the net.Resolver adapter.
+	addrs, err := s.Resolver().LookupHost(ctx, "example.com")
+	if err != nil || len(addrs) != 1 || addrs[0] != "192.0.2.1" {
+		t.Fatalf("LookupHost = %v, %v", addrs, err)
+	}
+
+	fail := &DNSServer{Transport: DNSTransportHTTPS, URL: srv.URL + "/fail"}
+	if _, err := fail.query(ctx, "example.com", dnsmessage.TypeA, false); err == nil || !strings.Contains(err.Error(), "503") {
+		t.Errorf("query to a failing DoH server: err = %v, want the 503 status", err)
+	}
+}
@@ -0,0 +1,946 @@
+package sysinformer
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsTypeRRSIG dnsmessage.Type = 46
+	dnsTypeNSEC  dnsmessage.Type = 47
+	dnsTypeNSEC3 dnsmessage.Type = 50
+)
+
+// dnssecMaxNSEC3Iterations is the most NSEC3 hash iterations accepted; RFC 9276 lets
+// validators treat higher counts as insecure.
+const dnssecMaxNSEC3Iterations = 500
+
+// DNSSEC outcomes, as defined in RFC 4033 section 5.
+const (
+	DNSSECSecure        = "secure"
+	DNSSECInsecure      = "insecure"
+	DNSSECBogus         = "bogus"
+	DNSSECIndeterminate = "indeterminate"
+)
+
+// rootTrustAnchors are the IANA root zone KSKs (KSK-2017 and KSK-2024) as DS records.
+var rootTrustAnchors = []string{
+	". IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+type dsRecord struct {
+	KeyTag     uint16
+	Algorithm  uint8
+	DigestType uint8
+	Digest     []byte
+}
+
+type dnskey struct {
+	Flags     uint16
+	Algorithm uint8
+	PublicKey []byte
+	RData     []byte
+	Tag       uint16
+}
+
+type rrsig struct {
+	TypeCovered dnsmessage.Type
+	Algorithm   uint8
+	Labels      uint8
+	OrigTTL     uint32
+	Expiration  time.Time
+	Inception   time.Time
+	KeyTag      uint16
+	Signer      string
+	Signature   []byte
+	header      []byte // RDATA up to the signer name, as signed
+}
+
+// dnssecStep is one row of the validation report.
+type dnssecStep struct {
+	Zone    string
+	Check   string
+	Verdict string
+	Detail  string
+}
+
+func dnssecAlgorithmName(alg uint8) string {
+	switch alg {
+	case 5:
+		return "RSASHA1"
+	case 7:
+		return "RSASHA1-NSEC3-SHA1"
+	case 8:
+		return "RSASHA256"
+	case 10:
+		return "RSASHA512"
+	case 13:
+		return "ECDSAP256SHA256"
+	case 14:
+		return "ECDSAP384SHA384"
+	case 15:
+		return "ED25519"
+	}
+	return "algorithm " + strconv.Itoa(int(alg))
+}
+
+// LoadTrustAnchors parses DS records for the root zone from spec, which is a file path or
+// inline records separated by ';'. An empty spec returns the built-in IANA anchors. Lines
+// may be in zone-file form (". IN DS 20326 8 2 E06D...") or just "20326 8 2 E06D...".
+func LoadTrustAnchors(spec string) ([]dsRecord, error) {
+	lines := rootTrustAnchors
+	if spec != "" {
+		if data, err := os.ReadFile(spec); err == nil {
+			lines = strings.Split(string(data), "\n")
+		} else {
+			lines = strings.Split(spec, ";")
+		}
+	}
+	var out []dsRecord
+	for _, line := range lines {
+		if i := strings.IndexAny(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		for i, f := range fields {
+			if strings.EqualFold(f, "DS") {
+				fields = fields[i+1:]
+				break
+			}
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid DS record %q", strings.TrimSpace(line))
+		}
+		tag, err1 := strconv.ParseUint(fields[0], 10, 16)
+		alg, err2 := strconv.ParseUint(fields[1], 10, 8)
+		dt, err3 := strconv.ParseUint(fields[2], 10, 8)
+		digest, err4 := hex.DecodeString(strings.Join(fields[3:], ""))
+		if err := errors.Join(err1, err2, err3, err4); err != nil {
+			return nil, fmt.Errorf("invalid DS record %q: %v", strings.TrimSpace(line), err)
+		}
+		out = append(out, dsRecord{KeyTag: uint16(tag), Algorithm: uint8(alg), DigestType: uint8(dt), Digest: digest})
+	}
+	if len(out) == 0 {
+		return nil, errors.New("no trust anchors found")
+	}
+	return out, nil
+}
+
+// canonicalNameWire encodes name in uncompressed, lower-case wire format (RFC 4034 6.2).
+func canonicalNameWire(name string) []byte {
+	var b []byte
+	for _, label := range strings.Split(strings.TrimSuffix(strings.ToLower(name), "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+func readNameWire(d []byte) (string, int, error) {
+	var labels []string
+	i := 0
+	for {
+		if i >= len(d) {
+			return "", 0, errors.New("truncated name")
+		}
+		l := int(d[i])
+		i++
+		if l == 0 {
+			break
+		}
+		if l&0xC0 != 0 || i+l > len(d) {
+			return "", 0, errors.New("invalid name")
+		}
+		labels = append(labels, string(d[i:i+l]))
+		i += l
+	}
+	return strings.Join(labels, ".") + ".", i, nil
+}
+
+// canonicalRData returns the RDATA of r in canonical form, with embedded names
+// uncompressed and lower-cased.
+func canonicalRData(r dnsmessage.Resource) ([]byte, error) {
+	u16 := func(b []byte, v uint16) []byte { return binary.BigEndian.AppendUint16(b, v) }
+	u32 := func(b []byte, v uint32) []byte { return binary.BigEndian.AppendUint32(b, v) }
+	switch b := r.Body.(type) {
+	case *dnsmessage.AResource:
+		return b.A[:], nil
+	case *dnsmessage.AAAAResource:
+		return b.AAAA[:], nil
+	case *dnsmessage.NSResource:
+		return canonicalNameWire(b.NS.String()), nil
+	case *dnsmessage.CNAMEResource:
+		return canonicalNameWire(b.CNAME.String()), nil
+	case *dnsmessage.PTRResource:
+		return canonicalNameWire(b.PTR.String()), nil
+	case *dnsmessage.MXResource:
+		return append(u16(nil, b.Pref), canonicalNameWire(b.MX.String())...), nil
+	case *dnsmessage.SRVResource:
+		d := u16(u16(u16(nil, b.Priority), b.Weight), b.Port)
+		return append(d, canonicalNameWire(b.Target.String())...), nil
+	case *dnsmessage.SOAResource:
+		d := append(canonicalNameWire(b.NS.String()), canonicalNameWire(b.MBox.String())...)
+		for _, v := range []uint32{b.Serial, b.Refresh, b.Retry, b.Expire, b.MinTTL} {
+			d = u32(d, v)
+		}
+		return d, nil
+	case *dnsmessage.TXTResource:
+		var d []byte
+		for _, t := range b.TXT {
+			d = append(d, byte(len(t)))
+			d = append(d, t...)
+		}
+		return d, nil
+	case *dnsmessage.UnknownResource:
+		return b.Data, nil
+	}
+	return nil, fmt.Errorf("cannot canonicalise %s records", dnsTypeName(r.Header.Type))
+}
+
+func parseRRSIG(d []byte) (rrsig, error) {
+	if len(d) < 19 {
+		return rrsig{}, errors.New("short RRSIG")
+	}
+	signer, n, err := readNameWire(d[18:])
+	if err != nil {
+		return rrsig{}, err
+	}
+	return rrsig{
+		TypeCovered: dnsmessage.Type(binary.BigEndian.Uint16(d[0:])),
+		Algorithm:   d[2],
+		Labels:      d[3],
+		OrigTTL:     binary.BigEndian.Uint32(d[4:]),
+		Expiration:  time.Unix(int64(binary.BigEndian.Uint32(d[8:])), 0),
+		Inception:   time.Unix(int64(binary.BigEndian.Uint32(d[12:])), 0),
+		KeyTag:      binary.BigEndian.Uint16(d[16:]),
+		Signer:      signer,
+		Signature:   d[18+n:],
+		header:      d[:18],
+	}, nil
+}
+
+func parseDNSKEY(d []byte) (dnskey, error) {
+	if len(d) < 4 {
+		return dnskey{}, errors.New("short DNSKEY")
+	}
+	return dnskey{
+		Flags:     binary.BigEndian.Uint16(d),
+		Algorithm: d[3],
+		PublicKey: d[4:],
+		RData:     d,
+		Tag:       dnsKeyTag(d),
+	}, nil
+}
+
+func parseDS(d []byte) (dsRecord, error) {
+	if len(d) < 5 {
+		return dsRecord{}, errors.New("short DS")
+	}
+	return dsRecord{KeyTag: binary.BigEndian.Uint16(d), Algorithm: d[2], DigestType: d[3], Digest: d[4:]}, nil
+}
+
+// dsDigest computes the DS digest of key owned by zone (RFC 4034 5.1.4).
+func dsDigest(zone string, key dnskey, digestType uint8) ([]byte, error) {
+	data := append(canonicalNameWire(zone), key.RData...)
+	switch digestType {
+	case 1:
+		sum := sha1.Sum(data)
+		return sum[:], nil
+	case 2:
+		sum := sha256.Sum256(data)
+		return sum[:], nil
+	case 4:
+		sum := sha512.Sum384(data)
+		return sum[:], nil
+	}
+	return nil, fmt.Errorf("unsupported digest type %d", digestType)
+}
+
+// signedData builds the data an RRSIG covers: its own RDATA minus the signature followed
+// by the RRset in canonical form and order (RFC 4034 3.1.8.1 and 6.3).
+func signedData(sig rrsig, owner string, class dnsmessage.Class, rrs []dnsmessage.Resource) ([]byte, error) {
+	data := append(append([]byte{}, sig.header...), canonicalNameWire(sig.Signer)...)
+
+	// Wildcard expansion: the signature covers "*." plus the rightmost Labels labels.
+	labels := strings.Split(strings.TrimSuffix(strings.ToLower(owner), "."), ".")
+	if owner == "." {
+		labels = nil
+	}
+	if int(sig.Labels) < len(labels) {
+		labels = append([]string{"*"}, labels[len(labels)-int(sig.Labels):]...)
+	}
+	ownerWire := canonicalNameWire(strings.Join(labels, "."))
+
+	rdatas := make([][]byte, 0, len(rrs))
+	for _, r := range rrs {
+		rd, err := canonicalRData(r)
+		if err != nil {
+			return nil, err
+		}
+		rdatas = append(rdatas, rd)
+	}
+	sort.Slice(rdatas, func(i, j int) bool { return bytes.Compare(rdatas[i], rdatas[j]) < 0 })
+
+	var prev []byte
+	for i, rd := range rdatas {
+		if i > 0 && bytes.Equal(rd, prev) {
+			continue
+		}
+		prev = rd
+		data = append(data, ownerWire...)
+		data = binary.BigEndian.AppendUint16(data, uint16(sig.TypeCovered))
+		data = binary.BigEndian.AppendUint16(data, uint16(class))
+		data = binary.BigEndian.AppendUint32(data, sig.OrigTTL)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(rd)))
+		data = append(data, rd...)
+	}
+	return data, nil
+}
+
+// verifySignature checks sig over data with key.
+func verifySignature(key dnskey, sig []byte, data []byte) error {
+	switch key.Algorithm {
+	case 5, 7, 8, 10:
+		pub, err := rsaPublicKey(key.PublicKey)
+		if err != nil {
+			return err
+		}
+		h := map[uint8]crypto.Hash{5: crypto.SHA1, 7: crypto.SHA1, 8: crypto.SHA256, 10: crypto.SHA512}[key.Algorithm]
+		hh := h.New()
+		hh.Write(data)
+		return rsa.VerifyPKCS1v15(pub, h, hh.Sum(nil), sig)
+	case 13, 14:
+		curve, h, size := elliptic.P256(), crypto.SHA256, 32
+		if key.Algorithm == 14 {
+			curve, h, size = elliptic.P384(), crypto.SHA384, 48
+		}
+		if len(key.PublicKey) != 2*size || len(sig) != 2*size {
+			return errors.New("malformed ECDSA key or signature")
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(key.PublicKey[:size]),
+			Y:     new(big.Int).SetBytes(key.PublicKey[size:]),
+		}
+		hh := h.New()
+		hh.Write(data)
+		if !ecdsa.Verify(pub, hh.Sum(nil), new(big.Int).SetBytes(sig[:size]), new(big.Int).SetBytes(sig[size:])) {
+			return errors.New("signature does not verify")
+		}
+		return nil
+	case 15:
+		if len(key.PublicKey) != ed25519.PublicKeySize {
+			return errors.New("malformed Ed25519 key")
+		}
+		if !ed25519.Verify(ed25519.PublicKey(key.PublicKey), data, sig) {
+			return errors.New("signature does not verify")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %s", dnssecAlgorithmName(key.Algorithm))
+}
+
+// rsaPublicKey decodes an RFC 3110 RSA public key.
+func rsaPublicKey(k []byte) (*rsa.PublicKey, error) {
+	if len(k) < 3 {
+		return nil, errors.New("malformed RSA key")
+	}
+	elen, off := int(k[0]), 1
+	if elen == 0 {
+		elen, off = int(binary.BigEndian.Uint16(k[1:])), 3
+	}
+	if elen > 8 || off+elen >= len(k) {
+		return nil, errors.New("malformed RSA key")
+	}
+	e := new(big.Int).SetBytes(k[off : off+elen])
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(k[off+elen:]), E: int(e.Int64())}, nil
+}
+
+// verifyRRSet returns the signature that validates rrs with one of keys, or the reason
+// none does.
+func verifyRRSet(owner string, rrs []dnsmessage.Resource, sigs []rrsig, keys []dnskey, now time.Time) (*rrsig, error) {
+	if len(rrs) == 0 {
+		return nil, errors.New("empty RRset")
+	}
+	if len(sigs) == 0 {
+		return nil, errors.New("no RRSIG: the records are not signed")
+	}
+	var reasons []string
+	for i := range sigs {
+		sig := &sigs[i]
+		switch {
+		case now.After(sig.Expiration):
+			reasons = append(reasons, fmt.Sprintf("signature by key tag %d expired on %s", sig.KeyTag, sig.Expiration.UTC().Format("2006-01-02 15:04")))
+			continue
+		case now.Before(sig.Inception):
+			reasons = append(reasons, fmt.Sprintf("signature by key tag %d not valid until %s", sig.KeyTag, sig.Inception.UTC().Format("2006-01-02 15:04")))
+			continue
+		}
+		var candidates []dnskey
+		algs := map[uint8]bool{}
+		for _, k := range keys {
+			algs[k.Algorithm] = true
+			if k.Tag == sig.KeyTag && k.Algorithm == sig.Algorithm && k.Flags&0x0100 != 0 && k.Flags&0x0080 == 0 {
+				candidates = append(candidates, k)
+			}
+		}
+		if len(candidates) == 0 {
+			if !algs[sig.Algorithm] {
+				reasons = append(reasons, fmt.Sprintf("algorithm mismatch: signed with %s but no DNSKEY uses it", dnssecAlgorithmName(sig.Algorithm)))
+			} else {
+				reasons = append(reasons, fmt.Sprintf("no DNSKEY with key tag %d", sig.KeyTag))
+			}
+			continue
+		}
+		data, err := signedData(*sig, owner, dnsmessage.ClassINET, rrs)
+		if err != nil {
+			reasons = append(reasons, err.Error())
+			continue
+		}
+		for _, k := range candidates {
+			if err := verifySignature(k, sig.Signature, data); err != nil {
+				reasons = append(reasons, fmt.Sprintf("key tag %d: %v", k.Tag, err))
+				continue
+			}
+			return sig, nil
+		}
+	}
+	return nil, errors.New(strings.Join(reasons, "; "))
+}
+
+// matchDS returns the keys in zone that a DS record vouches for.
+func matchDS(zone string, ds []dsRecord, keys []dnskey) ([]dnskey, error) {
+	keyAlgs := map[uint8]bool{}
+	for _, k := range keys {
+		keyAlgs[k.Algorithm] = true
+	}
+	var matched []dnskey
+	var reasons []string
+	for _, d := range ds {
+		if !keyAlgs[d.Algorithm] {
+			reasons = append(reasons, fmt.Sprintf("algorithm mismatch: DS %d uses %s but no DNSKEY does", d.KeyTag, dnssecAlgorithmName(d.Algorithm)))
+			continue
+		}
+		found := false
+		for _, k := range keys {
+			if k.Tag != d.KeyTag || k.Algorithm != d.Algorithm {
+				continue
+			}
+			found = true
+			digest, err := dsDigest(zone, k, d.DigestType)
+			if err != nil {
+				reasons = append(reasons, err.Error())
+				continue
+			}
+			if bytes.Equal(digest, d.Digest) {
+				matched = append(matched, k)
+			} else {
+				reasons = append(reasons, fmt.Sprintf("DS %d digest does not match DNSKEY", d.KeyTag))
+			}
+		}
+		if !found {
+			reasons = append(reasons, fmt.Sprintf("no DNSKEY with key tag %d", d.KeyTag))
+		}
+	}
+	if len(matched) == 0 {
+		return nil, errors.New(strings.Join(reasons, "; "))
+	}
+	return matched, nil
+}
+
+// dnssecWalker walks the chain of trust through one resolver.
+type dnssecWalker struct {
+	ctx    context.Context
+	server *DNSServer
+	now    time.Time
+	steps  []dnssecStep
+}
+
+func (w *dnssecWalker) add(zone, check, verdict, format string, args ...interface{}) {
+	w.steps = append(w.steps, dnssecStep{Zone: zone, Check: check, Verdict: verdict, Detail: fmt.Sprintf(format, args...)})
+}
+
+// fetch returns the RRset of type t at name and the RRSIGs covering it.
+func (w *dnssecWalker) fetch(name string, t dnsmessage.Type) ([]dnsmessage.Resource, []rrsig, error) {
+	m, err := w.server.query(w.ctx, name, t, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := rcodeError(name, m); err != nil {
+		return nil, nil, err
+	}
+	rrs := answersOfType(m, name, t)
+	var sigs []rrsig
+	for _, r := range answersOfType(m, name, dnsTypeRRSIG) {
+		u, ok := r.Body.(*dnsmessage.UnknownResource)
+		if !ok {
+			continue
+		}
+		if sig, err := parseRRSIG(u.Data); err == nil && sig.TypeCovered == t {
+			sigs = append(sigs, sig)
+		}
+	}
+	return rrs, sigs, nil
+}
+
+// zoneApexes returns the zone cuts between the root and domain, e.g. "com." and
+// "example.com." for www.example.com.
+func (w *dnssecWalker) zoneApexes(domain string) []string {
+	labels := strings.Split(strings.TrimSuffix(domain, "."), ".")
+	var zones []string
+	for i := len(labels) - 1; i >= 0; i-- {
+		name := strings.Join(labels[i:], ".") + "."
+		if soa, _, err := w.fetch(name, dnsmessage.TypeSOA); err == nil && len(soa) > 0 {
+			zones = append(zones, name)
+		}
+	}
+	return zones
+}
+
+func unknownData(rrs []dnsmessage.Resource) [][]byte {
+	out := make([][]byte, 0, len(rrs))
+	for _, r := range rrs {
+		if u, ok := r.Body.(*dnsmessage.UnknownResource); ok {
+			out = append(out, u.Data)
+		}
+	}
+	return out
+}
+
+func zoneLabel(z string) string {
+	if z == "." {
+		return "."
+	}
+	return strings.TrimSuffix(z, ".")
+}
+
+func sigSummary(sig *rrsig) string {
+	return fmt.Sprintf("key tag %d (%s), expires %s", sig.KeyTag, dnssecAlgorithmName(sig.Algorithm), sig.Expiration.UTC().Format("2006-01-02"))
+}
+
+// nsecRecord is a parsed NSEC record (RFC 4034 4).
+type nsecRecord struct {
+	Owner string
+	Next  string
+	Types []byte // type bitmap
+}
+
+// nsec3Record is a parsed NSEC3 record (RFC 5155 3).
+type nsec3Record struct {
+	Hash       []byte // decoded from the owner's first label
+	Flags      uint8
+	Iterations uint16
+	Salt       []byte
+	Next       []byte
+	Types      []byte
+}
+
+func parseNSEC(owner string, d []byte) (nsecRecord, error) {
+	next, n, err := readNameWire(d)
+	if err != nil {
+		return nsecRecord{}, err
+	}
+	return nsecRecord{Owner: strings.ToLower(owner), Next: strings.ToLower(next), Types: d[n:]}, nil
+}
+
+var nsec3Encoding = base32.HexEncoding.WithPadding(base32.NoPadding)
+
+func parseNSEC3(owner string, d []byte) (nsec3Record, error) {
+	label, _, _ := strings.Cut(owner, ".")
+	hash, err := nsec3Encoding.DecodeString(strings.ToUpper(label))
+	if err != nil {
+		return nsec3Record{}, fmt.Errorf("NSEC3 owner %s is not a hash", owner)
+	}
+	if len(d) < 5 || d[0] != 1 {
+		return nsec3Record{}, errors.New("short NSEC3 or unknown hash algorithm")
+	}
+	r := nsec3Record{Hash: hash, Flags: d[1], Iterations: binary.BigEndian.Uint16(d[2:])}
+	saltLen := int(d[4])
+	if 5+saltLen >= len(d) {
+		return nsec3Record{}, errors.New("short NSEC3")
+	}
+	r.Salt = d[5 : 5+saltLen]
+	i := 5 + saltLen
+	hashLen := int(d[i])
+	if i+1+hashLen > len(d) {
+		return nsec3Record{}, errors.New("short NSEC3")
+	}
+	r.Next = d[i+1 : i+1+hashLen]
+	r.Types = d[i+1+hashLen:]
+	return r, nil
+}
+
+// typeInBitmap reports whether t is listed in an NSEC or NSEC3 type bitmap (RFC 4034 4.1.2).
+func typeInBitmap(bitmap []byte, t dnsmessage.Type) bool {
+	for len(bitmap) >= 2 {
+		window, n := bitmap[0], int(bitmap[1])
+		if n == 0 || n > 32 || 2+n > len(bitmap) {
+			return false
+		}
+		if uint16(window) == uint16(t)>>8 {
+			i := int(uint16(t)&0xff) / 8
+			return i < n && bitmap[2+i]&(0x80>>(uint16(t)%8)) != 0
+		}
+		bitmap = bitmap[2+n:]
+	}
+	return false
+}
+
+// nsec3Hash hashes name as NSEC3 owner names are hashed (RFC 5155 5).
+func nsec3Hash(name string, salt []byte, iterations uint16) []byte {
+	h := sha1.Sum(append(canonicalNameWire(name), salt...))
+	for i := 0; i < int(iterations); i++ {
+		h = sha1.Sum(append(h[:], salt...))
+	}
+	return h[:]
+}
+
+// covers reports whether hash falls between the record's owner and next hashes, wrapping
+// around at the end of the chain.
+func (r nsec3Record) covers(hash []byte) bool {
+	if bytes.Compare(r.Hash, r.Next) < 0 {
+		return bytes.Compare(r.Hash, hash) < 0 && bytes.Compare(hash, r.Next) < 0
+	}
+	return bytes.Compare(r.Hash, hash) < 0 || bytes.Compare(hash, r.Next) < 0
+}
+
+// proveNoData checks that the denial records prove name has no t records (and no CNAME in
+// their place): an NSEC or NSEC3 at name whose bitmap lacks the type, or, for DS only, an
+// NSEC3 opt-out span covering an unsigned delegation (RFC 5155 8.6). The records must
+// already be validated. It returns a description of the proof.
+func proveNoData(name, zone string, t dnsmessage.Type, nsecs []nsecRecord, nsec3s []nsec3Record) (string, error) {
+	name, zone = dnsFQDN(strings.ToLower(name)), dnsFQDN(strings.ToLower(zone))
+	typ := dnsTypeName(t)
+	lacks := func(types []byte) error {
+		for _, bad := range []dnsmessage.Type{t, dnsmessage.TypeCNAME} {
+			if typeInBitmap(types, bad) {
+				return fmt.Errorf("the denial record lists %s at %s", dnsTypeName(bad), zoneLabel(name))
+			}
+		}
+		return nil
+	}
+	for _, n := range nsecs {
+		if n.Owner == name {
+			if err := lacks(n.Types); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("NSEC proves no %s", typ), nil
+		}
+	}
+	if len(nsec3s) == 0 {
+		if len(nsecs) > 0 {
+			return "", fmt.Errorf("no NSEC record matches %s", zoneLabel(name))
+		}
+		return "", errors.New("the response has no NSEC or NSEC3 records")
+	}
+
+	params := nsec3s[0]
+	if params.Iterations > dnssecMaxNSEC3Iterations {
+		return "", fmt.Errorf("NSEC3 uses %d iterations; more than %d are not validated", params.Iterations, dnssecMaxNSEC3Iterations)
+	}
+	hash := func(n string) []byte { return nsec3Hash(n, params.Salt, params.Iterations) }
+	matching := func(h []byte) *nsec3Record {
+		for i := range nsec3s {
+			if bytes.Equal(nsec3s[i].Hash, h) {
+				return &nsec3s[i]
+			}
+		}
+		return nil
+	}
+	if m := matching(hash(name)); m != nil {
+		if err := lacks(m.Types); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NSEC3 proves no %s", typ), nil
+	}
+	if t != dnsTypeDS {
+		return "", fmt.Errorf("no NSEC3 record matches %s", zoneLabel(name))
+	}
+
+	// Opt-out: the closest existing ancestor has a matching NSEC3, and the name one label
+	// below it toward name falls in a span flagged opt-out.
+	labels := strings.Split(strings.TrimSuffix(name, "."), ".")
+	for i := 1; i < len(labels); i++ {
+		encloser := strings.Join(labels[i:], ".") + "."
+		if !strings.HasSuffix(encloser, zone) && zone != "." {
+			break
+		}
+		if matching(hash(encloser)) == nil {
+			continue
+		}
+		nextCloser := strings.Join(labels[i-1:], ".") + "."
+		h := hash(nextCloser)
+		for _, r := range nsec3s {
+			if r.covers(h) {
+				if r.Flags&1 == 0 {
+					return "", fmt.Errorf("NSEC3 denies that %s exists without opt-out", zoneLabel(nextCloser))
+				}
+				return fmt.Sprintf("NSEC3 opt-out span covers %s", zoneLabel(nextCloser)), nil
+			}
+		}
+		return "", fmt.Errorf("no NSEC3 record covers %s", zoneLabel(nextCloser))
+	}
+	return "", fmt.Errorf("no NSEC3 closest encloser for %s", zoneLabel(name))
+}
+
+// denyNoData queries name for t and checks the NSEC/NSEC3 records in the response, signed
+// with keys of zone, for proof that no such records exist. The status is DNSSECSecure
+// when the absence is proven, DNSSECBogus when a denial record does not validate and
+// DNSSECIndeterminate when the response does not prove it.
+func (w *dnssecWalker) denyNoData(name, zone string, t dnsmessage.Type, keys []dnskey) (string, string, error) {
+	m, err := w.server.query(w.ctx, name, t, true)
+	if err != nil {
+		return "", DNSSECIndeterminate, err
+	}
+	if err := rcodeError(name, m); err != nil {
+		return "", DNSSECIndeterminate, err
+	}
+
+	// Group the authority section into RRsets by owner and type, with their signatures.
+	type rrsetKey struct {
+		owner string
+		typ   dnsmessage.Type
+	}
+	sets := map[rrsetKey][]dnsmessage.Resource{}
+	sigs := map[rrsetKey][]rrsig{}
+	var order []rrsetKey
+	for _, r := range m.Authorities {
+		owner := strings.ToLower(r.Header.Name.String())
+		switch r.Header.Type {
+		case dnsTypeNSEC, dnsTypeNSEC3:
+			k := rrsetKey{owner, r.Header.Type}
+			if _, ok := sets[k]; !ok {
+				order = append(order, k)
+			}
+			sets[k] = append(sets[k], r)
+		case dnsTypeRRSIG:
+			if u, ok := r.Body.(*dnsmessage.UnknownResource); ok {
+				if sig, err := parseRRSIG(u.Data); err == nil {
+					k := rrsetKey{owner, sig.TypeCovered}
+					sigs[k] = append(sigs[k], sig)
+				}
+			}
+		}
+	}
+	var nsecs []nsecRecord
+	var nsec3s []nsec3Record
+	for _, k := range order {
+		if !strings.HasSuffix(k.owner, dnsFQDN(strings.ToLower(zone))) && zone != "." {
+			continue
+		}
+		if _, err := verifyRRSet(k.owner, sets[k], sigs[k], keys, w.now); err != nil {
+			return "", DNSSECBogus, fmt.Errorf("%s %s: %v", dnsTypeName(k.typ), zoneLabel(k.owner), err)
+		}
+		for _, d := range unknownData(sets[k]) {
+			if k.typ == dnsTypeNSEC {
+				if rec, err := parseNSEC(k.owner, d); err == nil {
+					nsecs = append(nsecs, rec)
+				}
+			} else if rec, err := parseNSEC3(k.owner, d); err == nil {
+				nsec3s = append(nsec3s, rec)
+			}
+		}
+	}
+	proof, err := proveNoData(name, zone, t, nsecs, nsec3s)
+	if err != nil {
+		return "", DNSSECIndeterminate, err
+	}
+	return proof, DNSSECSecure, nil
+}
+
+// validate walks from the root to domain and returns the overall status and, when the
+// chain is not secure, the reason.
+func (w *dnssecWalker) validate(domain string, anchors []dsRecord) (string, string) {
+	domain = dnsFQDN(strings.ToLower(domain))
+	zones := append([]string{"."}, w.zoneApexes(domain)...)
+
+	var keys []dnskey
+	for i, zone := range zones {
+		z := zoneLabel(zone)
+		var ds []dsRecord
+		if i == 0 {
+			ds = anchors
+		} else {
+			rrs, sigs, err := w.fetch(zone, dnsTypeDS)
+			if err != nil {
+				w.add(z, "DS", VerdictFail, "%v", err)
+				return DNSSECIndeterminate, err.Error()
+			}
+			if len(rrs) == 0 {
+				// An unsigned delegation is only insecure when the parent proves it.
+				proof, status, err := w.denyNoData(zone, zones[i-1], dnsTypeDS, keys)
+				if status != DNSSECSecure {
+					w.add(z, "DS", denialVerdict(status), "no DS, and its absence is not proven: %v", err)
+					return status, fmt.Sprintf("%s has no DS record in %s, but the absence is unproven: %v", z, zoneLabel(zones[i-1]), err)
+				}
+				reason := fmt.Sprintf("missing DS: %s has no DS record in %s, so the delegation is unsigned", z, zoneLabel(zones[i-1]))
+				w.add(z, "DS", VerdictWarn, "no DS in parent zone (%s)", proof)
+				return DNSSECInsecure, reason
+			}
+			sig, err := verifyRRSet(zone, rrs, sigs, keys, w.now)
+			if err != nil {
+				w.add(z, "DS RRSIG", VerdictFail, "%v", err)
+				return DNSSECBogus, fmt.Sprintf("DS for %s: %v", z, err)
+			}
+			for _, d := range unknownData(rrs) {
+				if rec, err := parseDS(d); err == nil {
+					ds = append(ds, rec)
+				}
+			}
+			w.add(z, "DS RRSIG", VerdictPass, "%d DS, signed by %s", len(ds), sigSummary(sig))
+		}
+
+		rrs, sigs, err := w.fetch(zone, dnsTypeDNSKEY)
+		if err != nil {
+			w.add(z, "DNSKEY", VerdictFail, "%v", err)
+			return DNSSECIndeterminate, err.Error()
+		}
+		keys = keys[:0:0]
+		for _, d := range unknownData(rrs) {
+			if k, err := parseDNSKEY(d); err == nil {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			w.add(z, "DNSKEY", VerdictFail, "zone publishes no DNSKEY")
+			return DNSSECBogus, fmt.Sprintf("%s has a DS record but publishes no DNSKEY", z)
+		}
+		sep, err := matchDS(zone, ds, keys)
+		if err != nil {
+			check := "DNSKEY matches DS"
+			if i == 0 {
+				check = "DNSKEY matches trust anchor"
+			}
+			w.add(z, check, VerdictFail, "%v", err)
+			return DNSSECBogus, fmt.Sprintf("%s: %v", z, err)
+		}
+		tags := make([]string, 0, len(sep))
+		for _, k := range sep {
+			tags = append(tags, fmt.Sprintf("%d (%s)", k.Tag, dnssecAlgorithmName(k.Algorithm)))
+		}
+		if i == 0 {
+			w.add(z, "DNSKEY matches trust anchor", VerdictPass, "key tag %s", strings.Join(tags, ", "))
+		} else {
+			w.add(z, "DNSKEY matches DS", VerdictPass, "key tag %s", strings.Join(tags, ", "))
+		}
+
+		sig, err := verifyRRSet(zone, rrs, sigs, sep, w.now)
+		if err != nil {
+			w.add(z, "DNSKEY RRSIG", VerdictFail, "%v", err)
+			return DNSSECBogus, fmt.Sprintf("DNSKEY set of %s: %v", z, err)
+		}
+		w.add(z, "DNSKEY RRSIG", VerdictPass, "%d DNSKEY, signed by %s", len(keys), sigSummary(sig))
+	}
+
+	// Finally the answer itself: the address records, or the CNAME in their place.
+	zone := zoneLabel(zones[len(zones)-1])
+	for _, t := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		m, err := w.server.query(w.ctx, domain, t, true)
+		if err != nil {
+			w.add(zone, dnsTypeName(t)+" RRSIG", VerdictFail, "%v", err)
+			return DNSSECIndeterminate, err.Error()
+		}
+		answerType := t
+		rrs := answersOfType(m, domain, t)
+		if cn := answersOfType(m, domain, dnsmessage.TypeCNAME); len(cn) > 0 {
+			answerType, rrs = dnsmessage.TypeCNAME, cn
+		}
+		if len(rrs) == 0 {
+			continue
+		}
+		_, sigs, _ := w.fetch(domain, answerType)
+		check := fmt.Sprintf("%s %s RRSIG", strings.TrimSuffix(domain, "."), dnsTypeName(answerType))
+		sig, err := verifyRRSet(domain, rrs, sigs, keys, w.now)
+		if err != nil {
+			w.add(zone, check, VerdictFail, "%v", err)
+			return DNSSECBogus, fmt.Sprintf("%s %s: %v", strings.TrimSuffix(domain, "."), dnsTypeName(answerType), err)
+		}
+		w.add(zone, check, VerdictPass, "%d %s, signed by %s", len(rrs), dnsTypeName(answerType), sigSummary(sig))
+		return DNSSECSecure, ""
+	}
+	// No address records: secure only if their absence is proven.
+	var proofs []string
+	for _, t := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		proof, status, err := w.denyNoData(domain, zones[len(zones)-1], t, keys)
+		if status != DNSSECSecure {
+			w.add(zone, "No "+dnsTypeName(t), denialVerdict(status), "absence not proven: %v", err)
+			return status, fmt.Sprintf("%s has no %s record, but the absence is unproven: %v", strings.TrimSuffix(domain, "."), dnsTypeName(t), err)
+		}
+		proofs = append(proofs, proof)
+	}
+	w.add(zone, "Answer", VerdictPass, "no A/AAAA records; %s", strings.Join(proofs, ", "))
+	return DNSSECSecure, ""
+}
+
+func denialVerdict(status string) string {
+	if status == DNSSECBogus {
+		return VerdictFail
+	}
+	return VerdictWarn
+}
+
+// CheckDNSSEC validates the chain of trust from the root to domain and prints each step.
+func CheckDNSSEC(domain string, timeout time.Duration, server *DNSServer, trustAnchor string) {
+	fmt.Println("")
+	PrintSectionHeader("DNSSEC")
+
+	anchors, err := LoadTrustAnchors(trustAnchor)
+	if err != nil {
+		fmt.Printf("Could not load trust anchors: %v\n", err)
+		return
+	}
+	if server == nil {
+		if server, err = systemDNSServer(); err != nil {
+			fmt.Printf("DNSSEC check needs a nameserver to query: %v (use --resolver)\n", err)
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	w := &dnssecWalker{ctx: ctx, server: server, now: time.Now()}
+	status, reason := w.validate(domain, anchors)
+
+	rows := make([][]string, 0, len(w.steps))
+	for _, s := range w.steps {
+		rows = append(rows, []string{s.Zone, s.Check, colorVerdict(s.Verdict), s.Detail})
+	}
+	RenderTable([]string{"Zone", "Check", "Result", "Detail"}, rows)
+
+	switch status {
+	case DNSSECSecure:
+		fmt.Println("\033[92mDNSSEC: secure\033[0m")
+	case DNSSECInsecure:
+		fmt.Printf("\033[93mDNSSEC: insecure (%s)\033[0m\n", reason)
+	default:
+		fmt.Printf("\033[91mDNSSEC: %s (%s)\033[0m\n", status, reason)
+	}
+}
@@ -0,0 +1,116 @@
+package sysinformer
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestNSEC3Hash(t *testing.T) {
+	// From RFC 5155, Appendix A: salt aabbccdd, 12 iterations.
+	salt, _ := hex.DecodeString("aabbccdd")
+	for name, want := range map[string]string{
+		"example":   "0p9mhaveqvm6t7vbl5lop2u3t2rp3tom",
+		"a.example": "35mthgpgcu1qg68fab165klnsnk3dpvl",
+	} {
+		if got := strings.ToLower(nsec3Encoding.EncodeToString(nsec3Hash(name, salt, 12))); got != want {
+			t.Errorf("nsec3Hash(%s) = %s, want %s", name, got, want)
+		}
+	}
+}
+
+func TestTypeInBitmap(t *testing.T) {
+	// "A MX RRSIG NSEC TYPE1234" from RFC 4034, section 4.3.
+	bitmap := []byte{
+		0x00, 0x06, 0x40, 0x01, 0x00, 0x00, 0x00, 0x03,
+		0x04, 0x1b, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x20,
+	}
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeMX, dnsTypeRRSIG, dnsTypeNSEC, 1234} {
+		if !typeInBitmap(bitmap, typ) {
+			t.Errorf("type %d not found in bitmap", typ)
+		}
+	}
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeAAAA, dnsTypeDS, dnsmessage.TypeNS, 1235} {
+		if typeInBitmap(bitmap, typ) {
+			t.Errorf("type %d found in bitmap", typ)
+		}
+	}
+}
+
+// bitmapOf builds a window-0 type bitmap.
+func bitmapOf(types ...dnsmessage.Type) []byte {
+	b := make([]byte, 32)
+	for _, t := range types {
+		b[t/8] |= 0x80 >> (t % 8)
+	}
+	n := len(b)
+	for n > 0 && b[n-1] == 0 {
+		n--
+	}
+	return append([]byte{0, byte(n)}, b[:n]...)
+}
+
+func TestProveNoDataNSEC(t *testing.T) {
+	delegation := []nsecRecord{{Owner: "example.com.", Next: "zz.com.", Types: bitmapOf(dnsmessage.TypeNS, dnsTypeRRSIG, dnsTypeNSEC)}}
+	if _, err := proveNoData("example.com", "com", dnsTypeDS, delegation, nil); err != nil {
+		t.Errorf("NSEC without DS: %v", err)
+	}
+	signed := []nsecRecord{{Owner: "example.com.", Next: "zz.com.", Types: bitmapOf(dnsmessage.TypeNS, dnsTypeDS)}}
+	if _, err := proveNoData("example.com", "com", dnsTypeDS, signed, nil); err == nil {
+		t.Error("NSEC listing DS was accepted as proof of no DS")
+	}
+	other := []nsecRecord{{Owner: "a.com.", Next: "b.com.", Types: bitmapOf(dnsmessage.TypeNS)}}
+	if _, err := proveNoData("example.com", "com", dnsTypeDS, other, nil); err == nil {
+		t.Error("an unrelated NSEC was accepted as proof")
+	}
+	if _, err := proveNoData("example.com", "com", dnsTypeDS, nil, nil); err == nil {
+		t.Error("no denial records was accepted as proof")
+	}
+}
+
+func TestProveNoDataNSEC3(t *testing.T) {
+	salt := []byte{0xab}
+	h := func(name string) []byte { return nsec3Hash(name, salt, 1) }
+	rec := func(hash, next []byte, flags uint8, types ...dnsmessage.Type) nsec3Record {
+		return nsec3Record{Hash: hash, Flags: flags, Iterations: 1, Salt: salt, Next: next, Types: bitmapOf(types...)}
+	}
+	// Narrow spans starting at, or just below, a hash.
+	after := func(hash []byte) []byte {
+		next := bytes.Clone(hash)
+		next[len(next)-1]++
+		return next
+	}
+	around := func(hash []byte, flags uint8) nsec3Record {
+		prev := bytes.Clone(hash)
+		prev[len(prev)-1]--
+		return rec(prev, after(hash), flags)
+	}
+	apex := rec(h("com."), after(h("com.")), 0, dnsmessage.TypeSOA, dnsmessage.TypeNS)
+
+	exact := []nsec3Record{rec(h("example.com."), h("zz"), 0, dnsmessage.TypeNS)}
+	if proof, err := proveNoData("example.com", "com", dnsTypeDS, nil, exact); err != nil || !strings.Contains(proof, "NSEC3") {
+		t.Errorf("matching NSEC3 without DS = %q, %v", proof, err)
+	}
+	if _, err := proveNoData("example.com", "com", dnsmessage.TypeA, nil, exact); err != nil {
+		t.Errorf("matching NSEC3 without A: %v", err)
+	}
+
+	optOut := []nsec3Record{apex, around(h("example.com."), 1)}
+	if proof, err := proveNoData("example.com", "com", dnsTypeDS, nil, optOut); err != nil || !strings.Contains(proof, "opt-out") {
+		t.Errorf("opt-out span = %q, %v", proof, err)
+	}
+	if _, err := proveNoData("example.com", "com", dnsmessage.TypeA, nil, optOut); err == nil {
+		t.Error("an opt-out span was accepted as proof of no A records")
+	}
+	noOptOut := []nsec3Record{apex, around(h("example.com."), 0)}
+	if _, err := proveNoData("example.com", "com", dnsTypeDS, nil, noOptOut); err == nil {
+		t.Error("a span without opt-out was accepted as proof of an unsigned delegation")
+	}
+	if _, err := proveNoData("example.com", "com", dnsTypeDS, nil, []nsec3Record{around(h("example.com."), 1)}); err == nil {
+		t.Error("an opt-out span without a closest encloser was accepted")
+	}
+}
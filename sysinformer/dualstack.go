@@ -0,0 +1,329 @@
+package sysinformer
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// An address is flagged as slow when a measurement is both SLOW_FACTOR times and
+// SLOW_MARGIN above the fastest address for the same measurement.
+const (
+	SLOW_FACTOR = 2.0
+	SLOW_MARGIN = 20 * time.Millisecond
+)
+
+// pingRTTRe matches the average of "rtt min/avg/max/mdev = 0.04/0.05/0.06/0.01 ms" (Linux),
+// "round-trip min/avg/max/stddev = ..." (macOS) and "Average = 12ms" (Windows).
+var pingRTTRe = regexp.MustCompile(`(?:(?:rtt|round-trip) [^=]*= [0-9.]+/([0-9.]+)/|Average = ([0-9]+)ms)`)
+
+// parsePingAvg extracts the average round-trip time from ping output.
+func parsePingAvg(text string) (time.Duration, bool) {
+	m := pingRTTRe.FindStringSubmatch(text)
+	if m == nil {
+		return 0, false
+	}
+	ms, err := strconv.ParseFloat(m[1]+m[2], 64)
+	return time.Duration(ms * float64(time.Millisecond)), err == nil
+}
+
+// resolveAddrs returns the A and AAAA addresses of host, IPv4 first.
+func resolveAddrs(ctx context.Context, resolver *net.Resolver, host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+	ipAddrs, err := resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(ipAddrs))
+	for _, a := range ipAddrs {
+		ips = append(ips, a.IP)
+	}
+	sort.SliceStable(ips, func(i, j int) bool {
+		return ips[i].To4() != nil && ips[j].To4() == nil
+	})
+	return ips, nil
+}
+
+func ipFamily(ip net.IP) string {
+	if ip.To4() != nil {
+		return "IPv4"
+	}
+	return "IPv6"
+}
+
+// targetPort returns the port of u, defaulting by scheme.
+func targetPort(u *url.URL) string {
+	if p := u.Port(); p != "" {
+		return p
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+// pinnedTo returns a copy of reqOpts whose requests for authority go to ip.
+func (o HTTPRequestOptions) pinnedTo(host, port string, ip net.IP) HTTPRequestOptions {
+	o.Resolve = append(append([]string(nil), o.Resolve...), host+":"+port+":"+ip.String())
+	return o
+}
+
+// slowMarker tells which values are much slower than the fastest one. Zero values are
+// measurements that failed or did not run and are ignored.
+func slowMarker(values []time.Duration) []bool {
+	var fastest time.Duration
+	for _, v := range values {
+		if v > 0 && (fastest == 0 || v < fastest) {
+			fastest = v
+		}
+	}
+	slow := make([]bool, len(values))
+	for i, v := range values {
+		slow[i] = v > 0 && float64(v) > SLOW_FACTOR*float64(fastest) && v-fastest > SLOW_MARGIN
+	}
+	return slow
+}
+
+// addrProbe is what the dual-stack check measured against one address.
+type addrProbe struct {
+	IP net.IP
+
+	PingLoss float64
+	PingAvg  time.Duration
+	PingErr  string
+
+	Connect    time.Duration // average TCP connect time
+	ConnectErr string
+
+	HTTP       time.Duration // average total request time
+	HTTPStatus int
+	HTTPErr    string
+
+	TLS         time.Duration // connect + handshake
+	TLSErr      string
+	TLSInfo     bool // TLSErr is informational: the target is plain HTTP
+	TLSProblems []string
+}
+
+func (p addrProbe) failed() bool {
+	return p.PingErr != "" || p.PingLoss >= 100 || p.ConnectErr != "" || p.HTTPErr != "" || (p.TLSErr != "" && !p.TLSInfo) || len(p.TLSProblems) > 0
+}
+
+func probeAddr(ip net.IP, u *url.URL, opts WebDiagOptions, roots *x509.CertPool) addrProbe {
+	timeout := time.Duration(opts.TimeoutSec) * time.Second
+	host, port := u.Hostname(), targetPort(u)
+	p := addrProbe{IP: ip}
+
+	text, err := runPing(ip.String(), opts.Count, timeout)
+	if loss, ok := parsePingLoss(text); ok {
+		p.PingLoss = loss
+		p.PingAvg, _ = parsePingAvg(text)
+	} else if err != nil {
+		p.PingErr = err.Error()
+	} else {
+		p.PingErr = "could not parse ping output"
+	}
+
+	addr := net.JoinHostPort(ip.String(), port)
+	var connects []time.Duration
+	for i := 0; i < opts.Count; i++ {
+		start := time.Now()
+		conn, err := net.DialTimeout("tcp", addr, timeout)
+		if err != nil {
+			p.ConnectErr = err.Error()
+			continue
+		}
+		connects = append(connects, time.Since(start))
+		conn.Close()
+	}
+	if len(connects) > 0 {
+		p.ConnectErr = ""
+		p.Connect = averageDuration(connects)
+	}
+
+	reqOpts := opts.requestOptions().pinnedTo(host, port, ip)
+	client, err := reqOpts.client(timeout, false)
+	if err != nil {
+		p.HTTPErr = err.Error()
+	}
+	var totals []time.Duration
+	for i := 0; client != nil && i < opts.LatencyCount; i++ {
+		req, err := reqOpts.request(u.String())
+		if err != nil {
+			p.HTTPErr = err.Error()
+			break
+		}
+		t, resp, err := timedRequest(client, req)
+		if err != nil {
+			p.HTTPErr = err.Error()
+			continue
+		}
+		p.HTTPStatus = resp.StatusCode
+		totals = append(totals, t.Total)
+	}
+	if len(totals) > 0 {
+		p.HTTPErr = ""
+		p.HTTP = averageDuration(totals)
+	}
+
+	start := time.Now()
+	insp, err := inspectCert(ip.String(), timeout, opts.sslOptionsFor(u), roots)
+	if err != nil {
+		p.TLSErr = err.Error()
+		p.TLSInfo = u.Scheme != "https"
+	} else {
+		p.TLS = time.Since(start)
+		p.TLSProblems = insp.Problems
+	}
+	return p
+}
+
+func averageDuration(ds []time.Duration) time.Duration {
+	var total time.Duration
+	for _, d := range ds {
+		total += d
+	}
+	return total / time.Duration(len(ds))
+}
+
+// timingCell formats a measurement, red when it failed and yellow when it is slow.
+func timingCell(d time.Duration, errText string, slow bool) string {
+	switch {
+	case errText != "":
+		return colorCell("\033[91m", "failed")
+	case d == 0:
+		return "-"
+	case slow:
+		return colorCell("\033[93m", formatMs(d)+" (slow)")
+	}
+	return formatMs(d)
+}
+
+// CheckDualStack resolves every A and AAAA address of the target and runs ping, TCP
+// connect, HTTP latency and TLS checks against each one separately, so that
+// an address that fails or is much slower than the others stands out.
+func CheckDualStack(targetURL string, opts WebDiagOptions, resolver *net.Resolver) {
+	fmt.Println("")
+	PrintSectionHeader("DUAL STACK")
+
+	timeout := time.Duration(opts.TimeoutSec) * time.Second
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		fmt.Printf("Invalid URL: %v\n", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ips, err := resolveAddrs(ctx, resolver, u.Hostname())
+	cancel()
+	if err != nil {
+		fmt.Printf("Could not resolve %s: %v\n", u.Hostname(), err)
+		return
+	}
+	roots, err := loadCertPool(opts.CAFile)
+	if err != nil {
+		fmt.Printf("Could not load trust roots: %v\n", err)
+		return
+	}
+
+	probes := make([]addrProbe, len(ips))
+	var wg sync.WaitGroup
+	for i, ip := range ips {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			probes[i] = probeAddr(ip, u, opts, roots)
+		}()
+	}
+	wg.Wait()
+
+	pings := make([]time.Duration, len(probes))
+	connects := make([]time.Duration, len(probes))
+	https := make([]time.Duration, len(probes))
+	tlss := make([]time.Duration, len(probes))
+	for i, p := range probes {
+		pings[i], connects[i], https[i], tlss[i] = p.PingAvg, p.Connect, p.HTTP, p.TLS
+	}
+	slowPing, slowConnect, slowHTTP, slowTLS := slowMarker(pings), slowMarker(connects), slowMarker(https), slowMarker(tlss)
+
+	rows := make([][]string, 0, len(probes))
+	var notes []string
+	families := map[string][2]int{} // family -> {addresses, failing}
+	for i, p := range probes {
+		fam := ipFamily(p.IP)
+		count := families[fam]
+		count[0]++
+
+		ping := timingCell(p.PingAvg, p.PingErr, slowPing[i])
+		switch {
+		case p.PingErr != "":
+		case p.PingLoss >= 100:
+			ping = colorCell("\033[91m", "100% loss")
+		case p.PingLoss > 0:
+			ping = colorCell("\033[93m", fmt.Sprintf("%s, %.0f%% loss", formatMs(p.PingAvg), p.PingLoss))
+		}
+		httpCell := timingCell(p.HTTP, p.HTTPErr, slowHTTP[i])
+		if p.HTTPStatus != 0 && p.HTTPErr == "" {
+			httpCell += " (" + strconv.Itoa(p.HTTPStatus) + ")"
+		}
+		tlsCell := timingCell(p.TLS, p.TLSErr, slowTLS[i])
+		switch {
+		case p.TLSInfo:
+			tlsCell = "-"
+		case len(p.TLSProblems) > 0:
+			tlsCell = colorCell("\033[91m", "invalid")
+		}
+
+		verdict := VerdictPass
+		switch {
+		case p.failed():
+			verdict = VerdictFail
+			count[1]++
+		case p.PingLoss > 0 || slowPing[i] || slowConnect[i] || slowHTTP[i] || slowTLS[i]:
+			verdict = VerdictWarn
+		}
+		families[fam] = count
+		rows = append(rows, []string{fam, p.IP.String(), ping, timingCell(p.Connect, p.ConnectErr, slowConnect[i]), httpCell, tlsCell, colorVerdict(verdict)})
+
+		tlsCheck := "TLS"
+		if p.TLSInfo {
+			tlsCheck = "TLS (info, plain HTTP target)"
+		}
+		for _, n := range []struct{ check, err string }{{"ping", p.PingErr}, {"TCP connect", p.ConnectErr}, {"HTTP", p.HTTPErr}, {tlsCheck, p.TLSErr}} {
+			if n.err != "" {
+				notes = append(notes, fmt.Sprintf("%s %s: %s", p.IP, n.check, n.err))
+			}
+		}
+		for _, problem := range p.TLSProblems {
+			notes = append(notes, fmt.Sprintf("%s TLS: %s", p.IP, problem))
+		}
+	}
+
+	RenderTable([]string{"Family", "Address", "Ping (ms)", "TCP connect (ms)", "HTTP (ms)", "TLS (ms)", "Verdict"}, rows)
+	for _, n := range notes {
+		fmt.Println(truncateForDisplay(n, 160))
+	}
+
+	summary := []string{}
+	for _, fam := range []string{"IPv4", "IPv6"} {
+		c, ok := families[fam]
+		switch {
+		case !ok:
+			summary = append(summary, fmt.Sprintf("no %s addresses", fam))
+		case c[1] == 0:
+			summary = append(summary, fmt.Sprintf("%s: %d ok", fam, c[0]))
+		default:
+			summary = append(summary, fmt.Sprintf("%s: %d of %d failing", fam, c[1], c[0]))
+		}
+	}
+	fmt.Println(strings.Join(summary, "; "))
+}
@@ -0,0 +1,739 @@
+package sysinformer
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	spfMaxLookups     = 10 // RFC 7208 4.6.4
+	spfMaxVoidLookups = 2
+	spfMaxDepth       = 10
+	mtaSTSMaxAge      = 31557600 // RFC 8461 3.2
+	maxPolicyBody     = 64 << 10
+)
+
+// EmailCheckOptions configures the email deliverability check.
+type EmailCheckOptions struct {
+	Selectors []string   // DKIM selectors to look up
+	Resolver  *DNSServer // nil for the system resolver
+	CAFile    string     // roots for the MTA-STS policy fetch
+}
+
+type emailChecker struct {
+	ctx      context.Context
+	resolver *net.Resolver
+	client   *http.Client
+	domain   string
+	records  [][]string
+	findings []verdictFinding
+
+	dmarcPolicy string
+	dmarcPct    int
+}
+
+func (c *emailChecker) add(check, verdict, format string, args ...interface{}) {
+	f := verdictFinding{Check: check, Verdict: verdict, Detail: fmt.Sprintf(format, args...)}
+	// An SPF include reached twice would otherwise repeat its findings.
+	for _, seen := range c.findings {
+		if seen == f {
+			return
+		}
+	}
+	c.findings = append(c.findings, f)
+}
+
+func (c *emailChecker) record(name, value string) {
+	// DKIM keys run to hundreds of characters; the start is enough to recognise one.
+	c.records = append(c.records, []string{name, truncateForDisplay(value, 120)})
+}
+
+// lookupTXT returns the TXT strings at name, or nil when the name or record does not exist.
+func (c *emailChecker) lookupTXT(name string) ([]string, error) {
+	txt, err := c.resolver.LookupTXT(c.ctx, name)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil, nil
+	}
+	return txt, err
+}
+
+// txtWithPrefix returns the records at name that start with prefix, ignoring case.
+func (c *emailChecker) txtWithPrefix(name, prefix string) ([]string, error) {
+	txt, err := c.lookupTXT(name)
+	var out []string
+	for _, t := range txt {
+		if len(t) >= len(prefix) && strings.EqualFold(t[:len(prefix)], prefix) {
+			out = append(out, t)
+		}
+	}
+	return out, err
+}
+
+// parseTagList splits "k1=v1; k2=v2" records (DMARC, DKIM, MTA-STS, TLS-RPT, BIMI).
+func parseTagList(s string) (map[string]string, []string) {
+	tags := map[string]string{}
+	var order []string
+	for _, part := range strings.Split(s, ";") {
+		k, v, ok := strings.Cut(part, "=")
+		k = strings.ToLower(strings.TrimSpace(k))
+		if !ok || k == "" {
+			continue
+		}
+		if _, dup := tags[k]; !dup {
+			order = append(order, k)
+		}
+		tags[k] = strings.TrimSpace(v)
+	}
+	return tags, order
+}
+
+// spfWalker follows include and redirect terms, counting DNS-querying terms against the
+// RFC 7208 limits. visited holds the domains on the current include path, to catch loops.
+type spfWalker struct {
+	c       *emailChecker
+	lookups int
+	voids   int
+	visited map[string]bool
+	tree    []string
+}
+
+func (w *spfWalker) void(names []string, err error) {
+	if err == nil && len(names) == 0 {
+		w.voids++
+	}
+}
+
+func (w *spfWalker) fetch(domain string) (string, error) {
+	recs, err := w.c.txtWithPrefix(domain, "v=spf1")
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < len(recs); i++ {
+		// "v=spf1x" is not an SPF record; the version must be followed by a space or end.
+		if len(recs[i]) > 6 && recs[i][6] != ' ' {
+			recs = append(recs[:i], recs[i+1:]...)
+			i--
+		}
+	}
+	switch len(recs) {
+	case 0:
+		return "", nil
+	case 1:
+		return recs[0], nil
+	}
+	return "", fmt.Errorf("%s publishes %d SPF records (permerror)", domain, len(recs))
+}
+
+// walk evaluates the terms of record for domain. It returns the qualifier of the top-level
+// "all" mechanism, if any, and the first permanent error.
+func (w *spfWalker) walk(domain, record string, depth int) (string, error) {
+	if depth > spfMaxDepth {
+		return "", errors.New("include/redirect nesting is too deep")
+	}
+	w.visited[strings.ToLower(domain)] = true
+	defer delete(w.visited, strings.ToLower(domain))
+	all, redirect := "", ""
+	for _, term := range strings.Fields(record)[1:] {
+		if k, v, ok := strings.Cut(term, "="); ok && !strings.ContainsAny(k, ":/") {
+			switch strings.ToLower(k) {
+			case "redirect":
+				redirect = v
+			case "exp":
+			default:
+				// Unknown modifiers are ignored (RFC 7208 6).
+			}
+			continue
+		}
+		qualifier := "+"
+		if strings.ContainsAny(term[:1], "+-~?") {
+			qualifier, term = term[:1], term[1:]
+		}
+		mech, arg, _ := strings.Cut(term, ":")
+		mech = strings.ToLower(mech)
+		if i := strings.Index(mech, "/"); i >= 0 && (strings.HasPrefix(mech, "a/") || strings.HasPrefix(mech, "mx/")) {
+			mech = mech[:i]
+		}
+		target := domain
+		if arg != "" {
+			target, _, _ = strings.Cut(arg, "/")
+		}
+		macro := strings.Contains(target, "%{")
+		switch mech {
+		case "all":
+			all = qualifier
+		case "include":
+			w.lookups++
+			if arg == "" {
+				return all, errors.New("include without a domain")
+			}
+			w.tree = append(w.tree, strings.Repeat("  ", depth)+"include:"+target)
+			if macro {
+				continue
+			}
+			if w.visited[strings.ToLower(target)] {
+				return all, fmt.Errorf("include loop at %s", target)
+			}
+			rec, err := w.fetch(target)
+			if err != nil {
+				return all, err
+			}
+			if rec == "" {
+				w.voids++
+				return all, fmt.Errorf("include:%s has no SPF record (permerror)", target)
+			}
+			if _, err := w.walk(target, rec, depth+1); err != nil {
+				return all, err
+			}
+		case "a":
+			w.lookups++
+			if !macro {
+				ips, err := w.c.resolver.LookupHost(w.c.ctx, target)
+				w.void(ips, ignoreNotFound(err))
+			}
+		case "mx":
+			w.lookups++
+			if !macro {
+				mx, err := w.c.resolver.LookupMX(w.c.ctx, target)
+				if len(mx) > spfMaxLookups {
+					return all, fmt.Errorf("mx:%s has %d MX hosts; at most %d are allowed", target, len(mx), spfMaxLookups)
+				}
+				names := make([]string, 0, len(mx))
+				for _, m := range mx {
+					names = append(names, m.Host)
+				}
+				w.void(names, ignoreNotFound(err))
+			}
+		case "ptr":
+			w.lookups++
+			w.c.add("SPF", VerdictWarn, "%s uses the ptr mechanism, which is deprecated and slow (RFC 7208 5.5)", domain)
+		case "exists":
+			w.lookups++
+			if arg == "" {
+				return all, errors.New("exists without a domain")
+			}
+		case "ip4", "ip6":
+			if _, _, err := net.ParseCIDR(arg); err != nil && net.ParseIP(arg) == nil {
+				return all, fmt.Errorf("invalid %s address %q", mech, arg)
+			}
+		default:
+			return all, fmt.Errorf("unknown mechanism %q", term)
+		}
+	}
+	if redirect != "" && all == "" {
+		w.lookups++
+		w.tree = append(w.tree, strings.Repeat("  ", depth)+"redirect="+redirect)
+		if w.visited[strings.ToLower(redirect)] {
+			return all, fmt.Errorf("redirect loop at %s", redirect)
+		}
+		rec, err := w.fetch(redirect)
+		if err != nil {
+			return all, err
+		}
+		if rec == "" {
+			return all, fmt.Errorf("redirect=%s has no SPF record (permerror)", redirect)
+		}
+		return w.walk(redirect, rec, depth+1)
+	}
+	return all, nil
+}
+
+func ignoreNotFound(err error) error {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return nil
+	}
+	return err
+}
+
+func (c *emailChecker) checkSPF() {
+	w := &spfWalker{c: c, visited: map[string]bool{}}
+	record, err := w.fetch(c.domain)
+	if err != nil {
+		c.add("SPF", VerdictFail, "%v", err)
+		return
+	}
+	if record == "" {
+		c.add("SPF", VerdictFail, "no SPF record: receivers cannot tell which servers may send for %s", c.domain)
+		return
+	}
+	c.record("SPF", record)
+
+	all, err := w.walk(c.domain, record, 0)
+	if len(w.tree) > 0 {
+		c.record("SPF includes", strings.Join(w.tree, "\n"))
+	}
+	if err != nil {
+		// Evaluation stops at a permerror, so the counts below would be partial.
+		c.add("SPF", VerdictFail, "%v", err)
+		return
+	}
+	switch {
+	case w.lookups > spfMaxLookups:
+		c.add("SPF", VerdictFail, "%d DNS lookups exceed the limit of %d (permerror)", w.lookups, spfMaxLookups)
+	case w.lookups >= spfMaxLookups-2:
+		c.add("SPF", VerdictWarn, "%d of %d DNS lookups used; little room for more includes", w.lookups, spfMaxLookups)
+	default:
+		c.add("SPF", VerdictPass, "%d of %d DNS lookups", w.lookups, spfMaxLookups)
+	}
+	if w.voids > spfMaxVoidLookups {
+		c.add("SPF", VerdictFail, "%d lookups returned no records; more than %d is a permerror", w.voids, spfMaxVoidLookups)
+	}
+	switch all {
+	case "-":
+		c.add("SPF", VerdictPass, "-all: mail from unlisted servers fails")
+	case "~":
+		c.add("SPF", VerdictInfo, "~all: mail from unlisted servers soft-fails")
+	case "?":
+		c.add("SPF", VerdictWarn, "?all: unlisted servers are neutral, so SPF gives no protection")
+	case "+":
+		c.add("SPF", VerdictFail, "+all: any server on the internet may send for %s", c.domain)
+	default:
+		if !strings.Contains(strings.ToLower(record), "redirect=") {
+			c.add("SPF", VerdictWarn, "no all mechanism: unlisted servers default to neutral")
+		}
+	}
+}
+
+// mailtoDomain returns the domain of a "mailto:user@host!size" DMARC URI.
+func mailtoDomain(uri string) (string, bool) {
+	addr, ok := strings.CutPrefix(strings.TrimSpace(uri), "mailto:")
+	if !ok {
+		return "", false
+	}
+	addr, _, _ = strings.Cut(addr, "!")
+	at := strings.LastIndex(addr, "@")
+	if at <= 0 || at == len(addr)-1 {
+		return "", false
+	}
+	return strings.ToLower(addr[at+1:]), true
+}
+
+func (c *emailChecker) checkDMARC() {
+	name := "_dmarc." + c.domain
+	recs, err := c.txtWithPrefix(name, "v=DMARC1")
+	if err == nil && len(recs) == 0 && registeredDomain(c.domain) != c.domain {
+		name = "_dmarc." + registeredDomain(c.domain)
+		recs, err = c.txtWithPrefix(name, "v=DMARC1")
+	}
+	switch {
+	case err != nil:
+		c.add("DMARC", VerdictFail, "lookup failed: %v", err)
+		return
+	case len(recs) == 0:
+		c.add("DMARC", VerdictFail, "no DMARC record at _dmarc.%s: spoofed mail is not rejected", c.domain)
+		return
+	case len(recs) > 1:
+		c.add("DMARC", VerdictFail, "%s has %d DMARC records; receivers ignore them all", name, len(recs))
+		return
+	}
+	c.record("DMARC", recs[0])
+	if name != "_dmarc."+c.domain {
+		c.add("DMARC", VerdictInfo, "inherited from the organizational domain (%s)", name)
+	}
+
+	tags, order := parseTagList(recs[0])
+	if len(order) < 2 || order[0] != "v" || order[1] != "p" {
+		c.add("DMARC", VerdictWarn, "the p= tag should directly follow v=DMARC1")
+	}
+	c.dmarcPolicy = strings.ToLower(tags["p"])
+	switch c.dmarcPolicy {
+	case "reject":
+		c.add("DMARC", VerdictPass, "p=reject: failing mail is rejected")
+	case "quarantine":
+		c.add("DMARC", VerdictPass, "p=quarantine: failing mail goes to spam")
+	case "none":
+		c.add("DMARC", VerdictWarn, "p=none: monitoring only, failing mail is still delivered")
+	case "":
+		c.add("DMARC", VerdictFail, "missing required p= tag")
+	default:
+		c.add("DMARC", VerdictFail, "invalid policy p=%s", tags["p"])
+	}
+	if sp, ok := tags["sp"]; ok && strings.EqualFold(sp, "none") && c.dmarcPolicy != "none" {
+		c.add("DMARC", VerdictWarn, "sp=none leaves subdomains unprotected")
+	}
+
+	c.dmarcPct = 100
+	if v, ok := tags["pct"]; ok {
+		pct, err := strconv.Atoi(v)
+		switch {
+		case err != nil || pct < 0 || pct > 100:
+			c.add("DMARC", VerdictFail, "invalid pct=%s", v)
+		case pct < 100:
+			c.dmarcPct = pct
+			c.add("DMARC", VerdictWarn, "pct=%d: the policy applies to only %d%% of failing mail", pct, pct)
+		}
+	}
+	for _, tag := range []string{"adkim", "aspf"} {
+		if v, ok := tags[tag]; ok && v != "r" && v != "s" {
+			c.add("DMARC", VerdictFail, "invalid %s=%s (use r or s)", tag, v)
+		}
+	}
+
+	for _, tag := range []string{"rua", "ruf"} {
+		v, ok := tags[tag]
+		if !ok {
+			if tag == "rua" {
+				c.add("DMARC", VerdictWarn, "no rua= address: you will not receive aggregate reports")
+			}
+			continue
+		}
+		for _, uri := range strings.Split(v, ",") {
+			host, ok := mailtoDomain(uri)
+			if !ok {
+				c.add("DMARC", VerdictFail, "invalid %s URI %q (expected mailto:)", tag, strings.TrimSpace(uri))
+				continue
+			}
+			if registeredDomain(host) == registeredDomain(c.domain) {
+				continue
+			}
+			// RFC 7489 7.1: the receiving domain must authorize reports about this one.
+			auth := registeredDomain(c.domain) + "._report._dmarc." + host
+			if recs, err := c.txtWithPrefix(auth, "v=DMARC1"); err == nil && len(recs) == 0 {
+				c.add("DMARC", VerdictWarn, "%s reports go to %s, which has not authorized them (no %s record)", tag, host, auth)
+			}
+		}
+	}
+}
+
+// dkimKeyBits returns the size of a DKIM public key.
+func dkimKeyBits(keyType, p string) (int, error) {
+	der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(p), ""))
+	if err != nil {
+		return 0, fmt.Errorf("p= is not valid base64: %v", err)
+	}
+	if keyType == "ed25519" {
+		if len(der) != ed25519.PublicKeySize {
+			return 0, fmt.Errorf("ed25519 key is %d bytes, want %d", len(der), ed25519.PublicKeySize)
+		}
+		return 256, nil
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		// Some signers publish a bare PKCS#1 key.
+		if rk, err2 := x509.ParsePKCS1PublicKey(der); err2 == nil {
+			return rk.N.BitLen(), nil
+		}
+		return 0, fmt.Errorf("cannot parse key: %v", err)
+	}
+	rk, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return 0, fmt.Errorf("k=rsa but the key is %T", pub)
+	}
+	return rk.N.BitLen(), nil
+}
+
+func (c *emailChecker) checkDKIM(selectors []string) {
+	if len(selectors) == 0 {
+		c.add("DKIM", VerdictInfo, "no selectors given; use --dkim-selector to check DKIM keys")
+		return
+	}
+	for _, sel := range selectors {
+		check := "DKIM " + sel
+		name := sel + "._domainkey." + c.domain
+		txt, err := c.lookupTXT(name)
+		if err != nil {
+			c.add(check, VerdictFail, "lookup failed: %v", err)
+			continue
+		}
+		var rec string
+		for _, t := range txt {
+			if strings.Contains(t, "p=") {
+				rec = t
+				break
+			}
+		}
+		if rec == "" {
+			c.add(check, VerdictFail, "no DKIM key at %s", name)
+			continue
+		}
+		c.record(check, rec)
+		tags, _ := parseTagList(rec)
+		if v, ok := tags["v"]; ok && v != "DKIM1" {
+			c.add(check, VerdictFail, "invalid version v=%s", v)
+		}
+		keyType := strings.ToLower(tags["k"])
+		if keyType == "" {
+			keyType = "rsa"
+		}
+		if keyType != "rsa" && keyType != "ed25519" {
+			c.add(check, VerdictFail, "unknown key type k=%s", tags["k"])
+			continue
+		}
+		if tags["p"] == "" {
+			c.add(check, VerdictWarn, "empty p=: the key has been revoked")
+			continue
+		}
+		bits, err := dkimKeyBits(keyType, tags["p"])
+		switch {
+		case err != nil:
+			c.add(check, VerdictFail, "%v", err)
+		case keyType == "rsa" && bits < 1024:
+			c.add(check, VerdictFail, "%d-bit RSA key is too weak and ignored by most receivers", bits)
+		case keyType == "rsa" && bits < 2048:
+			c.add(check, VerdictWarn, "%d-bit RSA key; 2048 bits is recommended", bits)
+		default:
+			c.add(check, VerdictPass, "%d-bit %s key", bits, strings.ToUpper(keyType))
+		}
+		if strings.Contains(tags["t"], "y") {
+			c.add(check, VerdictInfo, "t=y: the domain is testing DKIM, receivers may ignore failures")
+		}
+	}
+}
+
+// mtaSTSPolicy is a parsed RFC 8461 policy file.
+type mtaSTSPolicy struct {
+	Version string
+	Mode    string
+	MX      []string
+	MaxAge  int
+}
+
+func parseMTASTSPolicy(body string) (mtaSTSPolicy, error) {
+	var p mtaSTSPolicy
+	p.MaxAge = -1
+	for _, line := range strings.Split(body, "\n") {
+		k, v, ok := strings.Cut(strings.TrimRight(line, "\r"), ":")
+		if !ok {
+			continue
+		}
+		v = strings.TrimSpace(v)
+		switch strings.TrimSpace(k) {
+		case "version":
+			p.Version = v
+		case "mode":
+			p.Mode = v
+		case "mx":
+			p.MX = append(p.MX, strings.ToLower(v))
+		case "max_age":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return p, fmt.Errorf("invalid max_age %q", v)
+			}
+			p.MaxAge = n
+		}
+	}
+	if p.Version != "STSv1" {
+		return p, fmt.Errorf("version is %q, want STSv1", p.Version)
+	}
+	return p, nil
+}
+
+// mtaSTSMatch reports whether host matches an MTA-STS mx pattern such as "*.example.com",
+// where the wildcard covers exactly one label.
+func mtaSTSMatch(pattern, host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if rest, ok := strings.CutPrefix(pattern, "*."); ok {
+		_, suffix, found := strings.Cut(host, ".")
+		return found && suffix == rest
+	}
+	return pattern == host
+}
+
+func (c *emailChecker) checkMTASTS() bool {
+	recs, err := c.txtWithPrefix("_mta-sts."+c.domain, "v=STSv1")
+	switch {
+	case err != nil:
+		c.add("MTA-STS", VerdictFail, "lookup failed: %v", err)
+		return false
+	case len(recs) == 0:
+		c.add("MTA-STS", VerdictInfo, "not deployed: mail to %s may be delivered without TLS if an attacker strips STARTTLS", c.domain)
+		return false
+	case len(recs) > 1:
+		c.add("MTA-STS", VerdictFail, "_mta-sts.%s has %d records; senders ignore the policy", c.domain, len(recs))
+		return true
+	}
+	c.record("MTA-STS", recs[0])
+	if tags, _ := parseTagList(recs[0]); tags["id"] == "" {
+		c.add("MTA-STS", VerdictFail, "record has no id= tag")
+	}
+
+	url := "https://mta-sts." + c.domain + "/.well-known/mta-sts.txt"
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, url, nil)
+	if err != nil {
+		c.add("MTA-STS", VerdictFail, "%v", err)
+		return true
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.add("MTA-STS", VerdictFail, "policy fetch failed: %v", err)
+		return true
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.add("MTA-STS", VerdictFail, "policy fetch returned %s", resp.Status)
+		return true
+	}
+	if mt, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mt != "text/plain" {
+		c.add("MTA-STS", VerdictWarn, "policy served as %q; it should be text/plain", resp.Header.Get("Content-Type"))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPolicyBody))
+	if err != nil {
+		c.add("MTA-STS", VerdictFail, "reading policy: %v", err)
+		return true
+	}
+	policy, err := parseMTASTSPolicy(string(body))
+	if err != nil {
+		c.add("MTA-STS", VerdictFail, "invalid policy: %v", err)
+		return true
+	}
+	c.record("MTA-STS policy", fmt.Sprintf("mode %s, mx %s, max_age %d", policy.Mode, strings.Join(policy.MX, " "), policy.MaxAge))
+
+	switch policy.Mode {
+	case "enforce":
+		c.add("MTA-STS", VerdictPass, "mode enforce")
+	case "testing":
+		c.add("MTA-STS", VerdictWarn, "mode testing: failures are reported but mail is still delivered")
+	case "none":
+		c.add("MTA-STS", VerdictWarn, "mode none: the policy is being withdrawn")
+	default:
+		c.add("MTA-STS", VerdictFail, "invalid mode %q", policy.Mode)
+	}
+	switch {
+	case policy.MaxAge < 0:
+		c.add("MTA-STS", VerdictFail, "policy has no max_age")
+	case policy.MaxAge > mtaSTSMaxAge:
+		c.add("MTA-STS", VerdictFail, "max_age %d exceeds the maximum of %d", policy.MaxAge, mtaSTSMaxAge)
+	case policy.MaxAge < 86400:
+		c.add("MTA-STS", VerdictWarn, "max_age %d is under a day; senders will refetch often", policy.MaxAge)
+	}
+	if policy.Mode != "none" {
+		mx, _ := c.resolver.LookupMX(c.ctx, c.domain)
+		for _, m := range mx {
+			covered := false
+			for _, p := range policy.MX {
+				if mtaSTSMatch(p, m.Host) {
+					covered = true
+					break
+				}
+			}
+			if !covered {
+				c.add("MTA-STS", VerdictFail, "MX %s is not listed in the policy; senders will refuse to deliver to it", strings.TrimSuffix(m.Host, "."))
+			}
+		}
+	}
+	return true
+}
+
+func (c *emailChecker) checkTLSRPT(mtaSTS bool) {
+	recs, err := c.txtWithPrefix("_smtp._tls."+c.domain, "v=TLSRPTv1")
+	switch {
+	case err != nil:
+		c.add("TLS-RPT", VerdictFail, "lookup failed: %v", err)
+		return
+	case len(recs) == 0:
+		verdict := VerdictInfo
+		if mtaSTS {
+			verdict = VerdictWarn
+		}
+		c.add("TLS-RPT", verdict, "no TLS-RPT record: you will not hear about TLS delivery failures")
+		return
+	case len(recs) > 1:
+		c.add("TLS-RPT", VerdictFail, "_smtp._tls.%s has %d records", c.domain, len(recs))
+		return
+	}
+	c.record("TLS-RPT", recs[0])
+	tags, _ := parseTagList(recs[0])
+	if tags["rua"] == "" {
+		c.add("TLS-RPT", VerdictFail, "record has no rua= destination")
+		return
+	}
+	for _, uri := range strings.Split(tags["rua"], ",") {
+		uri = strings.TrimSpace(uri)
+		if !strings.HasPrefix(uri, "mailto:") && !strings.HasPrefix(uri, "https://") {
+			c.add("TLS-RPT", VerdictFail, "invalid rua %q (expected mailto: or https://)", uri)
+			return
+		}
+	}
+	c.add("TLS-RPT", VerdictPass, "reports go to %s", tags["rua"])
+}
+
+func (c *emailChecker) checkBIMI() {
+	recs, err := c.txtWithPrefix("default._bimi."+c.domain, "v=BIMI1")
+	switch {
+	case err != nil:
+		c.add("BIMI", VerdictFail, "lookup failed: %v", err)
+		return
+	case len(recs) == 0:
+		c.add("BIMI", VerdictInfo, "no BIMI record at default._bimi.%s", c.domain)
+		return
+	}
+	c.record("BIMI", recs[0])
+	tags, _ := parseTagList(recs[0])
+	logo := tags["l"]
+	switch {
+	case logo == "":
+		c.add("BIMI", VerdictWarn, "no logo URL (l=); the record declines BIMI")
+	case !strings.HasPrefix(logo, "https://"):
+		c.add("BIMI", VerdictFail, "logo URL must use https: %s", logo)
+	case !strings.HasSuffix(strings.ToLower(logo), ".svg"):
+		c.add("BIMI", VerdictWarn, "logo should be an SVG Tiny PS file: %s", logo)
+	}
+	if tags["a"] == "" {
+		c.add("BIMI", VerdictInfo, "no mark certificate (a=); some mailbox providers require a VMC")
+	} else if !strings.HasPrefix(tags["a"], "https://") {
+		c.add("BIMI", VerdictFail, "certificate URL must use https: %s", tags["a"])
+	}
+	if (c.dmarcPolicy != "quarantine" && c.dmarcPolicy != "reject") || c.dmarcPct < 100 {
+		c.add("BIMI", VerdictFail, "BIMI requires a DMARC policy of quarantine or reject at pct=100")
+	}
+}
+
+// CheckEmail inspects SPF, DMARC, DKIM, MTA-STS, TLS-RPT and BIMI for domain and reports
+// misconfigurations with a severity.
+func CheckEmail(domain string, timeout time.Duration, opts EmailCheckOptions) {
+	fmt.Println("")
+	PrintSectionHeader("EMAIL")
+
+	roots, err := loadCertPool(opts.CAFile)
+	if err != nil {
+		fmt.Printf("Could not load trust roots: %v\n", err)
+		return
+	}
+	resolver := opts.Resolver.Resolver()
+	dialer := &net.Dialer{Timeout: timeout, Resolver: resolver}
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:     dialer.DialContext,
+			TLSClientConfig: &tls.Config{RootCAs: roots},
+		},
+		// RFC 8461 3.3: the policy must not be fetched through redirects.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+
+	c := &emailChecker{resolver: resolver, client: client, domain: strings.TrimSuffix(strings.ToLower(domain), ".")}
+	// Each check gets the whole timeout, so a slow SPF include tree does not leave the
+	// later checks with an expired context.
+	run := func(check func()) {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		c.ctx = ctx
+		check()
+	}
+	var mtaSTS bool
+	run(c.checkSPF)
+	run(c.checkDMARC)
+	run(func() { c.checkDKIM(opts.Selectors) })
+	run(func() { mtaSTS = c.checkMTASTS() })
+	run(func() { c.checkTLSRPT(mtaSTS) })
+	run(c.checkBIMI)
+
+	if len(c.records) > 0 {
+		RenderKeyValueTable("Record", "Value", c.records)
+	}
+	renderVerdictFindings(c.findings)
+}
@@ -0,0 +1,57 @@
+//go:build ignore
+
+// gen_rdap_bootstrap downloads the IANA RDAP bootstrap file for domain names and writes it
+// to rdap_bootstrap.json, which whois.go embeds. Run it with go generate.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const bootstrapURL = "https://data.iana.org/rdap/dns.json"
+
+func main() {
+	if err := run("rdap_bootstrap.json"); err != nil {
+		fmt.Fprintf(os.Stderr, "gen_rdap_bootstrap: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(out string) error {
+	client := &http.Client{Timeout: 60 * time.Second}
+	resp, err := client.Get(bootstrapURL)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", bootstrapURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+
+	// Refuse to embed something that is not a bootstrap file.
+	var b struct {
+		Publication string          `json:"publication"`
+		Services    [][][]string    `json:"services"`
+		Version     json.RawMessage `json:"version"`
+	}
+	if err := json.Unmarshal(data, &b); err != nil {
+		return fmt.Errorf("parsing %s: %w", bootstrapURL, err)
+	}
+	if len(b.Services) == 0 {
+		return fmt.Errorf("%s lists no services", bootstrapURL)
+	}
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("wrote %s: %d services, published %s\n", out, len(b.Services), b.Publication)
+	return nil
+}
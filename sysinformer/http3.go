@@ -0,0 +1,407 @@
+package sysinformer
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2/hpack"
+	"golang.org/x/net/quic"
+)
+
+// HTTP/3 frame and stream types (RFC 9114).
+const (
+	h3FrameData     = 0x00
+	h3FrameHeaders  = 0x01
+	h3FrameSettings = 0x04
+	h3StreamControl = 0x00
+)
+
+// http3Result is the outcome of one HTTP/3 request.
+type http3Result struct {
+	Status    int
+	Header    http.Header
+	BodyBytes int64
+	Handshake time.Duration // QUIC and TLS handshake
+	TTFB      time.Duration // request sent -> response headers
+	Total     time.Duration
+}
+
+// http3Request sends req over a new QUIC connection to addr and reads the whole response.
+// Only what a single request needs is implemented: the client advertises no QPACK dynamic
+// table, so the server must encode headers with the static table and literals.
+func http3Request(ctx context.Context, addr string, tlsConf *tls.Config, req *http.Request, body []byte) (*http3Result, error) {
+	ep, err := quic.Listen("udp", ":0", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		defer cancel()
+		ep.Close(closeCtx)
+	}()
+
+	tlsConf = tlsConf.Clone()
+	tlsConf.NextProtos = []string{"h3"}
+	tlsConf.MinVersion = tls.VersionTLS13
+
+	res := &http3Result{Header: http.Header{}}
+	start := time.Now()
+	conn, err := ep.Dial(ctx, "udp", addr, &quic.Config{TLSConfig: tlsConf})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Abort(nil)
+	res.Handshake = time.Since(start)
+
+	// Every HTTP/3 client opens a control stream and sends SETTINGS first.
+	ctrl, err := conn.NewSendOnlyStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	ctrl.SetWriteContext(ctx)
+	preface := appendQUICVarint(nil, h3StreamControl)
+	preface = appendH3Frame(preface, h3FrameSettings, nil)
+	if _, err := ctrl.Write(preface); err != nil {
+		return nil, err
+	}
+	if err := ctrl.Flush(); err != nil {
+		return nil, err
+	}
+
+	st, err := conn.NewStream(ctx)
+	if err != nil {
+		return nil, err
+	}
+	st.SetReadContext(ctx)
+	st.SetWriteContext(ctx)
+	sent := time.Now()
+	frames := appendH3Frame(nil, h3FrameHeaders, qpackEncodeRequest(req))
+	if len(body) > 0 {
+		frames = appendH3Frame(frames, h3FrameData, body)
+	}
+	if _, err := st.Write(frames); err != nil {
+		return nil, err
+	}
+	if err := st.Flush(); err != nil {
+		return nil, err
+	}
+	st.CloseWrite()
+
+	r := bufio.NewReader(st)
+	for {
+		typ, payload, err := readH3Frame(r)
+		if err == io.EOF {
+			if res.Status == 0 {
+				return nil, errors.New("stream ended before the response headers")
+			}
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		switch typ {
+		case h3FrameHeaders:
+			fields, err := qpackDecode(payload)
+			if err != nil {
+				return nil, err
+			}
+			status := 0
+			for _, f := range fields {
+				if f.Name == ":status" {
+					status, _ = strconv.Atoi(f.Value)
+				}
+			}
+			// Interim 1xx responses precede the final one.
+			if status != 0 && status < 200 {
+				continue
+			}
+			if status != 0 && res.Status == 0 {
+				res.Status = status
+				res.TTFB = time.Since(sent)
+			}
+			for _, f := range fields {
+				if !strings.HasPrefix(f.Name, ":") {
+					res.Header.Add(f.Name, f.Value)
+				}
+			}
+		case h3FrameData:
+			res.BodyBytes += int64(len(payload))
+		}
+	}
+	res.Total = time.Since(start)
+	return res, nil
+}
+
+func appendQUICVarint(b []byte, v uint64) []byte {
+	switch {
+	case v < 1<<6:
+		return append(b, byte(v))
+	case v < 1<<14:
+		return append(b, 0x40|byte(v>>8), byte(v))
+	case v < 1<<30:
+		return append(b, 0x80|byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	}
+	return append(b, 0xc0|byte(v>>56), byte(v>>48), byte(v>>40), byte(v>>32), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func readQUICVarint(r io.ByteReader) (uint64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	v := uint64(first & 0x3f)
+	for i := 1; i < 1<<(first>>6); i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		v = v<<8 | uint64(b)
+	}
+	return v, nil
+}
+
+func appendH3Frame(b []byte, typ uint64, payload []byte) []byte {
+	b = appendQUICVarint(b, typ)
+	b = appendQUICVarint(b, uint64(len(payload)))
+	return append(b, payload...)
+}
+
+// maxH3Frame bounds the frames read, so a broken server cannot make us buffer gigabytes.
+const maxH3Frame = 16 << 20
+
+func readH3Frame(r *bufio.Reader) (uint64, []byte, error) {
+	typ, err := readQUICVarint(r)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := readQUICVarint(r)
+	if err != nil {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	if n > maxH3Frame {
+		return 0, nil, fmt.Errorf("HTTP/3 frame of %d bytes is too large", n)
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return typ, payload, nil
+}
+
+// qpackField is one decoded header field.
+type qpackField struct {
+	Name, Value string
+}
+
+// qpackStatic is the QPACK static table (RFC 9204, Appendix A).
+var qpackStatic = [...]qpackField{
+	{":authority", ""}, {":path", "/"}, {"age", "0"}, {"content-disposition", ""},
+	{"content-length", "0"}, {"cookie", ""}, {"date", ""}, {"etag", ""},
+	{"if-modified-since", ""}, {"if-none-match", ""}, {"last-modified", ""}, {"link", ""},
+	{"location", ""}, {"referer", ""}, {"set-cookie", ""}, {":method", "CONNECT"},
+	{":method", "DELETE"}, {":method", "GET"}, {":method", "HEAD"}, {":method", "OPTIONS"},
+	{":method", "POST"}, {":method", "PUT"}, {":scheme", "http"}, {":scheme", "https"},
+	{":status", "103"}, {":status", "200"}, {":status", "304"}, {":status", "404"},
+	{":status", "503"}, {"accept", "*/*"}, {"accept", "application/dns-message"},
+	{"accept-encoding", "gzip, deflate, br"}, {"accept-ranges", "bytes"},
+	{"access-control-allow-headers", "cache-control"}, {"access-control-allow-headers", "content-type"},
+	{"access-control-allow-origin", "*"}, {"cache-control", "max-age=0"},
+	{"cache-control", "max-age=2592000"}, {"cache-control", "max-age=604800"},
+	{"cache-control", "no-cache"}, {"cache-control", "no-store"},
+	{"cache-control", "public, max-age=31536000"}, {"content-encoding", "br"},
+	{"content-encoding", "gzip"}, {"content-type", "application/dns-message"},
+	{"content-type", "application/javascript"}, {"content-type", "application/json"},
+	{"content-type", "application/x-www-form-urlencoded"}, {"content-type", "image/gif"},
+	{"content-type", "image/jpeg"}, {"content-type", "image/png"}, {"content-type", "text/css"},
+	{"content-type", "text/html; charset=utf-8"}, {"content-type", "text/plain"},
+	{"content-type", "text/plain;charset=utf-8"}, {"range", "bytes=0-"},
+	{"strict-transport-security", "max-age=31536000"},
+	{"strict-transport-security", "max-age=31536000; includesubdomains"},
+	{"strict-transport-security", "max-age=31536000; includesubdomains; preload"},
+	{"vary", "accept-encoding"}, {"vary", "origin"}, {"x-content-type-options", "nosniff"},
+	{"x-xss-protection", "1; mode=block"}, {":status", "100"}, {":status", "204"},
+	{":status", "206"}, {":status", "302"}, {":status", "400"}, {":status", "403"},
+	{":status", "421"}, {":status", "425"}, {":status", "500"}, {"accept-language", ""},
+	{"access-control-allow-credentials", "FALSE"}, {"access-control-allow-credentials", "TRUE"},
+	{"access-control-allow-headers", "*"}, {"access-control-allow-methods", "get"},
+	{"access-control-allow-methods", "get, post, options"}, {"access-control-allow-methods", "options"},
+	{"access-control-expose-headers", "content-length"}, {"access-control-request-headers", "content-type"},
+	{"access-control-request-method", "get"}, {"access-control-request-method", "post"},
+	{"alt-svc", "clear"}, {"authorization", ""},
+	{"content-security-policy", "script-src 'none'; object-src 'none'; base-uri 'none'"},
+	{"early-data", "1"}, {"expect-ct", ""}, {"forwarded", ""}, {"if-range", ""}, {"origin", ""},
+	{"purpose", "prefetch"}, {"server", ""}, {"timing-allow-origin", "*"},
+	{"upgrade-insecure-requests", "1"}, {"user-agent", ""}, {"x-forwarded-for", ""},
+	{"x-frame-options", "deny"}, {"x-frame-options", "sameorigin"},
+}
+
+// appendQPACKInt appends v as a QPACK/HPACK prefixed integer; flags fill the bits above
+// the n-bit prefix.
+func appendQPACKInt(b []byte, flags byte, n uint, v uint64) []byte {
+	max := uint64(1)<<n - 1
+	if v < max {
+		return append(b, flags|byte(v))
+	}
+	b = append(b, flags|byte(max))
+	for v -= max; v >= 0x80; v >>= 7 {
+		b = append(b, byte(v)|0x80)
+	}
+	return append(b, byte(v))
+}
+
+// qpackEncodeRequest encodes the request's pseudo-headers and headers as literals, which
+// every decoder accepts without a dynamic table.
+func qpackEncodeRequest(req *http.Request) []byte {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	fields := []qpackField{
+		{":method", req.Method},
+		{":scheme", req.URL.Scheme},
+		{":authority", host},
+		{":path", req.URL.RequestURI()},
+	}
+	for name, values := range req.Header {
+		for _, v := range values {
+			fields = append(fields, qpackField{strings.ToLower(name), v})
+		}
+	}
+	b := []byte{0, 0} // Required Insert Count 0, Base 0
+	for _, f := range fields {
+		b = appendQPACKInt(b, 0x20, 3, uint64(len(f.Name)))
+		b = append(b, f.Name...)
+		b = appendQPACKInt(b, 0x00, 7, uint64(len(f.Value)))
+		b = append(b, f.Value...)
+	}
+	return b
+}
+
+var errQPACKTruncated = errors.New("truncated QPACK field section")
+
+// qpackReader decodes the primitives of a QPACK field section.
+type qpackReader struct {
+	b []byte
+}
+
+func (r *qpackReader) int(n uint) (uint64, error) {
+	if len(r.b) == 0 {
+		return 0, errQPACKTruncated
+	}
+	max := uint64(1)<<n - 1
+	v := uint64(r.b[0]) & max
+	r.b = r.b[1:]
+	if v < max {
+		return v, nil
+	}
+	for shift := uint(0); ; shift += 7 {
+		if len(r.b) == 0 || shift > 56 {
+			return 0, errQPACKTruncated
+		}
+		c := r.b[0]
+		r.b = r.b[1:]
+		v += uint64(c&0x7f) << shift
+		if c&0x80 == 0 {
+			return v, nil
+		}
+	}
+}
+
+// str reads a string whose length has an n-bit prefix, with the Huffman flag just above it.
+func (r *qpackReader) str(n uint) (string, error) {
+	if len(r.b) == 0 {
+		return "", errQPACKTruncated
+	}
+	huffman := r.b[0]&(1<<n) != 0
+	l, err := r.int(n)
+	if err != nil {
+		return "", err
+	}
+	if uint64(len(r.b)) < l {
+		return "", errQPACKTruncated
+	}
+	s := r.b[:l]
+	r.b = r.b[l:]
+	if huffman {
+		return hpack.HuffmanDecodeToString(s)
+	}
+	return string(s), nil
+}
+
+func qpackStaticEntry(i uint64) (qpackField, error) {
+	if i >= uint64(len(qpackStatic)) {
+		return qpackField{}, fmt.Errorf("QPACK static index %d out of range", i)
+	}
+	return qpackStatic[i], nil
+}
+
+// qpackDecode decodes a field section that only uses the static table.
+func qpackDecode(b []byte) ([]qpackField, error) {
+	r := &qpackReader{b: b}
+	ric, err := r.int(8)
+	if err != nil {
+		return nil, err
+	}
+	if ric != 0 {
+		return nil, errors.New("server used the QPACK dynamic table, which was not offered")
+	}
+	if _, err := r.int(7); err != nil { // delta base, meaningless without a dynamic table
+		return nil, err
+	}
+	var fields []qpackField
+	for len(r.b) > 0 {
+		c := r.b[0]
+		switch {
+		case c&0x80 != 0: // indexed field line
+			if c&0x40 == 0 {
+				return nil, errors.New("QPACK dynamic table reference")
+			}
+			i, err := r.int(6)
+			if err != nil {
+				return nil, err
+			}
+			f, err := qpackStaticEntry(i)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, f)
+		case c&0x40 != 0: // literal with name reference
+			if c&0x10 == 0 {
+				return nil, errors.New("QPACK dynamic table reference")
+			}
+			i, err := r.int(4)
+			if err != nil {
+				return nil, err
+			}
+			f, err := qpackStaticEntry(i)
+			if err != nil {
+				return nil, err
+			}
+			if f.Value, err = r.str(7); err != nil {
+				return nil, err
+			}
+			fields = append(fields, f)
+		case c&0x20 != 0: // literal with literal name
+			name, err := r.str(3)
+			if err != nil {
+				return nil, err
+			}
+			value, err := r.str(7)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, qpackField{name, value})
+		default:
+			return nil, errors.New("QPACK post-base reference")
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,158 @@
+package sysinformer
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+func TestReadQUICVarint(t *testing.T) {
+	// Examples from RFC 9000, Appendix A.1.
+	tests := []struct {
+		in   []byte
+		want uint64
+	}{
+		{[]byte{0xc2, 0x19, 0x7c, 0x5e, 0xff, 0x14, 0xe8, 0x8c}, 151288809941952652},
+		{[]byte{0x9d, 0x7f, 0x3e, 0x7d}, 494878333},
+		{[]byte{0x7b, 0xbd}, 15293},
+		{[]byte{0x25}, 37},
+		{[]byte{0x40, 0x25}, 37},
+	}
+	for _, tt := range tests {
+		got, err := readQUICVarint(bytes.NewReader(tt.in))
+		if err != nil || got != tt.want {
+			t.Errorf("readQUICVarint(% x) = %d, %v; want %d", tt.in, got, err, tt.want)
+		}
+	}
+
+	if _, err := readQUICVarint(bytes.NewReader([]byte{0x9d, 0x7f})); err != io.ErrUnexpectedEOF {
+		t.Errorf("truncated varint: err = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if _, err := readQUICVarint(bytes.NewReader(nil)); err != io.EOF {
+		t.Errorf("empty input: err = %v, want io.EOF", err)
+	}
+}
+
+func TestQUICVarintRoundTrip(t *testing.T) {
+	for _, v := range []uint64{0, 63, 64, 16383, 16384, 1<<30 - 1, 1 << 30, 1<<62 - 1} {
+		got, err := readQUICVarint(bytes.NewReader(appendQUICVarint(nil, v)))
+		if err != nil || got != v {
+			t.Errorf("round trip of %d = %d, %v", v, got, err)
+		}
+	}
+}
+
+func TestAppendQPACKInt(t *testing.T) {
+	// Examples from RFC 7541, Appendix C.1, plus prefix flags.
+	tests := []struct {
+		flags byte
+		n     uint
+		v     uint64
+		want  []byte
+	}{
+		{0x00, 5, 10, []byte{0x0a}},
+		{0x00, 5, 1337, []byte{0x1f, 0x9a, 0x0a}},
+		{0x00, 8, 42, []byte{0x2a}},
+		{0x20, 3, 7, []byte{0x27, 0x00}},
+		{0xc0, 6, 25, []byte{0xd9}},
+	}
+	for _, tt := range tests {
+		got := appendQPACKInt(nil, tt.flags, tt.n, tt.v)
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("appendQPACKInt(%#x, %d, %d) = % x, want % x", tt.flags, tt.n, tt.v, got, tt.want)
+		}
+		r := &qpackReader{b: got}
+		if v, err := r.int(tt.n); err != nil || v != tt.v {
+			t.Errorf("decoding % x = %d, %v; want %d", got, v, err, tt.v)
+		}
+	}
+}
+
+func TestQPACKDecode(t *testing.T) {
+	huffman := hpack.AppendHuffmanString(nil, "nginx")
+	tests := []struct {
+		name string
+		in   []byte
+		want []qpackField
+		err  bool
+	}{
+		{
+			name: "static indexed",
+			in:   []byte{0x00, 0x00, 0xd9, 0xd1},
+			want: []qpackField{{":status", "200"}, {":method", "GET"}},
+		},
+		{
+			name: "literal with static name",
+			in:   []byte{0x00, 0x00, 0x54, 0x02, '1', '2'},
+			want: []qpackField{{"content-length", "12"}},
+		},
+		{
+			name: "literal name and value",
+			in:   []byte{0x00, 0x00, 0x23, 'f', 'o', 'o', 0x03, 'b', 'a', 'r'},
+			want: []qpackField{{"foo", "bar"}},
+		},
+		{
+			// server (index 92) with a Huffman-coded value.
+			name: "huffman value",
+			in:   append([]byte{0x00, 0x00, 0x5f, 0x4d, 0x80 | byte(len(huffman))}, huffman...),
+			want: []qpackField{{"server", "nginx"}},
+		},
+		{name: "dynamic table required", in: []byte{0x01, 0x00}, err: true},
+		{name: "dynamic indexed reference", in: []byte{0x00, 0x00, 0x81}, err: true},
+		{name: "static index out of range", in: []byte{0x00, 0x00, 0xff, 0x40}, err: true},
+		{name: "truncated literal", in: []byte{0x00, 0x00, 0x23, 'f'}, err: true},
+		{name: "empty", in: nil, err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := qpackDecode(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("qpackDecode(% x) = %v, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("qpackDecode(% x) = %v, %v; want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestQPACKEncodeRequestRoundTrip(t *testing.T) {
+	req, _ := http.NewRequest(http.MethodPost, "https://example.com/a?b=c", nil)
+	req.Header.Set("User-Agent", "sysinformer")
+	fields, err := qpackDecode(qpackEncodeRequest(req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []qpackField{
+		{":method", "POST"}, {":scheme", "https"}, {":authority", "example.com"},
+		{":path", "/a?b=c"}, {"user-agent", "sysinformer"},
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Fatalf("decoded %v, want %v", fields, want)
+	}
+}
+
+func TestReadH3FrameLimits(t *testing.T) {
+	frame := appendH3Frame(nil, h3FrameData, []byte("hello"))
+	typ, payload, err := readH3Frame(bufioReader(frame))
+	if err != nil || typ != h3FrameData || string(payload) != "hello" {
+		t.Fatalf("readH3Frame = %d, %q, %v", typ, payload, err)
+	}
+	huge := appendQUICVarint(appendQUICVarint(nil, h3FrameData), maxH3Frame+1)
+	if _, _, err := readH3Frame(bufioReader(huge)); err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("oversized frame: err = %v, want a size error", err)
+	}
+}
+
+func bufioReader(b []byte) *bufio.Reader {
+	return bufio.NewReader(bytes.NewReader(b))
+}
@@ -0,0 +1,313 @@
+package sysinformer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// altSvc is one alternative service advertised in an Alt-Svc header.
+type altSvc struct {
+	Protocol  string // ALPN id, e.g. h3
+	Authority string // [host]:port, host empty for the same host
+	MaxAge    string
+}
+
+// parseAltSvc parses an Alt-Svc header value (RFC 7838). "clear" yields no entries.
+func parseAltSvc(v string) []altSvc {
+	var out []altSvc
+	for _, entry := range strings.Split(v, ",") {
+		params := strings.Split(entry, ";")
+		proto, authority, ok := strings.Cut(strings.TrimSpace(params[0]), "=")
+		if !ok {
+			continue
+		}
+		svc := altSvc{Protocol: proto, Authority: strings.Trim(authority, `"`)}
+		for _, p := range params[1:] {
+			if k, val, ok := strings.Cut(strings.TrimSpace(p), "="); ok && strings.EqualFold(k, "ma") {
+				svc.MaxAge = val
+			}
+		}
+		out = append(out, svc)
+	}
+	return out
+}
+
+// protoMeasurement is what one protocol's requests measured.
+type protoMeasurement struct {
+	Protocol  string
+	Result    string
+	Verdict   string
+	Status    int
+	Handshake time.Duration // connect + TLS (or QUIC) handshake
+	TTFB      time.Duration
+	Total     time.Duration
+	AltSvc    string
+}
+
+func (m protoMeasurement) row() []string {
+	row := []string{m.Protocol, "-", "-", "-", "-", truncateForDisplay(m.Result, 60), colorVerdict(m.Verdict)}
+	if m.Status != 0 {
+		row[1] = strconv.Itoa(m.Status)
+		row[2] = formatMs(m.Handshake)
+		row[3] = formatMs(m.TTFB)
+		row[4] = formatMs(m.Total)
+	}
+	return row
+}
+
+// measureTCPProtocol times count requests forced to HTTP/1.1 or attempting HTTP/2 and
+// averages their phases.
+func measureTCPProtocol(targetURL string, count int, timeout time.Duration, reqOpts HTTPRequestOptions, h2 bool) protoMeasurement {
+	m := protoMeasurement{Protocol: "HTTP/1.1"}
+	if h2 {
+		m.Protocol = "HTTP/2"
+	}
+	tr, err := reqOpts.transport(false)
+	if err != nil {
+		m.Result, m.Verdict = err.Error(), VerdictFail
+		return m
+	}
+	if !h2 {
+		// A non-nil empty TLSNextProto map turns HTTP/2 off.
+		tr.ForceAttemptHTTP2 = false
+		tr.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		tr.TLSClientConfig.NextProtos = []string{"http/1.1"}
+	}
+	client := &http.Client{Timeout: timeout, Transport: tr}
+
+	var timings []httpTiming
+	var lastErr error
+	for i := 0; i < count; i++ {
+		req, err := reqOpts.request(targetURL)
+		if err != nil {
+			lastErr = err
+			break
+		}
+		t, resp, err := timedRequest(client, req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if h2 && resp.ProtoMajor != 2 {
+			m.Result, m.Verdict = "not served ("+resp.Proto+" negotiated)", VerdictWarn
+			return m
+		}
+		m.Status = resp.StatusCode
+		m.AltSvc = resp.Header.Get("Alt-Svc")
+		timings = append(timings, t)
+	}
+	if len(timings) == 0 {
+		m.Result, m.Verdict = fmt.Sprintf("failed: %v", lastErr), VerdictFail
+		return m
+	}
+	avg := averageTiming(timings)
+	m.Handshake, m.TTFB, m.Total = avg.Connect+avg.TLS, avg.TTFB, avg.Total
+	m.Result, m.Verdict = "served", VerdictPass
+	return m
+}
+
+func averageTiming(timings []httpTiming) httpTiming {
+	var sum httpTiming
+	for _, t := range timings {
+		sum.DNS += t.DNS
+		sum.Connect += t.Connect
+		sum.TLS += t.TLS
+		sum.TTFB += t.TTFB
+		sum.Transfer += t.Transfer
+		sum.Total += t.Total
+	}
+	n := time.Duration(len(timings))
+	return httpTiming{DNS: sum.DNS / n, Connect: sum.Connect / n, TLS: sum.TLS / n, TTFB: sum.TTFB / n, Transfer: sum.Transfer / n, Total: sum.Total / n}
+}
+
+// measureHTTP3 times count HTTP/3 requests to the QUIC endpoint at authority (host:port).
+func measureHTTP3(targetURL, authority string, count int, timeout time.Duration, reqOpts HTTPRequestOptions) protoMeasurement {
+	m := protoMeasurement{Protocol: "HTTP/3"}
+	u, _ := url.Parse(targetURL)
+	tr, err := reqOpts.transport(false)
+	if err != nil {
+		m.Result, m.Verdict = err.Error(), VerdictFail
+		return m
+	}
+	tlsConf := tr.TLSClientConfig.Clone()
+	tlsConf.ServerName = u.Hostname()
+
+	var results []*http3Result
+	var lastErr error
+	for i := 0; i < count; i++ {
+		req, err := reqOpts.request(targetURL)
+		if err != nil {
+			lastErr = err
+			break
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		res, err := http3Request(ctx, reqOpts.dialAddr(authority), tlsConf, req, reqOpts.Body)
+		cancel()
+		if err != nil {
+			// QUIC that fails once (blocked UDP, no listener) fails every time.
+			lastErr = err
+			break
+		}
+		results = append(results, res)
+	}
+	if len(results) == 0 {
+		m.Result, m.Verdict = fmt.Sprintf("failed: %v", lastErr), VerdictFail
+		return m
+	}
+	for _, r := range results {
+		m.Handshake += r.Handshake
+		m.TTFB += r.TTFB
+		m.Total += r.Total
+	}
+	n := time.Duration(len(results))
+	m.Handshake, m.TTFB, m.Total = m.Handshake/n, m.TTFB/n, m.Total/n
+	m.Status = results[len(results)-1].Status
+	m.Result, m.Verdict = "served", VerdictPass
+	return m
+}
+
+// httpsTarget returns the URL to compare protocols on. ALPN and HTTP/2 need TLS, but a bare
+// target is normalised to http://, so an http target's redirect to https is followed, or else
+// https is tried on port 443 of the same host. The note says which happened; the http target
+// is kept when neither works.
+func httpsTarget(u *url.URL, timeout time.Duration, reqOpts HTTPRequestOptions) (*url.URL, string) {
+	if u.Scheme != "http" {
+		return u, ""
+	}
+	if client, err := reqOpts.client(timeout, false); err == nil {
+		if req, err := reqOpts.newRequest(http.MethodGet, u.String(), nil); err == nil {
+			if resp, err := client.Do(req); err == nil {
+				resp.Body.Close()
+				if final := resp.Request.URL; final.Scheme == "https" {
+					return final, "following the redirect to " + final.String()
+				}
+			}
+		}
+	}
+	alt := *u
+	alt.Scheme, alt.Host = "https", u.Hostname()
+	if strings.Contains(alt.Host, ":") {
+		alt.Host = "[" + alt.Host + "]"
+	}
+	ep := tlsEndpoint{Addr: reqOpts.dialAddr(net.JoinHostPort(u.Hostname(), "443")), ServerName: u.Hostname()}
+	if _, ok := tlsProbe(ep, timeout, &tls.Config{}); ok {
+		return &alt, "no redirect to https; checking " + alt.String()
+	}
+	return u, "no https endpoint found; ALPN and HTTP/2 need TLS"
+}
+
+// CheckHTTPProtocols reports the ALPN protocol the server picks, whether it serves HTTP/2,
+// what its Alt-Svc header advertises and, with tryHTTP3, whether HTTP/3 actually works,
+// comparing the average handshake, TTFB and total time of each protocol.
+func CheckHTTPProtocols(targetURL string, count int, timeout time.Duration, reqOpts HTTPRequestOptions, tryHTTP3 bool) {
+	fmt.Println("")
+	PrintSectionHeader("HTTP PROTOCOLS")
+
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		fmt.Printf("Invalid URL: %v\n", err)
+		return
+	}
+	u, note := httpsTarget(u, timeout, reqOpts)
+	if note != "" {
+		fmt.Printf("Target is http; %s\n", note)
+	}
+	targetURL = u.String()
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	authority := net.JoinHostPort(u.Hostname(), port)
+	secure := u.Scheme == "https"
+
+	info := [][]string{}
+	if secure {
+		ep := tlsEndpoint{Addr: reqOpts.dialAddr(authority), ServerName: u.Hostname()}
+		state, ok := tlsProbe(ep, timeout, &tls.Config{NextProtos: []string{"h2", "http/1.1"}})
+		switch {
+		case !ok:
+			info = append(info, []string{"ALPN", "TLS handshake failed"})
+		case state.NegotiatedProtocol == "":
+			info = append(info, []string{"ALPN", "offered h2, http/1.1; server selected none"})
+		default:
+			info = append(info, []string{"ALPN", "offered h2, http/1.1; server selected " + state.NegotiatedProtocol})
+		}
+	}
+
+	results := []protoMeasurement{measureTCPProtocol(targetURL, count, timeout, reqOpts, false)}
+	if secure {
+		results = append(results, measureTCPProtocol(targetURL, count, timeout, reqOpts, true))
+	} else {
+		results = append(results, protoMeasurement{Protocol: "HTTP/2", Result: "not tried over plain HTTP (h2c)", Verdict: VerdictInfo})
+	}
+
+	altSvcHeader := ""
+	for _, r := range results {
+		if r.AltSvc != "" {
+			altSvcHeader = r.AltSvc
+		}
+	}
+	var h3 *altSvc
+	if altSvcHeader != "" {
+		info = append(info, []string{"Alt-Svc", truncateForDisplay(altSvcHeader, 100)})
+		for _, svc := range parseAltSvc(altSvcHeader) {
+			if svc.Protocol == "h3" {
+				h3 = &svc
+				break
+			}
+		}
+	} else {
+		info = append(info, []string{"Alt-Svc", "not sent"})
+	}
+	switch {
+	case h3 != nil:
+		desc := "advertised at " + h3.Authority
+		if h3.MaxAge != "" {
+			desc += ", max age " + h3.MaxAge + "s"
+		}
+		info = append(info, []string{"HTTP/3", desc})
+	case altSvcHeader != "":
+		info = append(info, []string{"HTTP/3", "not advertised (no h3 entry)"})
+	default:
+		info = append(info, []string{"HTTP/3", "not advertised"})
+	}
+	RenderKeyValueTable("Check", "Result", info)
+
+	switch {
+	case tryHTTP3 && secure:
+		h3Authority := authority
+		if h3 != nil {
+			host, p, err := net.SplitHostPort(h3.Authority)
+			if err == nil {
+				if host == "" {
+					host = u.Hostname()
+				}
+				h3Authority = net.JoinHostPort(host, p)
+			}
+		}
+		results = append(results, measureHTTP3(targetURL, h3Authority, count, timeout, reqOpts))
+	case tryHTTP3:
+		results = append(results, protoMeasurement{Protocol: "HTTP/3", Result: "requires https", Verdict: VerdictInfo})
+	case h3 != nil:
+		results = append(results, protoMeasurement{Protocol: "HTTP/3", Result: "advertised; use --http3 to try it", Verdict: VerdictInfo})
+	}
+
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		rows = append(rows, r.row())
+	}
+	RenderTable([]string{"Protocol", "Status", "Handshake (ms)", "TTFB (ms)", "Total (ms)", "Result", "Verdict"}, rows)
+	if count > 1 {
+		fmt.Printf("Times are averages over %d requests per protocol\n", count)
+	}
+}
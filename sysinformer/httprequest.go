@@ -0,0 +1,261 @@
+package sysinformer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// HTTPRequestOptions shapes the requests sent by the latency and HTTP checks. The zero
+// value is a plain GET through the proxy from the environment.
+type HTTPRequestOptions struct {
+	Method    string   // GET when empty, POST when empty and Body is set
+	Headers   []string // "Name: value"; a Host header overrides the request host
+	BasicAuth string   // "user:password", or "user" for an empty password
+	Bearer    string   // token sent as "Authorization: Bearer <token>"
+	Body      []byte
+	UserAgent string
+	CertFile  string   // PEM client certificate for mTLS
+	KeyFile   string   // PEM key for CertFile; CertFile itself when empty
+	CAFile    string   // PEM bundle to verify the server against instead of the system roots
+	Insecure  bool     // skip verification of the server certificate
+	Proxy     string   // proxy URL, "none" to connect directly, the environment when empty
+	Resolve   []string // "host:port:ip" pins, as with curl --resolve
+}
+
+// ReadRequestBody returns the body given to --data: the text itself, or the contents of a
+// file for "@path" ("@-" reads stdin).
+func ReadRequestBody(data string) ([]byte, error) {
+	switch {
+	case data == "@-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(data[1:])
+	}
+	return []byte(data), nil
+}
+
+func (o HTTPRequestOptions) method() string {
+	switch {
+	case o.Method != "":
+		return strings.ToUpper(o.Method)
+	case o.Body != nil:
+		return http.MethodPost
+	}
+	return http.MethodGet
+}
+
+// custom reports whether the requests differ from the default GET.
+func (o HTTPRequestOptions) custom() bool {
+	return o.Method != "" || len(o.Headers) > 0 || o.BasicAuth != "" || o.Bearer != "" || o.Body != nil ||
+		o.UserAgent != "" || o.CertFile != "" || o.Insecure || o.Proxy != "" || len(o.Resolve) > 0
+}
+
+// describe summarizes a customized request for the check output, without secrets.
+func (o HTTPRequestOptions) describe() string {
+	parts := []string{o.method()}
+	if n := len(o.Headers); n > 0 {
+		parts = append(parts, fmt.Sprintf("%d extra headers", n))
+	}
+	switch {
+	case o.Bearer != "":
+		parts = append(parts, "bearer token")
+	case o.BasicAuth != "":
+		user, _, _ := strings.Cut(o.BasicAuth, ":")
+		parts = append(parts, "basic auth as "+user)
+	}
+	if o.Body != nil {
+		parts = append(parts, fmt.Sprintf("%d byte body", len(o.Body)))
+	}
+	if o.CertFile != "" {
+		parts = append(parts, "client certificate")
+	}
+	if o.Insecure {
+		parts = append(parts, "certificate not verified")
+	}
+	switch o.Proxy {
+	case "":
+	case "none":
+		parts = append(parts, "no proxy")
+	default:
+		parts = append(parts, "via "+o.Proxy)
+	}
+	for _, pin := range o.Resolve {
+		parts = append(parts, "resolve "+pin)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// parseResolvePins turns "host:port:ip" entries into a map from host:port to ip:port.
+func parseResolvePins(specs []string) (map[string]string, error) {
+	pins := map[string]string{}
+	for _, spec := range specs {
+		host, rest, ok1 := strings.Cut(spec, ":")
+		port, ip, ok2 := strings.Cut(rest, ":")
+		ip = strings.Trim(ip, "[]")
+		if !ok1 || !ok2 || host == "" || port == "" || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid --resolve %q (want host:port:ip)", spec)
+		}
+		pins[net.JoinHostPort(strings.ToLower(host), port)] = net.JoinHostPort(ip, port)
+	}
+	return pins, nil
+}
+
+// pinned reports whether requests to host are sent to an address given with --resolve.
+func (o HTTPRequestOptions) pinned(host string) bool {
+	for _, spec := range o.Resolve {
+		if h, _, _ := strings.Cut(spec, ":"); strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialAddr returns the address to connect to for authority (host:port), honouring --resolve.
+func (o HTTPRequestOptions) dialAddr(authority string) string {
+	pins, err := parseResolvePins(o.Resolve)
+	if err == nil {
+		if pinned, ok := pins[strings.ToLower(authority)]; ok {
+			return pinned
+		}
+	}
+	return authority
+}
+
+// transport builds the transport for o. Keep-alives are off when every request should pay
+// for its own DNS lookup, connect and handshake.
+func (o HTTPRequestOptions) transport(keepAlives bool) (*http.Transport, error) {
+	tlsConf := &tls.Config{InsecureSkipVerify: o.Insecure}
+	if o.CAFile != "" {
+		roots, err := loadCertPool(o.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConf.RootCAs = roots
+	}
+	if o.CertFile != "" {
+		keyFile := o.KeyFile
+		if keyFile == "" {
+			keyFile = o.CertFile
+		}
+		cert, err := tls.LoadX509KeyPair(o.CertFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		tlsConf.Certificates = []tls.Certificate{cert}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	switch o.Proxy {
+	case "":
+	case "none":
+		proxy = nil
+	default:
+		u, err := url.Parse(o.Proxy)
+		if err != nil || u.Host == "" {
+			return nil, fmt.Errorf("invalid proxy %q", o.Proxy)
+		}
+		proxy = http.ProxyURL(u)
+	}
+
+	pins, err := parseResolvePins(o.Resolve)
+	if err != nil {
+		return nil, err
+	}
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if pinned, ok := pins[strings.ToLower(addr)]; ok {
+			addr = pinned
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	return &http.Transport{
+		Proxy:               proxy,
+		DialContext:         dial,
+		TLSClientConfig:     tlsConf,
+		TLSHandshakeTimeout: 10 * time.Second,
+		ForceAttemptHTTP2:   true,
+		DisableKeepAlives:   !keepAlives,
+	}, nil
+}
+
+// client returns an HTTP client sending requests as o describes.
+func (o HTTPRequestOptions) client(timeout time.Duration, keepAlives bool) (*http.Client, error) {
+	tr, err := o.transport(keepAlives)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: timeout, Transport: tr}, nil
+}
+
+// newRequest builds a request for targetURL with o's headers, credentials and user agent.
+func (o HTTPRequestOptions) newRequest(method, targetURL string, body []byte) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequest(method, targetURL, r)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range o.Headers {
+		name, value, ok := strings.Cut(h, ":")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q (want 'Name: value')", h)
+		}
+		if strings.EqualFold(name, "Host") {
+			req.Host = value
+			continue
+		}
+		req.Header.Add(name, value)
+	}
+	if o.UserAgent != "" {
+		req.Header.Set("User-Agent", o.UserAgent)
+	}
+	switch {
+	case o.Bearer != "":
+		req.Header.Set("Authorization", "Bearer "+o.Bearer)
+	case o.BasicAuth != "":
+		user, pass, _ := strings.Cut(o.BasicAuth, ":")
+		req.SetBasicAuth(user, pass)
+	}
+	return req, nil
+}
+
+// newRequestFor is newRequest for requests that may leave host, such as redirects and
+// linked resources. o's headers, credentials and user agent are only applied when
+// targetURL is on host; elsewhere the request carries just the method and body.
+func (o HTTPRequestOptions) newRequestFor(host, method, targetURL string, body []byte) (*http.Request, error) {
+	if u, err := url.Parse(targetURL); err == nil && strings.EqualFold(u.Hostname(), host) {
+		return o.newRequest(method, targetURL, body)
+	}
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	return http.NewRequest(method, targetURL, r)
+}
+
+// request is newRequest with o's own method and body.
+func (o HTTPRequestOptions) request(targetURL string) (*http.Request, error) {
+	return o.newRequest(o.method(), targetURL, o.Body)
+}
+
+// validate reports option errors up front, before any check runs.
+func (o HTTPRequestOptions) validate() error {
+	if _, err := o.transport(false); err != nil {
+		return err
+	}
+	_, err := o.request("http://localhost/")
+	return err
+}
@@ -0,0 +1,123 @@
+package sysinformer
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// httpTiming breaks one HTTP request down into its phases. When a request is redirected
+// the phases of every hop are added together.
+type httpTiming struct {
+	DNS      time.Duration
+	Connect  time.Duration
+	TLS      time.Duration
+	TTFB     time.Duration // request written -> first response byte (server time)
+	Transfer time.Duration // first response byte -> body fully read
+	Total    time.Duration
+}
+
+var httpTimingPhases = []string{"DNS Lookup", "TCP Connect", "TLS Handshake", "TTFB", "Transfer", "Total"}
+
+func (t httpTiming) phases() []time.Duration {
+	return []time.Duration{t.DNS, t.Connect, t.TLS, t.TTFB, t.Transfer, t.Total}
+}
+
+// timedRequest sends req and records per-phase timings with httptrace. The body is read
+// and discarded so the transfer phase is included.
+func timedRequest(client *http.Client, req *http.Request) (httpTiming, *http.Response, error) {
+	var t httpTiming
+	var dnsStart, tlsStart, wrote, firstByte time.Time
+	var connMu sync.Mutex
+	connStart := map[string]time.Time{}
+	connTime := map[string]time.Duration{}
+
+	trace := &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { dnsStart = time.Now() },
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			if !dnsStart.IsZero() {
+				t.DNS += time.Since(dnsStart)
+			}
+		},
+		// Happy eyeballs dials A and AAAA addresses concurrently, so each dial is timed on
+		// its own and only the connection the request went out on is counted.
+		ConnectStart: func(network, addr string) {
+			connMu.Lock()
+			connStart[addr] = time.Now()
+			connMu.Unlock()
+		},
+		ConnectDone: func(network, addr string, err error) {
+			connMu.Lock()
+			if start, ok := connStart[addr]; ok && err == nil {
+				connTime[addr] = time.Since(start)
+			}
+			connMu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				return
+			}
+			connMu.Lock()
+			t.Connect += connTime[info.Conn.RemoteAddr().String()]
+			connMu.Unlock()
+		},
+		TLSHandshakeStart: func() { tlsStart = time.Now() },
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			if !tlsStart.IsZero() {
+				t.TLS += time.Since(tlsStart)
+			}
+		},
+		WroteRequest: func(httptrace.WroteRequestInfo) { wrote = time.Now() },
+		GotFirstResponseByte: func() {
+			firstByte = time.Now()
+			if !wrote.IsZero() {
+				t.TTFB += firstByte.Sub(wrote)
+			}
+		},
+	}
+
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		return t, nil, err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	end := time.Now()
+	if !firstByte.IsZero() {
+		t.Transfer = end.Sub(firstByte)
+	}
+	t.Total = end.Sub(start)
+	return t, resp, nil
+}
+
+func formatMs(d time.Duration) string {
+	return fmt.Sprintf("%.1f", float64(d.Microseconds())/1000)
+}
+
+// phaseSummaryRows returns min/avg/max rows for every phase across timings.
+func phaseSummaryRows(timings []httpTiming) [][]string {
+	rows := make([][]string, 0, len(httpTimingPhases))
+	for i, name := range httpTimingPhases {
+		var min, max, total time.Duration
+		for j, t := range timings {
+			d := t.phases()[i]
+			if j == 0 || d < min {
+				min = d
+			}
+			if d > max {
+				max = d
+			}
+			total += d
+		}
+		avg := total / time.Duration(len(timings))
+		rows = append(rows, []string{name, formatMs(min), formatMs(avg), formatMs(max)})
+	}
+	return rows
+}
@@ -1,9 +1,15 @@
 package sysinformer
 
 import (
+	"bufio"
 	"context"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
@@ -12,6 +18,17 @@ import (
 
 const LATENCY_TIMEOUT = 3 * time.Second
 
+// Probe methods supported by latency targets.
+const (
+	LatencyMethodAuto  = "auto"  // curl with ping fallback
+	LatencyMethodHTTP  = "http"  // HTTP GET round trip
+	LatencyMethodHTTPS = "https" // HTTPS GET round trip
+	LatencyMethodTCP   = "tcp"   // TCP connect time
+	LatencyMethodPing  = "ping"  // single ICMP echo via system ping
+)
+
+const defaultLatencyGroup = "internet"
+
 var hosts = []string{
 	"github.com",
 	"google.com",
@@ -20,13 +37,237 @@ var hosts = []string{
 	"microsoft.com",
 }
 
-func checkPing(host string) (string, error) {
+// LatencyTarget is a single endpoint probed by the latency section.
+type LatencyTarget struct {
+	Host   string
+	Port   int
+	Method string
+}
+
+// LatencyTargetGroup is a named set of targets reported together.
+type LatencyTargetGroup struct {
+	Name    string
+	Targets []LatencyTarget
+}
+
+type latencyResult struct {
+	Group   string
+	Target  LatencyTarget
+	Latency string
+}
+
+func defaultLatencyGroups() []LatencyTargetGroup {
+	g := LatencyTargetGroup{Name: defaultLatencyGroup}
+	for _, h := range hosts {
+		g.Targets = append(g.Targets, LatencyTarget{Host: h, Method: LatencyMethodAuto})
+	}
+	return []LatencyTargetGroup{g}
+}
+
+// defaultLatencyConfigPath returns the config file consulted when no targets are given.
+func defaultLatencyConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "sysinformer", "latency-targets.conf")
+}
+
+// LoadLatencyTargets resolves the target groups to probe. spec may be a path to a
+// config file or an inline definition such as
+// "internet=github.com:443/https,google.com;k8s-api=10.0.0.1:6443/tcp".
+// An empty spec falls back to the default config file, then to the built-in hosts.
+func LoadLatencyTargets(spec string) ([]LatencyTargetGroup, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		path := defaultLatencyConfigPath()
+		if path == "" {
+			return defaultLatencyGroups(), nil
+		}
+		if _, err := os.Stat(path); err != nil {
+			return defaultLatencyGroups(), nil
+		}
+		spec = path
+	}
+
+	if fi, err := os.Stat(spec); err == nil && !fi.IsDir() {
+		f, err := os.Open(spec)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return parseLatencyConfig(f)
+	}
+	return parseLatencyTargetSpec(spec)
+}
+
+// parseLatencyConfig reads the file format:
+//
+//	[internet]
+//	github.com:443 https
+//	google.com
+//
+//	[datacenter]
+//	10.0.0.1:22 tcp
+func parseLatencyConfig(r io.Reader) ([]LatencyTargetGroup, error) {
+	var groups []LatencyTargetGroup
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		l := strings.TrimSpace(scanner.Text())
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if strings.HasPrefix(l, "[") && strings.HasSuffix(l, "]") {
+			name := strings.TrimSpace(l[1 : len(l)-1])
+			if name == "" {
+				return nil, fmt.Errorf("line %d: empty group name", lineNo)
+			}
+			if seen[name] {
+				return nil, fmt.Errorf("line %d: duplicate group %q", lineNo, name)
+			}
+			seen[name] = true
+			groups = append(groups, LatencyTargetGroup{Name: name})
+			continue
+		}
+		fields := strings.Fields(l)
+		method := ""
+		if len(fields) > 1 {
+			method = fields[1]
+		}
+		t, err := parseLatencyTarget(fields[0], method)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if len(groups) == 0 {
+			seen[defaultLatencyGroup] = true
+			groups = append(groups, LatencyTargetGroup{Name: defaultLatencyGroup})
+		}
+		groups[len(groups)-1].Targets = append(groups[len(groups)-1].Targets, t)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nonEmptyLatencyGroups(groups)
+}
+
+// parseLatencyTargetSpec parses "group=host[:port][/method],...;group=...".
+// The "group=" prefix is optional for a single group.
+func parseLatencyTargetSpec(spec string) ([]LatencyTargetGroup, error) {
+	var groups []LatencyTargetGroup
+	seen := map[string]bool{}
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name := defaultLatencyGroup
+		if i := strings.Index(part, "="); i >= 0 {
+			name = strings.TrimSpace(part[:i])
+			part = part[i+1:]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("empty group name in %q", spec)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate group %q in %q", name, spec)
+		}
+		seen[name] = true
+		g := LatencyTargetGroup{Name: name}
+		for _, entry := range strings.Split(part, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			method := ""
+			if i := strings.LastIndex(entry, "/"); i >= 0 {
+				method = entry[i+1:]
+				entry = entry[:i]
+			}
+			t, err := parseLatencyTarget(entry, method)
+			if err != nil {
+				return nil, err
+			}
+			g.Targets = append(g.Targets, t)
+		}
+		groups = append(groups, g)
+	}
+	return nonEmptyLatencyGroups(groups)
+}
+
+func parseLatencyTarget(hostPort string, method string) (LatencyTarget, error) {
+	t := LatencyTarget{Host: hostPort, Method: strings.ToLower(strings.TrimSpace(method))}
+	if h, p, err := net.SplitHostPort(hostPort); err == nil {
+		port, err := strconv.Atoi(p)
+		if err != nil || port <= 0 || port > 65535 {
+			return LatencyTarget{}, fmt.Errorf("invalid port in %q", hostPort)
+		}
+		t.Host = h
+		t.Port = port
+	}
+	if t.Host == "" {
+		return LatencyTarget{}, fmt.Errorf("missing host in %q", hostPort)
+	}
+	switch t.Method {
+	case "":
+		t.Method = LatencyMethodAuto
+	case LatencyMethodAuto, LatencyMethodHTTP, LatencyMethodHTTPS, LatencyMethodPing:
+	case LatencyMethodTCP:
+		if t.Port == 0 {
+			return LatencyTarget{}, fmt.Errorf("tcp probe for %q requires a port", t.Host)
+		}
+	default:
+		return LatencyTarget{}, fmt.Errorf("unknown probe method %q for %q", method, t.Host)
+	}
+	return t, nil
+}
+
+func nonEmptyLatencyGroups(groups []LatencyTargetGroup) ([]LatencyTargetGroup, error) {
+	out := groups[:0]
+	for _, g := range groups {
+		if len(g.Targets) > 0 {
+			out = append(out, g)
+		}
+	}
+	if len(out) == 0 {
+		return nil, fmt.Errorf("no latency targets defined")
+	}
+	return out, nil
+}
+
+func (t LatencyTarget) address() string {
+	if t.Port == 0 {
+		return t.Host
+	}
+	return net.JoinHostPort(t.Host, strconv.Itoa(t.Port))
+}
+
+func (t LatencyTarget) url(scheme string) string {
+	return fmt.Sprintf("%s://%s", scheme, t.address())
+}
+
+func checkTarget(t LatencyTarget) (string, error) {
+	switch t.Method {
+	case LatencyMethodHTTP, LatencyMethodHTTPS:
+		return checkHTTPLatency(t.url(t.Method))
+	case LatencyMethodTCP:
+		return checkTCPLatency(t.address())
+	case LatencyMethodPing:
+		return checkICMPLatency(t.Host)
+	default:
+		return checkPing(t)
+	}
+}
+
+func checkPing(t LatencyTarget) (string, error) {
 	// Create context with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), LATENCY_TIMEOUT)
 	defer cancel()
 
 	// Try curl first as it's more reliable
-	curlCmd := exec.CommandContext(ctx, "curl", "-o", "/dev/null", "-s", "-w", "%{time_total}", fmt.Sprintf("https://%s", host))
+	curlCmd := exec.CommandContext(ctx, "curl", "-o", "/dev/null", "-s", "-w", "%{time_total}", t.url("https"))
 	curlOutput, err := curlCmd.Output()
 	if err == nil {
 		latency, err := strconv.ParseFloat(strings.TrimSpace(string(curlOutput)), 64)
@@ -36,6 +277,13 @@ func checkPing(host string) (string, error) {
 	}
 
 	// If curl fails, try ping
+	return checkICMPLatency(t.Host)
+}
+
+func checkICMPLatency(host string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), LATENCY_TIMEOUT)
+	defer cancel()
+
 	cmd := exec.CommandContext(ctx, "ping", "-c", "1", "-W", "2", host)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -58,6 +306,32 @@ func checkPing(host string) (string, error) {
 	return "Timeout", fmt.Errorf("could not parse ping output")
 }
 
+func checkHTTPLatency(targetURL string) (string, error) {
+	client := &http.Client{Timeout: LATENCY_TIMEOUT}
+	start := time.Now()
+	resp, err := client.Get(targetURL)
+	if err != nil {
+		return "Timeout", err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	return formatLatency(time.Since(start)), nil
+}
+
+func checkTCPLatency(address string) (string, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, LATENCY_TIMEOUT)
+	if err != nil {
+		return "Timeout", err
+	}
+	conn.Close()
+	return formatLatency(time.Since(start)), nil
+}
+
+func formatLatency(d time.Duration) string {
+	return fmt.Sprintf("%.2f ms", float64(d.Microseconds())/1000)
+}
+
 func calculateAverageLatency(pingResults [][]string) float64 {
 	var total float64
 	var count int
@@ -79,70 +353,98 @@ func calculateAverageLatency(pingResults [][]string) float64 {
 	return total / float64(count)
 }
 
-func performPing(hosts []string) [][]string {
+func performPing(groups []LatencyTargetGroup) []latencyResult {
 	var wg sync.WaitGroup
-	var mu sync.Mutex
-	var pingResults [][]string
-
-	// Create a channel to collect results
-	resultChan := make(chan []string, len(hosts))
-
-	// Start a goroutine for each host
-	for _, host := range hosts {
-		wg.Add(1)
-		go func(h string) {
-			defer wg.Done()
-			latency, err := checkPing(h)
-			if err != nil {
-				latency = "Timeout"
-			}
-			resultChan <- []string{h, latency}
-		}(host)
+	var results []latencyResult
+	for _, g := range groups {
+		for range g.Targets {
+			results = append(results, latencyResult{})
+		}
 	}
 
-	// Close result channel when all goroutines are done
-	go func() {
-		wg.Wait()
-		close(resultChan)
-	}()
-
-	// Collect results as they come in
-	for result := range resultChan {
-		if result[1] != "Timeout" {
-			mu.Lock()
-			pingResults = append(pingResults, result)
-			mu.Unlock()
+	// Start a goroutine for each target; each writes only its own slot so the
+	// configured ordering is preserved without extra locking.
+	i := 0
+	for _, g := range groups {
+		for _, t := range g.Targets {
+			wg.Add(1)
+			go func(slot int, group string, t LatencyTarget) {
+				defer wg.Done()
+				latency, err := checkTarget(t)
+				if err != nil {
+					latency = "Timeout"
+				}
+				results[slot] = latencyResult{Group: group, Target: t, Latency: latency}
+			}(i, g.Name, t)
+			i++
 		}
 	}
+	wg.Wait()
 
-	return pingResults
+	return results
 }
 
-func PrintLatencyInfo() {
+// PrintLatencyInfo probes the target groups described by spec (see LoadLatencyTargets).
+func PrintLatencyInfo(spec string) {
 	fmt.Println("") // Add space before section
 	// headers and data preparation logic remains
 
 	PrintSectionHeader("===== Latency Information =====")
 
+	groups, err := LoadLatencyTargets(spec)
+	if err != nil {
+		fmt.Println("Error loading latency targets:", err)
+		return
+	}
+
 	// Perform ping tests concurrently
-	pingResults := performPing(hosts)
+	results := performPing(groups)
+
+	headers := []string{"Group", "Host", "Port", "Method", "Latency (ms)"}
+	var data [][]string
+	var reachable [][]string
+	groupResults := map[string][][]string{}
+	for _, r := range results {
+		port := "-"
+		if r.Target.Port != 0 {
+			port = strconv.Itoa(r.Target.Port)
+		}
+		data = append(data, []string{r.Group, r.Target.Host, port, r.Target.Method, r.Latency})
+		pair := []string{r.Target.Host, r.Latency}
+		groupResults[r.Group] = append(groupResults[r.Group], pair)
+		if r.Latency != "Timeout" {
+			reachable = append(reachable, pair)
+		}
+	}
 
 	// Print warning if no results
-	if len(pingResults) == 0 {
+	if len(reachable) == 0 {
 		fmt.Println("Warning: No latency information available (all hosts timed out)")
 		return
 	}
+	RenderTable(headers, data)
 
-	// Calculate average latency
-	avgLatency := calculateAverageLatency(pingResults)
-
-	headers := []string{"Host", "Latency (ms)"}
-	var data [][]string
-	for _, result := range pingResults {
-		row := []string{result[0], result[1]}
-		data = append(data, row)
+	if len(groups) > 1 {
+		summary := [][]string{}
+		for _, g := range groups {
+			avg := calculateAverageLatency(groupResults[g.Name])
+			avgStr := "N/A"
+			if avg > 0 {
+				avgStr = fmt.Sprintf("%.2f", avg)
+			}
+			up := 0
+			for _, r := range groupResults[g.Name] {
+				if r[1] != "Timeout" {
+					up++
+				}
+			}
+			summary = append(summary, []string{g.Name, fmt.Sprintf("%d/%d", up, len(g.Targets)), avgStr})
+		}
+		RenderTable([]string{"Group", "Reachable", "Average (ms)"}, summary)
 	}
-	RenderTable(headers, data)
+
+	// Calculate average latency
+	avgLatency := calculateAverageLatency(reachable)
 	fmt.Printf("Average Round-Trip Delay: %.2f ms\n", avgLatency)
 
 }
@@ -0,0 +1,24 @@
+package sysinformer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseLatencyConfigDuplicateGroups(t *testing.T) {
+	for _, cfg := range []string{
+		"[web]\nexample.com\n[web]\nexample.org\n",
+		"example.com\n[internet]\nexample.org\n",
+	} {
+		if _, err := parseLatencyConfig(strings.NewReader(cfg)); err == nil || !strings.Contains(err.Error(), "duplicate group") {
+			t.Errorf("parseLatencyConfig(%q) error = %v, want duplicate group", cfg, err)
+		}
+	}
+	groups, err := parseLatencyConfig(strings.NewReader("[web]\nexample.com\n[dns]\n1.1.1.1:53\n"))
+	if err != nil || len(groups) != 2 {
+		t.Errorf("distinct groups: got %v, %v", groups, err)
+	}
+	if _, err := parseLatencyTargetSpec("web=example.com;web=example.org"); err == nil {
+		t.Error("parseLatencyTargetSpec accepted a duplicate group")
+	}
+}
@@ -0,0 +1,307 @@
+package sysinformer
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+)
+
+// mmdbReader is a minimal reader for MaxMind DB (.mmdb) files, enough to look up the
+// record for an address in ASN/country databases without pulling in a dependency.
+type mmdbReader struct {
+	buf        []byte
+	nodeCount  uint
+	recordSize uint
+	ipVersion  uint
+	treeSize   uint
+	dataStart  uint
+	ipv4Start  uint
+}
+
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+var errMMDBCorrupt = errors.New("mmdb: corrupt database")
+
+// mmdbMaxDepth bounds how deeply maps and arrays may nest, so that a corrupt or hostile
+// file cannot exhaust the stack.
+const mmdbMaxDepth = 64
+
+func openMMDB(path string) (*mmdbReader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if i < 0 {
+		return nil, fmt.Errorf("%s: not a MaxMind DB file", path)
+	}
+	r := &mmdbReader{buf: buf}
+	metaStart := uint(i + len(mmdbMetadataMarker))
+	meta, _, err := r.decode(metaStart, metaStart)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	m, ok := meta.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s: invalid metadata", path)
+	}
+	r.nodeCount = uint(toUint64(m["node_count"]))
+	r.recordSize = uint(toUint64(m["record_size"]))
+	r.ipVersion = uint(toUint64(m["ip_version"]))
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("%s: unsupported record size %d", path, r.recordSize)
+	}
+	r.treeSize = r.recordSize * 2 / 8 * r.nodeCount
+	r.dataStart = r.treeSize + 16
+	if r.dataStart > uint(len(buf)) {
+		return nil, fmt.Errorf("%s: %v", path, errMMDBCorrupt)
+	}
+
+	// IPv4 addresses live under ::/96 in IPv6 trees.
+	if r.ipVersion == 6 {
+		node := uint(0)
+		for i := 0; i < 96 && node < r.nodeCount; i++ {
+			node, err = r.readNode(node, 0)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+func (r *mmdbReader) readNode(node uint, bit uint) (uint, error) {
+	off := node * r.recordSize * 2 / 8
+	if off+r.recordSize*2/8 > r.treeSize {
+		return 0, errMMDBCorrupt
+	}
+	b := r.buf[off:]
+	switch r.recordSize {
+	case 24:
+		if bit == 0 {
+			return uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return uint(b[3])<<16 | uint(b[4])<<8 | uint(b[5]), nil
+	case 28:
+		if bit == 0 {
+			return (uint(b[3])&0xF0)<<20 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]), nil
+		}
+		return (uint(b[3])&0x0F)<<24 | uint(b[4])<<16 | uint(b[5])<<8 | uint(b[6]), nil
+	default:
+		if bit == 0 {
+			return uint(binary.BigEndian.Uint32(b[0:4])), nil
+		}
+		return uint(binary.BigEndian.Uint32(b[4:8])), nil
+	}
+}
+
+// lookup returns the decoded record for ip, or nil if the database has no entry.
+func (r *mmdbReader) lookup(ip net.IP) (interface{}, error) {
+	bits := ip.To4()
+	node := uint(0)
+	if bits != nil {
+		if r.ipVersion == 6 {
+			node = r.ipv4Start
+		}
+	} else {
+		if r.ipVersion == 4 {
+			return nil, nil
+		}
+		bits = ip.To16()
+		if bits == nil {
+			return nil, nil
+		}
+	}
+	for i := 0; i < len(bits)*8 && node < r.nodeCount; i++ {
+		bit := uint(bits[i/8]>>(7-uint(i%8))) & 1
+		var err error
+		node, err = r.readNode(node, bit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if node == r.nodeCount {
+		return nil, nil
+	}
+	if node < r.nodeCount {
+		return nil, errMMDBCorrupt
+	}
+	off := r.dataStart + (node - r.nodeCount - 16)
+	v, _, err := r.decode(off, r.dataStart)
+	return v, err
+}
+
+// decode reads the value at off. base is the start of the section that pointers are
+// relative to. It returns the value and the offset just past it.
+func (r *mmdbReader) decode(off uint, base uint) (interface{}, uint, error) {
+	return r.decodeAt(off, base, 0)
+}
+
+func (r *mmdbReader) decodeAt(off uint, base uint, depth int) (interface{}, uint, error) {
+	if off >= uint(len(r.buf)) || depth > mmdbMaxDepth {
+		return nil, 0, errMMDBCorrupt
+	}
+	ctrl := r.buf[off]
+	off++
+	typ := uint(ctrl >> 5)
+
+	if typ == 1 { // pointer
+		ss := (ctrl >> 3) & 0x3
+		v := uint(ctrl & 0x7)
+		n := uint(ss) + 1
+		if off+n > uint(len(r.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		b := r.buf[off : off+n]
+		var p uint
+		switch ss {
+		case 0:
+			p = v<<8 | uint(b[0])
+		case 1:
+			p = (v<<16 | uint(b[0])<<8 | uint(b[1])) + 2048
+		case 2:
+			p = (v<<24 | uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2])) + 526336
+		default:
+			p = uint(binary.BigEndian.Uint32(b))
+		}
+		// The format forbids a pointer to a pointer; following one could loop forever.
+		target := base + p
+		if target >= uint(len(r.buf)) || r.buf[target]>>5 == 1 {
+			return nil, 0, errMMDBCorrupt
+		}
+		val, _, err := r.decodeAt(target, base, depth+1)
+		return val, off + n, err
+	}
+
+	if typ == 0 { // extended
+		if off >= uint(len(r.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		typ = 7 + uint(r.buf[off])
+		off++
+	}
+
+	size := uint(ctrl & 0x1f)
+	if size >= 29 {
+		n := size - 28
+		if off+n > uint(len(r.buf)) {
+			return nil, 0, errMMDBCorrupt
+		}
+		b := r.buf[off : off+n]
+		switch n {
+		case 1:
+			size = 29 + uint(b[0])
+		case 2:
+			size = 285 + (uint(b[0])<<8 | uint(b[1]))
+		default:
+			size = 65821 + (uint(b[0])<<16 | uint(b[1])<<8 | uint(b[2]))
+		}
+		off += n
+	}
+
+	// Every map entry takes at least two bytes and every array element one, so a size
+	// beyond the bytes left is corrupt and must not drive an allocation.
+	remaining := uint(len(r.buf)) - off
+	switch typ {
+	case 7: // map
+		if size > remaining/2 {
+			return nil, 0, errMMDBCorrupt
+		}
+		m := make(map[string]interface{}, size)
+		for i := uint(0); i < size; i++ {
+			k, next, err := r.decodeAt(off, base, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			v, next2, err := r.decodeAt(next, base, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			ks, _ := k.(string)
+			m[ks] = v
+			off = next2
+		}
+		return m, off, nil
+	case 11: // array
+		if size > remaining {
+			return nil, 0, errMMDBCorrupt
+		}
+		a := make([]interface{}, 0, size)
+		for i := uint(0); i < size; i++ {
+			v, next, err := r.decodeAt(off, base, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			off = next
+		}
+		return a, off, nil
+	case 14: // boolean
+		return size != 0, off, nil
+	}
+
+	if off+size > uint(len(r.buf)) {
+		return nil, 0, errMMDBCorrupt
+	}
+	b := r.buf[off : off+size]
+	off += size
+	switch typ {
+	case 2: // utf8 string
+		return string(b), off, nil
+	case 3: // double
+		if size != 8 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), off, nil
+	case 4: // bytes
+		return append([]byte(nil), b...), off, nil
+	case 5, 6, 9, 10: // unsigned ints (uint128 is truncated to 64 bits)
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, off, nil
+	case 8: // int32
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return uint64(int32(v)), off, nil
+	case 15: // float
+		if size != 4 {
+			return nil, 0, errMMDBCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), off, nil
+	}
+	return nil, off, nil
+}
+
+func toUint64(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case float64:
+		return uint64(n)
+	}
+	return 0
+}
+
+// mmdbString walks nested maps (e.g. "country", "iso_code") and returns the string found.
+func mmdbString(v interface{}, path ...string) string {
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		v = m[p]
+	}
+	s, _ := v.(string)
+	return s
+}
@@ -0,0 +1,43 @@
+package sysinformer
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMMDBDecodeRejectsHostileData(t *testing.T) {
+	tests := []struct {
+		name string
+		buf  []byte
+	}{
+		// A pointer (type 1, size 0) to offset 0, which is the pointer itself.
+		{"self pointer", []byte{0x20, 0x00}},
+		// A map holding one entry whose value points back to the map.
+		{"map pointing to itself", []byte{0xe1, 0x41, 'k', 0x20, 0x00}},
+		// A map claiming 16M entries in a five-byte buffer.
+		{"oversized map", []byte{0xff, 0xff, 0xff, 0xff, 0x00}},
+		// An array (extended type 4) claiming 16M elements.
+		{"oversized array", []byte{0x1f, 0x04, 0xff, 0xff, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &mmdbReader{buf: tt.buf}
+			if _, _, err := r.decode(0, 0); !errors.Is(err, errMMDBCorrupt) {
+				t.Fatalf("decode error = %v, want errMMDBCorrupt", err)
+			}
+		})
+	}
+}
+
+func TestMMDBDecodeMap(t *testing.T) {
+	// {"a": "b"}
+	r := &mmdbReader{buf: []byte{0xe1, 0x41, 'a', 0x41, 'b'}}
+	v, next, err := r.decode(0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok || m["a"] != "b" || next != 5 {
+		t.Fatalf("decode = %#v, %d", v, next)
+	}
+}
@@ -0,0 +1,293 @@
+package sysinformer
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+const MTR_INTERVAL = 1 * time.Second
+
+// MTRHop holds the accumulated statistics for one hop of the path. Latencies are in ms.
+type MTRHop struct {
+	Hop      int     `json:"hop"`
+	IP       string  `json:"ip"`
+	Hostname string  `json:"hostname"`
+	Sent     int     `json:"sent"`
+	Received int     `json:"received"`
+	Loss     float64 `json:"loss_pct"`
+	Last     float64 `json:"last_ms"`
+	Avg      float64 `json:"avg_ms"`
+	Best     float64 `json:"best_ms"`
+	Worst    float64 `json:"worst_ms"`
+	StDev    float64 `json:"stdev_ms"`
+
+	sum   float64
+	sumSq float64
+}
+
+// MTRReport is the result of an MTR run and is what gets exported as JSON.
+type MTRReport struct {
+	Target    string    `json:"target"`
+	Cycles    int       `json:"cycles"`
+	StartedAt time.Time `json:"started_at"`
+	Hops      []*MTRHop `json:"hops"`
+}
+
+func (h *MTRHop) record(ms float64, ok bool) {
+	h.Sent++
+	if ok {
+		h.Received++
+		h.Last = ms
+		if h.Received == 1 || ms < h.Best {
+			h.Best = ms
+		}
+		if ms > h.Worst {
+			h.Worst = ms
+		}
+		h.sum += ms
+		h.sumSq += ms * ms
+		n := float64(h.Received)
+		h.Avg = h.sum / n
+		if variance := h.sumSq/n - h.Avg*h.Avg; variance > 0 {
+			h.StDev = math.Sqrt(variance)
+		} else {
+			h.StDev = 0
+		}
+	}
+	h.Loss = float64(h.Sent-h.Received) / float64(h.Sent) * 100
+}
+
+func (h *MTRHop) row() []string {
+	if h.Received == 0 {
+		return []string{strconv.Itoa(h.Hop), h.Hostname, fmt.Sprintf("%.1f%%", h.Loss), strconv.Itoa(h.Sent), "-", "-", "-", "-", "-"}
+	}
+	return []string{
+		strconv.Itoa(h.Hop),
+		h.Hostname,
+		fmt.Sprintf("%.1f%%", h.Loss),
+		strconv.Itoa(h.Sent),
+		fmt.Sprintf("%.1f", h.Last),
+		fmt.Sprintf("%.1f", h.Avg),
+		fmt.Sprintf("%.1f", h.Best),
+		fmt.Sprintf("%.1f", h.Worst),
+		fmt.Sprintf("%.1f", h.StDev),
+	}
+}
+
+// discoverMTRHops finds the hops on the path to domain using a single traceroute.
+func discoverMTRHops(domain string, timeout time.Duration) ([]*MTRHop, error) {
+	rows, text, err := runTraceroute(domain, timeout)
+	if err != nil {
+		return nil, err
+	}
+	if text == "" || len(rows) == 0 {
+		return nil, fmt.Errorf("could not determine path to %s", domain)
+	}
+	hops := make([]*MTRHop, 0, len(rows))
+	for _, r := range rows {
+		n, err := strconv.Atoi(r[0])
+		if err != nil {
+			continue
+		}
+		ip := r[1]
+		if ip == "*" || ip == "N/A" {
+			ip = ""
+		}
+		hops = append(hops, &MTRHop{Hop: n, IP: ip, Hostname: r[2]})
+	}
+	return hops, nil
+}
+
+func mtrHopsFromTrace(trace []TraceHop) []*MTRHop {
+	hops := make([]*MTRHop, 0, len(trace))
+	for _, h := range trace {
+		hops = append(hops, &MTRHop{Hop: h.TTL, IP: h.IP, Hostname: h.Hostname})
+	}
+	return hops
+}
+
+// pingMTRHop probes a hop directly with the system ping. It is used when the native
+// engine cannot send TTL-limited probes.
+func pingMTRHop(h *MTRHop) (float64, bool) {
+	if h.IP == "" {
+		return 0, false
+	}
+	res, err := checkICMPLatency(h.IP)
+	if err != nil {
+		return 0, false
+	}
+	ms, err := strconv.ParseFloat(strings.TrimSuffix(res, " ms"), 64)
+	if err != nil {
+		return 0, false
+	}
+	return ms, true
+}
+
+// RunMTR repeatedly probes every hop on the path to domain. Hops are probed with
+// TTL-limited packets from the native traceroute engine, falling back to pinging the hops
+// found by the system traceroute when raw sockets are unavailable. onCycle, if set, is
+// called after each completed cycle so callers can redraw a live view.
+func RunMTR(domain string, opts TraceOptions, cycles int, timeout time.Duration, onCycle func(*MTRReport)) (*MTRReport, error) {
+	if cycles <= 0 {
+		cycles = 10
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), maxDuration(timeout, 30*time.Second))
+	defer cancel()
+
+	var hops []*MTRHop
+	probe := pingMTRHop
+	t, err := newTracer(ctx, domain, opts)
+	switch {
+	case err == nil:
+		defer t.Close()
+		trace, err := t.trace(ctx)
+		if err != nil && len(trace) == 0 {
+			return nil, err
+		}
+		hops = mtrHopsFromTrace(trace)
+		probe = func(h *MTRHop) (float64, bool) {
+			// The cycles are not bounded by the discovery deadline; each probe has its own timeout.
+			r, rtt, ok := t.probe(context.Background(), h.Hop)
+			if !ok {
+				return 0, false
+			}
+			if h.IP == "" {
+				h.IP = r.from.String()
+				h.Hostname = h.IP
+			}
+			return float64(rtt.Microseconds()) / 1000, true
+		}
+	case errors.Is(err, errRawSocketUnavailable), errors.Is(err, errTCPProbeUnsupported):
+		hops, err = discoverMTRHops(domain, timeout)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+	if len(hops) == 0 {
+		return nil, fmt.Errorf("could not determine path to %s", domain)
+	}
+	for _, h := range hops {
+		if h.Hostname == "" {
+			h.Hostname = h.IP
+		}
+		if h.IP == "" {
+			h.Hostname = "???"
+		} else if h.Hostname != h.IP {
+			h.Hostname = fmt.Sprintf("%s (%s)", h.Hostname, h.IP)
+		}
+	}
+	report := &MTRReport{Target: domain, Cycles: cycles, StartedAt: time.Now(), Hops: hops}
+
+	for c := 0; c < cycles; c++ {
+		start := time.Now()
+		var wg sync.WaitGroup
+		for _, h := range hops {
+			wg.Add(1)
+			go func(h *MTRHop) {
+				defer wg.Done()
+				ms, ok := probe(h)
+				h.record(ms, ok)
+			}(h)
+		}
+		wg.Wait()
+		if onCycle != nil {
+			onCycle(report)
+		}
+		if c < cycles-1 {
+			if wait := MTR_INTERVAL - time.Since(start); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+	}
+	return report, nil
+}
+
+func maxDuration(a, b time.Duration) time.Duration {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+var mtrHeaders = []string{"Hop", "Host", "Loss%", "Sent", "Last", "Avg", "Best", "Worst", "StDev"}
+
+func mtrRows(report *MTRReport) [][]string {
+	rows := make([][]string, 0, len(report.Hops))
+	for _, h := range report.Hops {
+		rows = append(rows, h.row())
+	}
+	return rows
+}
+
+// WriteMTRJSON writes the report as indented JSON to path ("-" for stdout).
+func WriteMTRJSON(report *MTRReport, path string) error {
+	b, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(path, b, 0o644)
+}
+
+// PrintMTR runs an MTR-style analysis, redrawing the table in place after every cycle
+// when stdout is a terminal. If jsonPath is set the final report is also written there.
+func PrintMTR(domain string, opts TraceOptions, cycles int, timeout time.Duration, jsonPath string) {
+	fmt.Println("")
+	PrintSectionHeader("MTR")
+
+	live := term.IsTerminal(int(os.Stdout.Fd()))
+	lastLines := 0
+	onCycle := func(r *MTRReport) {
+		if !live {
+			return
+		}
+		var buf bytes.Buffer
+		sent := 0
+		if len(r.Hops) > 0 {
+			sent = r.Hops[0].Sent
+		}
+		fmt.Fprintf(&buf, "Cycle %d/%d\n", sent, r.Cycles)
+		renderTableTo(&buf, mtrHeaders, mtrRows(r))
+		if lastLines > 0 {
+			// Move back over the previous frame and clear it before redrawing.
+			fmt.Printf("\033[%dA\033[J", lastLines)
+		}
+		os.Stdout.Write(buf.Bytes())
+		lastLines = bytes.Count(buf.Bytes(), []byte("\n"))
+	}
+
+	fmt.Printf("Discovering path to %s...\n", domain)
+	report, err := RunMTR(domain, opts, cycles, timeout, onCycle)
+	if err != nil {
+		fmt.Printf("MTR failed: %v\n", err)
+		return
+	}
+	if !live {
+		RenderTable(mtrHeaders, mtrRows(report))
+	}
+
+	if jsonPath != "" {
+		if err := WriteMTRJSON(report, jsonPath); err != nil {
+			fmt.Printf("Could not write MTR report: %v\n", err)
+		} else if jsonPath != "-" {
+			fmt.Printf("MTR report written to %s\n", jsonPath)
+		}
+	}
+}
@@ -123,7 +123,9 @@ func getNetworkActivity() (map[string]map[string]float64, error) {
 	return networkActivity, nil
 }
 
-func PrintNetworkInfo() {
+// PrintNetworkInfo prints interface addresses and traffic. If enrich is non-nil the WAN
+// address is annotated with its ASN and country.
+func PrintNetworkInfo(enrich *IPEnricher) {
 	fmt.Println("") // Add space before section
 
 	PrintSectionHeader("===== Network Information =====")
@@ -140,7 +142,11 @@ func PrintNetworkInfo() {
 	headers := []string{"Interface", "IP", "MB Sent", "MB Received"}
 	var table [][]string
 	// Add WAN row first
-	table = append(table, []string{"WAN", ipWan[1], "-", "-"})
+	wan := ipWan[1]
+	if info, ok := enrich.LookupString(wan); ok {
+		wan = fmt.Sprintf("%s (%s)", wan, info)
+	}
+	table = append(table, []string{"WAN", wan, "-", "-"})
 	// Add each LAN interface
 	for iface, ip := range ipLan {
 		bytesSent := networkActivity[iface]["bytes_sent"]
@@ -0,0 +1,554 @@
+package sysinformer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	PAGE_MAX_PAGES    = 25       // pages fetched and parsed while crawling
+	PAGE_MAX_LINKS    = 250      // internal links checked in total
+	PAGE_CONCURRENCY  = 8        // assets and links fetched at once
+	PAGE_MAX_HTML     = 5 << 20  // bytes of HTML parsed per page
+	PAGE_MAX_RESOURCE = 50 << 20 // bytes counted per asset
+)
+
+// pageRef is a resource referenced by a page: a script, stylesheet, image, media file or
+// frame it loads, or an anchor it links to.
+type pageRef struct {
+	Kind string // script, stylesheet, image, media, frame or link
+	URL  string
+}
+
+// activeContent reports whether a browser blocks the reference outright as mixed content,
+// rather than loading it with a warning.
+func (r pageRef) activeContent() bool {
+	return r.Kind == "script" || r.Kind == "stylesheet" || r.Kind == "frame"
+}
+
+// extractRefs walks a parsed page and returns the resources it loads and the links it
+// contains, resolved against base (or the page's <base href>) and deduplicated.
+func extractRefs(doc *html.Node, base *url.URL) (assets []pageRef, links []string) {
+	seen := map[string]bool{}
+	add := func(kind, raw string) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || strings.HasPrefix(raw, "#") {
+			return
+		}
+		u, err := base.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			// data:, mailto:, javascript: and tel: references load nothing.
+			return
+		}
+		u.Fragment = ""
+		key := kind + " " + u.String()
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		if kind == "link" {
+			links = append(links, u.String())
+		} else {
+			assets = append(assets, pageRef{Kind: kind, URL: u.String()})
+		}
+	}
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			attr := map[string]string{}
+			for _, a := range n.Attr {
+				attr[a.Key] = a.Val
+			}
+			switch n.Data {
+			case "base":
+				if u, err := base.Parse(attr["href"]); err == nil && attr["href"] != "" {
+					base = u
+				}
+			case "script":
+				add("script", attr["src"])
+			case "link":
+				rel := strings.Fields(strings.ToLower(attr["rel"]))
+				switch {
+				case containsString(rel, "stylesheet"):
+					add("stylesheet", attr["href"])
+				case containsString(rel, "icon") || containsString(rel, "apple-touch-icon"):
+					add("image", attr["href"])
+				case containsString(rel, "modulepreload"):
+					add("script", attr["href"])
+				}
+			case "img":
+				src := attr["src"]
+				if src == "" {
+					// Without src the browser picks one srcset candidate; take the first.
+					src, _, _ = strings.Cut(strings.TrimSpace(attr["srcset"]), " ")
+					src = strings.TrimSuffix(src, ",")
+				}
+				add("image", src)
+			case "video":
+				add("media", attr["src"])
+				add("image", attr["poster"])
+			case "audio", "source", "track":
+				add("media", attr["src"])
+			case "iframe", "frame":
+				add("frame", attr["src"])
+			case "a", "area":
+				add("link", attr["href"])
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return assets, links
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// fetchResult is the outcome of fetching one URL. Bytes is the size on the wire, so a
+// compressed response counts at its compressed size.
+type fetchResult struct {
+	Status      int
+	Bytes       int64
+	ContentType string
+	FinalURL    string // after redirects
+	Err         string
+}
+
+func (r fetchResult) broken() bool {
+	return r.Err != "" || r.Status >= 400
+}
+
+func (r fetchResult) statusText() string {
+	if r.Err != "" {
+		return "failed"
+	}
+	return strconv.Itoa(r.Status)
+}
+
+// pageCrawler fetches pages, assets and links for the page check, fetching each URL once.
+type pageCrawler struct {
+	client  *http.Client
+	reqOpts HTTPRequestOptions
+	host    string
+
+	mu    sync.Mutex
+	cache map[string]fetchResult // GET results
+	heads map[string]fetchResult // HEAD results, which only answer link checks
+}
+
+// request builds a GET or HEAD for target. The --header, auth and user agent options only
+// apply to the target's own host so that credentials are not sent to third parties.
+func (c *pageCrawler) request(method, target string) (*http.Request, error) {
+	req, err := c.reqOpts.newRequestFor(c.host, method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Asking for gzip ourselves keeps the transport from decompressing, so byte counts are
+	// transfer sizes.
+	req.Header.Set("Accept-Encoding", "gzip")
+	return req, nil
+}
+
+// fetch retrieves target. With head set a HEAD request is tried first, falling back to
+// GET for servers that do not support it. When keep is set the decoded body is returned.
+func (c *pageCrawler) fetch(target string, head, keep bool) (fetchResult, []byte) {
+	if !keep {
+		c.mu.Lock()
+		r, ok := c.cache[target]
+		if !ok && head {
+			r, ok = c.heads[target]
+		}
+		c.mu.Unlock()
+		if ok {
+			return r, nil
+		}
+	}
+
+	var r fetchResult
+	var body []byte
+	method := http.MethodGet
+	if head && !keep {
+		method = http.MethodHead
+	}
+	for {
+		req, err := c.request(method, target)
+		if err != nil {
+			r.Err = err.Error()
+			break
+		}
+		resp, err := c.client.Do(req)
+		if err != nil {
+			r.Err = err.Error()
+			break
+		}
+		if method == http.MethodHead && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+			resp.Body.Close()
+			method = http.MethodGet
+			continue
+		}
+		r.Status = resp.StatusCode
+		r.ContentType = resp.Header.Get("Content-Type")
+		r.FinalURL = resp.Request.URL.String()
+		if keep {
+			raw, err := io.ReadAll(io.LimitReader(resp.Body, PAGE_MAX_HTML))
+			r.Bytes = int64(len(raw))
+			if err == nil {
+				body, err = decodeBody(raw, resp.Header.Get("Content-Encoding"))
+			}
+			if err != nil {
+				r.Err = err.Error()
+			}
+		} else {
+			r.Bytes, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, PAGE_MAX_RESOURCE))
+		}
+		resp.Body.Close()
+		break
+	}
+
+	// A HEAD result carries no size, so only GET results can answer later asset fetches.
+	c.mu.Lock()
+	if method == http.MethodGet {
+		c.cache[target] = r
+	} else {
+		c.heads[target] = r
+	}
+	c.mu.Unlock()
+	return r, body
+}
+
+func decodeBody(raw []byte, encoding string) ([]byte, error) {
+	if !strings.EqualFold(encoding, "gzip") {
+		return raw, nil
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(io.LimitReader(zr, PAGE_MAX_HTML))
+}
+
+// fetchAll fetches targets PAGE_CONCURRENCY at a time.
+func (c *pageCrawler) fetchAll(targets []string, head bool) map[string]fetchResult {
+	results := make(map[string]fetchResult, len(targets))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, PAGE_CONCURRENCY)
+	for _, t := range targets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			r, _ := c.fetch(t, head, false)
+			mu.Lock()
+			results[t] = r
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// pageReport is what the page check found on one crawled page.
+type pageReport struct {
+	URL       string // as linked; Result.FinalURL is where it ended up
+	Depth     int
+	Result    fetchResult
+	NotHTML   bool
+	Assets    []pageRef
+	AssetRes  map[string]fetchResult
+	Links     []string // internal links
+	LinkRes   map[string]fetchResult
+	Mixed     []pageRef
+	Unchecked int // internal links skipped after PAGE_MAX_LINKS
+}
+
+func (p pageReport) weight() int64 {
+	total := p.Result.Bytes
+	for _, a := range p.Assets {
+		total += p.AssetRes[a.URL].Bytes
+	}
+	return total
+}
+
+func (p pageReport) brokenLinks() int {
+	n := 0
+	for _, l := range p.Links {
+		if r, ok := p.LinkRes[l]; ok && r.broken() {
+			n++
+		}
+	}
+	return n
+}
+
+func (p pageReport) brokenAssets() int {
+	n := 0
+	for _, a := range p.Assets {
+		if p.AssetRes[a.URL].broken() {
+			n++
+		}
+	}
+	return n
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// crawl fetches the page at targetURL and the resources it loads and checks its internal
+// links, then does the same for the internal pages it links to until depth levels have been
+// crawled. Internal means on the host the target ends up at after redirects. It returns the
+// pages in crawl order, the number of distinct links checked and the pages left out after
+// PAGE_MAX_PAGES.
+func (c *pageCrawler) crawl(targetURL string, depth int) (pages []*pageReport, checked map[string]bool, pagesSkipped int) {
+	visited := map[string]bool{targetURL: true}
+	queue := []*pageReport{{URL: targetURL}}
+	checked = map[string]bool{}
+	for len(queue) > 0 {
+		p := queue[0]
+		queue = queue[1:]
+		if len(pages) >= PAGE_MAX_PAGES {
+			pagesSkipped++
+			continue
+		}
+		pages = append(pages, p)
+
+		var body []byte
+		p.Result, body = c.fetch(p.URL, false, true)
+		if p.Result.broken() {
+			continue
+		}
+		// Resolve references against where the page was actually served from: a bare
+		// target usually redirects from http://example.com to https://www.example.com.
+		base, err := url.Parse(p.Result.FinalURL)
+		if err != nil {
+			p.Result.Err = err.Error()
+			continue
+		}
+		visited[base.String()] = true
+		if p.Depth == 0 {
+			c.host = base.Hostname()
+		}
+		if !strings.Contains(strings.ToLower(p.Result.ContentType), "html") {
+			p.NotHTML = true
+			continue
+		}
+		doc, err := html.Parse(bytes.NewReader(body))
+		if err != nil {
+			p.Result.Err = "parsing HTML: " + err.Error()
+			continue
+		}
+		var links []string
+		p.Assets, links = extractRefs(doc, base)
+
+		assetURLs := make([]string, 0, len(p.Assets))
+		for _, a := range p.Assets {
+			assetURLs = append(assetURLs, a.URL)
+			if base.Scheme == "https" && strings.HasPrefix(a.URL, "http://") {
+				p.Mixed = append(p.Mixed, a)
+			}
+		}
+		p.AssetRes = c.fetchAll(assetURLs, false)
+
+		for _, l := range links {
+			u, _ := url.Parse(l)
+			if !strings.EqualFold(u.Hostname(), c.host) {
+				continue
+			}
+			if !checked[l] {
+				if len(checked) >= PAGE_MAX_LINKS {
+					p.Unchecked++
+					continue
+				}
+				checked[l] = true
+			}
+			p.Links = append(p.Links, l)
+		}
+		p.LinkRes = c.fetchAll(p.Links, true)
+
+		if p.Depth+1 >= depth {
+			continue
+		}
+		for _, l := range p.Links {
+			if r := p.LinkRes[l]; !visited[l] && !r.broken() && (r.ContentType == "" || strings.Contains(strings.ToLower(r.ContentType), "html")) {
+				visited[l] = true
+				queue = append(queue, &pageReport{URL: l, Depth: p.Depth + 1})
+			}
+		}
+	}
+	return pages, checked, pagesSkipped
+}
+
+// CheckPage downloads the page at targetURL with everything it loads and reports its
+// weight, request count and mixed content, then checks the internal links it contains.
+// With depth above 1 the internal pages it links to are crawled the same way, up to
+// depth levels from the target.
+func CheckPage(targetURL string, depth int, timeout time.Duration, reqOpts HTTPRequestOptions) {
+	fmt.Println("")
+	PrintSectionHeader("PAGE")
+
+	start, err := url.Parse(targetURL)
+	if err != nil {
+		fmt.Printf("Invalid URL: %v\n", err)
+		return
+	}
+	tr, err := reqOpts.transport(true)
+	if err != nil {
+		fmt.Printf("Could not set up requests: %v\n", err)
+		return
+	}
+	if depth < 1 {
+		depth = 1
+	}
+	c := &pageCrawler{
+		client:  &http.Client{Timeout: timeout, Transport: tr},
+		reqOpts: reqOpts,
+		host:    start.Hostname(),
+		cache:   map[string]fetchResult{},
+		heads:   map[string]fetchResult{},
+	}
+	pages, checked, pagesSkipped := c.crawl(targetURL, depth)
+
+	rows := make([][]string, 0, len(pages))
+	for _, p := range pages {
+		path := p.URL
+		if p.Result.FinalURL != "" {
+			path = p.Result.FinalURL
+		}
+		if u, err := url.Parse(path); err == nil && strings.EqualFold(u.Hostname(), c.host) {
+			path = u.RequestURI()
+		}
+		row := []string{truncateForDisplay(path, 50), p.Result.statusText(), "-", "-", "-", "-", "-", ""}
+		verdict := VerdictPass
+		switch {
+		case p.Result.broken():
+			verdict = VerdictFail
+		case p.NotHTML:
+			row[6] = "not HTML"
+			verdict = VerdictInfo
+		default:
+			row[2] = formatBytes(p.weight())
+			row[3] = strconv.Itoa(1 + len(p.Assets))
+			row[4] = strconv.Itoa(len(p.Mixed))
+			row[5] = strconv.Itoa(p.brokenAssets())
+			row[6] = fmt.Sprintf("%d of %d", p.brokenLinks(), len(p.Links))
+			active := false
+			for _, m := range p.Mixed {
+				active = active || m.activeContent()
+			}
+			switch {
+			case active || p.brokenLinks() > 0 || p.brokenAssets() > 0:
+				verdict = VerdictFail
+			case len(p.Mixed) > 0:
+				verdict = VerdictWarn
+			}
+		}
+		row[7] = colorVerdict(verdict)
+		rows = append(rows, row)
+	}
+	RenderTable([]string{"Page", "Status", "Weight", "Requests", "Mixed", "Broken assets", "Broken links", "Verdict"}, rows)
+
+	// The asset breakdown is for the target page, which is what page weight usually means.
+	if target := pages[0]; !target.Result.broken() && !target.NotHTML {
+		type kindTotal struct {
+			count, failed int
+			bytes         int64
+		}
+		totals := map[string]*kindTotal{"html": {count: 1, bytes: target.Result.Bytes}}
+		for _, a := range target.Assets {
+			t := totals[a.Kind]
+			if t == nil {
+				t = &kindTotal{}
+				totals[a.Kind] = t
+			}
+			r := target.AssetRes[a.URL]
+			t.count++
+			t.bytes += r.Bytes
+			if r.broken() {
+				t.failed++
+			}
+		}
+		kinds := make([]string, 0, len(totals))
+		for k := range totals {
+			kinds = append(kinds, k)
+		}
+		sort.Slice(kinds, func(i, j int) bool { return totals[kinds[i]].bytes > totals[kinds[j]].bytes })
+		kindRows := make([][]string, 0, len(kinds)+1)
+		for _, k := range kinds {
+			t := totals[k]
+			kindRows = append(kindRows, []string{k, strconv.Itoa(t.count), formatBytes(t.bytes), strconv.Itoa(t.failed)})
+		}
+		kindRows = append(kindRows, []string{"total", strconv.Itoa(1 + len(target.Assets)), formatBytes(target.weight()), strconv.Itoa(target.brokenAssets())})
+		fmt.Println("Target page resources (transfer sizes):")
+		RenderTable([]string{"Type", "Requests", "Size", "Failed"}, kindRows)
+	}
+
+	var mixedRows, brokenRows [][]string
+	for _, p := range pages {
+		for _, m := range p.Mixed {
+			impact := colorCell("\033[93m", "loaded with a warning")
+			if m.activeContent() {
+				impact = colorCell("\033[91m", "blocked")
+			}
+			mixedRows = append(mixedRows, []string{m.Kind, truncateForDisplay(m.URL, 70), impact, truncateForDisplay(p.URL, 50)})
+		}
+		for _, a := range p.Assets {
+			if r := p.AssetRes[a.URL]; r.broken() {
+				brokenRows = append(brokenRows, []string{a.Kind, truncateForDisplay(a.URL, 70), colorCell("\033[91m", r.statusText()), truncateForDisplay(p.URL, 50)})
+			}
+		}
+		for _, l := range p.Links {
+			if r := p.LinkRes[l]; r.broken() {
+				brokenRows = append(brokenRows, []string{"link", truncateForDisplay(l, 70), colorCell("\033[91m", r.statusText()), truncateForDisplay(p.URL, 50)})
+			}
+		}
+	}
+	if len(mixedRows) > 0 {
+		fmt.Println("Mixed content (http:// resources on https pages):")
+		RenderTable([]string{"Type", "URL", "Browser", "Found on"}, mixedRows)
+	}
+	if len(brokenRows) > 0 {
+		fmt.Println("Broken resources and internal links:")
+		RenderTable([]string{"Type", "URL", "Status", "Found on"}, brokenRows)
+	}
+
+	fmt.Printf("%d pages crawled (depth %d), %d internal links checked, %d broken resources or links, %d mixed content references\n",
+		len(pages), depth, len(checked), len(brokenRows), len(mixedRows))
+	unchecked := 0
+	for _, p := range pages {
+		unchecked += p.Unchecked
+	}
+	if unchecked > 0 {
+		fmt.Printf("%d further internal links not checked (limit %d)\n", unchecked, PAGE_MAX_LINKS)
+	}
+	if pagesSkipped > 0 {
+		fmt.Printf("%d further pages not crawled (limit %d)\n", pagesSkipped, PAGE_MAX_PAGES)
+	}
+}
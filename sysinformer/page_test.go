@@ -0,0 +1,171 @@
+package sysinformer
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+func newTestCrawler(client *http.Client, target string) *pageCrawler {
+	u, _ := url.Parse(target)
+	return &pageCrawler{
+		client: client,
+		host:   u.Hostname(),
+		cache:  map[string]fetchResult{},
+		heads:  map[string]fetchResult{},
+	}
+}
+
+func TestExtractRefs(t *testing.T) {
+	const page = `<html><head>
+<base href="https://example.com/app/">
+<link rel="stylesheet" href="/style.css"><link rel="icon" href="favicon.ico">
+<script src="main.js"></script><script>inline()</script>
+</head><body>
+<img src="data:image/png;base64,AAAA"><img srcset="big.png 2x, small.png 1x">
+<img src="http://cdn.example.net/logo.png">
+<video src="clip.mp4" poster="poster.jpg"></video><iframe src="https://ads.example.net/f"></iframe>
+<a href="about#team">about</a><a href="about">again</a><a href="#top">top</a>
+<a href="mailto:x@example.com">mail</a><a href="https://other.example.org/">out</a>
+</body></html>`
+	doc, err := html.Parse(strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse("https://example.com/index.html")
+	assets, links := extractRefs(doc, base)
+
+	var got []string
+	for _, a := range assets {
+		got = append(got, a.Kind+" "+a.URL)
+	}
+	want := []string{
+		"stylesheet https://example.com/style.css",
+		"image https://example.com/app/favicon.ico",
+		"script https://example.com/app/main.js",
+		"image https://example.com/app/big.png",
+		"image http://cdn.example.net/logo.png",
+		"media https://example.com/app/clip.mp4",
+		"image https://example.com/app/poster.jpg",
+		"frame https://ads.example.net/f",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("assets:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	wantLinks := []string{"https://example.com/app/about", "https://other.example.org/"}
+	if strings.Join(links, " ") != strings.Join(wantLinks, " ") {
+		t.Errorf("links = %v, want %v", links, wantLinks)
+	}
+}
+
+func TestCrawlMixedContentAndBrokenLinks(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("asset"))
+	}))
+	defer plain.Close()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<script src="%[1]s/app.js"></script><img src="%[1]s/logo.png">
+<img src="/local.png"><a href="/ok">ok</a><a href="/missing">missing</a>`, plain.URL)
+	})
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte("fine")) })
+	mux.HandleFunc("/local.png", func(w http.ResponseWriter, r *http.Request) { w.Write(make([]byte, 100)) })
+	srv := httptest.NewTLSServer(mux)
+	defer srv.Close()
+
+	c := newTestCrawler(srv.Client(), srv.URL)
+	pages, checked, _ := c.crawl(srv.URL+"/", 1)
+	if len(pages) != 1 {
+		t.Fatalf("crawled %d pages, want 1", len(pages))
+	}
+	p := pages[0]
+	if len(p.Mixed) != 2 {
+		t.Errorf("mixed content = %v, want the script and the image", p.Mixed)
+	}
+	active := 0
+	for _, m := range p.Mixed {
+		if m.activeContent() {
+			active++
+		}
+	}
+	if active != 1 {
+		t.Errorf("%d active mixed references, want 1 (the script)", active)
+	}
+	if len(checked) != 2 || p.brokenLinks() != 1 {
+		t.Errorf("checked %d links with %d broken, want 2 with 1 broken", len(checked), p.brokenLinks())
+	}
+	if r := p.LinkRes[srv.URL+"/missing"]; r.Status != http.StatusNotFound {
+		t.Errorf("/missing status = %d, want 404", r.Status)
+	}
+	if p.brokenAssets() != 0 || p.weight() < 100 {
+		t.Errorf("broken assets = %d, weight = %d", p.brokenAssets(), p.weight())
+	}
+}
+
+func TestCrawlUsesFinalURLAfterRedirect(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<img src="http://insecure.invalid/x.png"><a href="/gone">gone</a>`))
+	})
+	secure := httptest.NewTLSServer(mux)
+	defer secure.Close()
+	// The target is a different host name and scheme that redirects to the real site, as
+	// http://example.com does to https://www.example.com.
+	redirector := httptest.NewServer(http.RedirectHandler(secure.URL+"/", http.StatusMovedPermanently))
+	defer redirector.Close()
+	target := strings.Replace(redirector.URL, "127.0.0.1", "localhost", 1) + "/"
+
+	c := newTestCrawler(secure.Client(), target)
+	pages, checked, _ := c.crawl(target, 1)
+	p := pages[0]
+	if len(p.Mixed) != 1 {
+		t.Errorf("mixed content = %v, want the http image on the https page", p.Mixed)
+	}
+	if !checked[secure.URL+"/gone"] {
+		t.Errorf("links on the final host were not checked: %v", checked)
+	}
+}
+
+func TestCrawlDepthLimit(t *testing.T) {
+	// / links to /a, which links to /b, which links to /c.
+	next := map[string]string{"/": "/a", "/a": "/b", "/b": "/c", "/c": ""}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, ok := next[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		if n != "" {
+			fmt.Fprintf(w, `<a href="%s">next</a>`, n)
+		}
+	}))
+	defer srv.Close()
+
+	for depth, want := range map[int][]string{1: {"/"}, 2: {"/", "/a"}, 3: {"/", "/a", "/b"}} {
+		c := newTestCrawler(srv.Client(), srv.URL)
+		pages, _, _ := c.crawl(srv.URL+"/", depth)
+		var got []string
+		for _, p := range pages {
+			u, _ := url.Parse(p.URL)
+			got = append(got, u.Path)
+		}
+		sort.Strings(got)
+		if strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Errorf("depth %d crawled %v, want %v", depth, got, want)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package sysinformer
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const DEFAULT_MAX_REDIRECTS = 10
+
+// redirectHop is one request in a redirect chain.
+type redirectHop struct {
+	URL        string
+	StatusCode int
+	Location   string // resolved absolute target, empty if not a redirect
+	Elapsed    time.Duration
+	Downgrade  bool // https -> http
+	HostChange bool
+}
+
+// redirectChain is the outcome of following a URL hop by hop.
+type redirectChain struct {
+	Hops  []redirectHop
+	Final *http.Response // body already drained and closed
+	Loop  bool           // a Location pointed back at an URL already visited
+	Limit bool           // stopped because max redirects was reached
+}
+
+// followRedirects requests targetURL and follows redirects itself so that every hop can be
+// reported. With maxRedirects <= 0 (or noFollow) only the first response is fetched.
+// Redirects are followed like browsers do: 301, 302 and 303 turn the request into a body-less
+// GET, and the --header, auth and user agent options are not sent on to another host.
+func followRedirects(client *http.Client, reqOpts HTTPRequestOptions, targetURL string, maxRedirects int, noFollow bool) (*redirectChain, error) {
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	chain := &redirectChain{}
+	seen := map[string]bool{}
+	current := targetURL
+	method, body := reqOpts.method(), reqOpts.Body
+	origin, err := url.Parse(targetURL)
+	if err != nil {
+		return chain, err
+	}
+	for {
+		seen[current] = true
+		req, err := reqOpts.newRequestFor(origin.Hostname(), method, current, body)
+		if err != nil {
+			return chain, err
+		}
+		start := time.Now()
+		resp, err := c.Do(req)
+		if err != nil {
+			return chain, err
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		hop := redirectHop{URL: current, StatusCode: resp.StatusCode, Elapsed: time.Since(start)}
+		chain.Final = resp
+
+		loc := resp.Header.Get("Location")
+		if !isRedirectStatus(resp.StatusCode) || loc == "" {
+			chain.Hops = append(chain.Hops, hop)
+			return chain, nil
+		}
+		next, err := resp.Request.URL.Parse(loc)
+		if err != nil {
+			chain.Hops = append(chain.Hops, hop)
+			return chain, fmt.Errorf("invalid Location header %q: %v", loc, err)
+		}
+		hop.Location = next.String()
+		hop.Downgrade = resp.Request.URL.Scheme == "https" && next.Scheme == "http"
+		hop.HostChange = !strings.EqualFold(resp.Request.URL.Host, next.Host)
+		chain.Hops = append(chain.Hops, hop)
+
+		if noFollow {
+			return chain, nil
+		}
+		if seen[hop.Location] {
+			chain.Loop = true
+			return chain, nil
+		}
+		if len(chain.Hops) > maxRedirects {
+			chain.Limit = true
+			return chain, nil
+		}
+		if resp.StatusCode != http.StatusTemporaryRedirect && resp.StatusCode != http.StatusPermanentRedirect && method != http.MethodHead {
+			method, body = http.MethodGet, nil
+		}
+		current = hop.Location
+	}
+}
+
+func isRedirectStatus(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+func (h redirectHop) notes() string {
+	notes := []string{}
+	if h.Downgrade {
+		notes = append(notes, "HTTPS→HTTP downgrade")
+	}
+	if h.HostChange {
+		if u, err := url.Parse(h.Location); err == nil {
+			notes = append(notes, "host change → "+u.Host)
+		}
+	}
+	return strings.Join(notes, "\n")
+}
+
+// printRedirectChain renders the chain as a table, plus any loop/limit warnings. Nothing
+// is shown for a single response that is not a redirect; an unfollowed redirect (with
+// --no-follow) is still listed with its Location.
+func printRedirectChain(chain *redirectChain, maxRedirects int) {
+	if len(chain.Hops) == 0 || (len(chain.Hops) == 1 && chain.Hops[0].Location == "" && !chain.Loop) {
+		return
+	}
+	rows := make([][]string, 0, len(chain.Hops))
+	for i, h := range chain.Hops {
+		status := fmt.Sprintf("%d %s", h.StatusCode, http.StatusText(h.StatusCode))
+		rows = append(rows, []string{
+			strconv.Itoa(i + 1),
+			h.URL,
+			status,
+			orDash(h.Location),
+			formatMs(h.Elapsed),
+			h.notes(),
+		})
+	}
+	RenderTable([]string{"#", "URL", "Status", "Location", "Time (ms)", "Notes"}, rows)
+	if chain.Loop {
+		fmt.Println("\033[91mRedirect loop detected\033[0m")
+	}
+	if chain.Limit {
+		fmt.Printf("\033[93mStopped after %d redirects (--max-redirects)\033[0m\n", maxRedirects)
+	}
+}
@@ -0,0 +1,49 @@
+package sysinformer
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFollowRedirectsScopesOptionsToOrigin(t *testing.T) {
+	var got *http.Request
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer other.Close()
+	// The same server under another host name, so the redirect changes host.
+	otherURL := strings.Replace(other.URL, "127.0.0.1", "localhost", 1)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Cookie") != "session=1" || r.Host != "www.example.com" {
+			t.Errorf("origin request: Cookie %q, Host %q", r.Header.Get("Cookie"), r.Host)
+		}
+		http.Redirect(w, r, otherURL+"/next", http.StatusFound)
+	}))
+	defer origin.Close()
+
+	opts := HTTPRequestOptions{
+		Headers:   []string{"Cookie: session=1", "Host: www.example.com"},
+		BasicAuth: "user:secret",
+		UserAgent: "probe/1",
+	}
+	chain, err := followRedirects(http.DefaultClient, opts, origin.URL, DEFAULT_MAX_REDIRECTS, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain.Hops) != 2 || got == nil {
+		t.Fatalf("got %d hops, other host requested: %v", len(chain.Hops), got != nil)
+	}
+	if got.Host != strings.TrimPrefix(otherURL, "http://") {
+		t.Errorf("cross-host hop sent Host %q", got.Host)
+	}
+	for _, h := range []string{"Cookie", "Authorization"} {
+		if v := got.Header.Get(h); v != "" {
+			t.Errorf("cross-host hop sent %s: %q", h, v)
+		}
+	}
+	if ua := got.Header.Get("User-Agent"); ua == "probe/1" {
+		t.Errorf("cross-host hop sent the custom User-Agent")
+	}
+}
@@ -0,0 +1,211 @@
+package sysinformer
+
+import (
+	"bytes"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+const maxRevocationBody = 10 << 20
+
+// revocationResult is one row of the revocation table.
+type revocationResult struct {
+	Source     string
+	Status     string
+	ThisUpdate time.Time
+	NextUpdate time.Time
+	Detail     string
+}
+
+func ocspStatusString(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	}
+	return "unknown"
+}
+
+// revocationReason names an RFC 5280 CRLReason code.
+func revocationReason(code int) string {
+	reasons := map[int]string{
+		0: "unspecified", 1: "keyCompromise", 2: "cACompromise", 3: "affiliationChanged",
+		4: "superseded", 5: "cessationOfOperation", 6: "certificateHold", 8: "removeFromCRL",
+		9: "privilegeWithdrawn", 10: "aACompromise",
+	}
+	if r, ok := reasons[code]; ok {
+		return r
+	}
+	return fmt.Sprintf("reason %d", code)
+}
+
+func colorRevocationStatus(status string) string {
+	switch status {
+	case "good", "not revoked":
+		return colorCell("\033[92m", status)
+	case "revoked", "error":
+		return colorCell("\033[91m", status)
+	case "not stapled":
+		return status
+	}
+	return colorCell("\033[93m", status)
+}
+
+// ocspResult describes a parsed OCSP response for leaf.
+func ocspResult(source string, raw []byte, leaf, issuer *x509.Certificate) revocationResult {
+	r := revocationResult{Source: source}
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		r.Status, r.Detail = "error", err.Error()
+		return r
+	}
+	r.Status = ocspStatusString(resp.Status)
+	r.ThisUpdate, r.NextUpdate = resp.ThisUpdate, resp.NextUpdate
+	if resp.Status == ocsp.Revoked {
+		r.Detail = fmt.Sprintf("revoked %s (%s)", resp.RevokedAt.Format("2006-01-02"), revocationReason(resp.RevocationReason))
+	}
+	if resp.Status != ocsp.Revoked && !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+		r.Status, r.Detail = "stale", "response expired "+resp.NextUpdate.Format("2006-01-02 15:04")
+	}
+	return r
+}
+
+// stapledOCSP reports the OCSP response the server stapled to the handshake, if any.
+func stapledOCSP(staple []byte, leaf, issuer *x509.Certificate) revocationResult {
+	if len(staple) == 0 {
+		return revocationResult{Source: "Stapled OCSP", Status: "not stapled"}
+	}
+	if issuer == nil {
+		return revocationResult{Source: "Stapled OCSP", Status: "error", Detail: "issuer certificate not sent; cannot verify response"}
+	}
+	return ocspResult("Stapled OCSP", staple, leaf, issuer)
+}
+
+// queryOCSP asks the responder at url about leaf.
+func queryOCSP(client *http.Client, url string, leaf, issuer *x509.Certificate) revocationResult {
+	source := "OCSP " + url
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return revocationResult{Source: source, Status: "error", Detail: err.Error()}
+	}
+	resp, err := client.Post(url, "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return revocationResult{Source: source, Status: "error", Detail: err.Error()}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRevocationBody))
+	if err != nil {
+		return revocationResult{Source: source, Status: "error", Detail: err.Error()}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return revocationResult{Source: source, Status: "error", Detail: resp.Status}
+	}
+	return ocspResult(source, body, leaf, issuer)
+}
+
+// queryCRL downloads the CRL at url and looks for the leaf's serial number.
+func queryCRL(client *http.Client, url string, leaf, issuer *x509.Certificate) revocationResult {
+	r := revocationResult{Source: "CRL " + url}
+	resp, err := client.Get(url)
+	if err != nil {
+		r.Status, r.Detail = "error", err.Error()
+		return r
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		r.Status, r.Detail = "error", resp.Status
+		return r
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxRevocationBody))
+	if err != nil {
+		r.Status, r.Detail = "error", err.Error()
+		return r
+	}
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		r.Status, r.Detail = "error", err.Error()
+		return r
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		r.Status, r.Detail = "error", "CRL signature: "+err.Error()
+		return r
+	}
+	r.ThisUpdate, r.NextUpdate = crl.ThisUpdate, crl.NextUpdate
+	r.Status = "not revoked"
+	for _, e := range crl.RevokedCertificateEntries {
+		if e.SerialNumber.Cmp(leaf.SerialNumber) == 0 {
+			r.Status = "revoked"
+			r.Detail = fmt.Sprintf("revoked %s (%s)", e.RevocationTime.Format("2006-01-02"), revocationReason(e.ReasonCode))
+			break
+		}
+	}
+	if r.Status == "not revoked" && !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+		r.Status, r.Detail = "stale", "CRL expired "+crl.NextUpdate.Format("2006-01-02 15:04")
+	}
+	if r.Detail == "" {
+		r.Detail = fmt.Sprintf("%d entries", len(crl.RevokedCertificateEntries))
+	}
+	return r
+}
+
+// checkRevocation reports the stapled OCSP response and, when direct is set, queries the
+// OCSP responders (or ocspURL instead) and CRL distribution points named in the leaf.
+func checkRevocation(chain []*x509.Certificate, staple []byte, direct bool, ocspURL string, timeout time.Duration) []revocationResult {
+	leaf := chain[0]
+	var issuer *x509.Certificate
+	if len(chain) > 1 {
+		issuer = chain[1]
+	}
+	results := []revocationResult{stapledOCSP(staple, leaf, issuer)}
+	if !direct {
+		return results
+	}
+	if issuer == nil {
+		return append(results, revocationResult{Source: "OCSP/CRL", Status: "error", Detail: "issuer certificate not sent; cannot build requests"})
+	}
+
+	client := &http.Client{Timeout: timeout}
+	responders := leaf.OCSPServer
+	if ocspURL != "" {
+		responders = []string{ocspURL}
+	}
+	for _, u := range responders {
+		results = append(results, queryOCSP(client, u, leaf, issuer))
+	}
+	for _, u := range leaf.CRLDistributionPoints {
+		results = append(results, queryCRL(client, u, leaf, issuer))
+	}
+	if len(responders) == 0 && len(leaf.CRLDistributionPoints) == 0 {
+		results = append(results, revocationResult{Source: "OCSP/CRL", Status: "unknown", Detail: "certificate lists no OCSP responder or CRL"})
+	}
+	return results
+}
+
+func formatUpdateTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+func printRevocation(results []revocationResult) {
+	rows := make([][]string, 0, len(results))
+	for _, r := range results {
+		rows = append(rows, []string{
+			truncateForDisplay(r.Source, 60),
+			colorRevocationStatus(r.Status),
+			formatUpdateTime(r.ThisUpdate),
+			formatUpdateTime(r.NextUpdate),
+			orDash(r.Detail),
+		})
+	}
+	fmt.Println("")
+	PrintSectionHeader("REVOCATION")
+	RenderTable([]string{"Source", "Status", "This Update", "Next Update", "Detail"}, rows)
+}
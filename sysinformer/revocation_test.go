@@ -0,0 +1,122 @@
+package sysinformer
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// testCA returns a self-signed CA and a leaf it issued.
+func testCA(t *testing.T) (ca *x509.Certificate, caKey crypto.Signer, leaf *x509.Certificate) {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, caKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ = x509.ParseCertificate(der)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "leaf.test"},
+		DNSNames:     []string{"leaf.test"},
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(12 * time.Hour),
+	}
+	der, err = x509.CreateCertificate(rand.Reader, leafTmpl, ca, leafKey.Public(), caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ = x509.ParseCertificate(der)
+	return ca, caKey, leaf
+}
+
+func TestQueryOCSP(t *testing.T) {
+	ca, caKey, leaf := testCA(t)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		status     int
+		nextUpdate time.Time
+		want       string
+	}{
+		{"good", ocsp.Good, now.Add(time.Hour), "good"},
+		{"revoked", ocsp.Revoked, now.Add(time.Hour), "revoked"},
+		{"unknown", ocsp.Unknown, now.Add(time.Hour), "unknown"},
+		{"expired good", ocsp.Good, now.Add(-time.Hour), "stale"},
+		{"expired revoked", ocsp.Revoked, now.Add(-time.Hour), "revoked"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				req, err := ocsp.ParseRequest(body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				resp, err := ocsp.CreateResponse(ca, ca, ocsp.Response{
+					Status:           tt.status,
+					SerialNumber:     req.SerialNumber,
+					ThisUpdate:       now.Add(-2 * time.Hour),
+					NextUpdate:       tt.nextUpdate,
+					RevokedAt:        now.Add(-3 * time.Hour),
+					RevocationReason: ocsp.KeyCompromise,
+				}, caKey)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				w.Header().Set("Content-Type", "application/ocsp-response")
+				w.Write(resp)
+			}))
+			defer srv.Close()
+
+			got := queryOCSP(srv.Client(), srv.URL, leaf, ca)
+			if got.Status != tt.want {
+				t.Fatalf("status = %q (%s), want %q", got.Status, got.Detail, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryOCSPResponderError(t *testing.T) {
+	ca, _, leaf := testCA(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	if got := queryOCSP(srv.Client(), srv.URL, leaf, ca); got.Status != "error" {
+		t.Fatalf("status = %q, want error", got.Status)
+	}
+}
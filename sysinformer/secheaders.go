@@ -0,0 +1,358 @@
+package sysinformer
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Finding severities, ordered from most to least serious.
+const (
+	SeverityHigh   = "high"
+	SeverityMedium = "medium"
+	SeverityLow    = "low"
+	SeverityInfo   = "info"
+	SeverityPass   = "pass"
+)
+
+const hstsMinMaxAge = 15552000 // 180 days
+
+// Finding is a single result of an audit, with a severity and a human-readable message.
+type Finding struct {
+	Severity string
+	Subject  string
+	Message  string
+}
+
+func severityPenalty(sev string) int {
+	switch sev {
+	case SeverityHigh:
+		return 20
+	case SeverityMedium:
+		return 10
+	case SeverityLow:
+		return 5
+	}
+	return 0
+}
+
+func severityRank(sev string) int {
+	switch sev {
+	case SeverityHigh:
+		return 0
+	case SeverityMedium:
+		return 1
+	case SeverityLow:
+		return 2
+	case SeverityInfo:
+		return 3
+	}
+	return 4
+}
+
+// colorSeverity returns sev coloured the way the services table colours Up/Down.
+func colorSeverity(sev string) string {
+	switch sev {
+	case SeverityHigh:
+		return "\033[91m" + sev + "\033[0m"
+	case SeverityMedium:
+		return "\033[93m" + sev + "\033[0m"
+	case SeverityPass:
+		return "\033[92m" + sev + "\033[0m"
+	}
+	return sev
+}
+
+// auditSecurityHeaders evaluates the security-relevant response headers. https reports
+// whether the response was served over TLS, which decides whether HSTS and the cookie
+// Secure flag can be expected.
+func auditSecurityHeaders(h http.Header, https bool) []Finding {
+	var f []Finding
+	add := func(sev, subject, format string, args ...interface{}) {
+		f = append(f, Finding{Severity: sev, Subject: subject, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Strict-Transport-Security
+	if !https {
+		add(SeverityHigh, "Strict-Transport-Security", "site served over plain HTTP; HSTS cannot apply")
+	} else if v := h.Get("Strict-Transport-Security"); v == "" {
+		add(SeverityHigh, "Strict-Transport-Security", "header missing")
+	} else {
+		d := parseDirectives(v)
+		maxAge, err := strconv.Atoi(strings.Trim(d["max-age"], `"`))
+		switch {
+		case err != nil:
+			add(SeverityHigh, "Strict-Transport-Security", "max-age missing or invalid")
+		case maxAge == 0:
+			add(SeverityHigh, "Strict-Transport-Security", "max-age=0 disables HSTS")
+		case maxAge < hstsMinMaxAge:
+			add(SeverityMedium, "Strict-Transport-Security", "max-age=%d is shorter than 180 days", maxAge)
+		default:
+			add(SeverityPass, "Strict-Transport-Security", "max-age=%d", maxAge)
+		}
+		if _, ok := d["includesubdomains"]; !ok {
+			add(SeverityLow, "Strict-Transport-Security", "includeSubDomains not set")
+		}
+		if _, ok := d["preload"]; !ok {
+			add(SeverityInfo, "Strict-Transport-Security", "preload not set")
+		}
+	}
+
+	// Content-Security-Policy
+	csp := h.Get("Content-Security-Policy")
+	cspDirectives := map[string]string{}
+	if csp == "" {
+		if h.Get("Content-Security-Policy-Report-Only") != "" {
+			add(SeverityMedium, "Content-Security-Policy", "only a Report-Only policy is set; nothing is enforced")
+		} else {
+			add(SeverityHigh, "Content-Security-Policy", "header missing")
+		}
+	} else {
+		cspDirectives = parseDirectives(csp)
+		f = append(f, auditCSP(cspDirectives)...)
+	}
+
+	// Clickjacking: X-Frame-Options or CSP frame-ancestors
+	xfo := strings.ToUpper(strings.TrimSpace(h.Get("X-Frame-Options")))
+	_, hasFrameAncestors := cspDirectives["frame-ancestors"]
+	switch {
+	case hasFrameAncestors:
+		add(SeverityPass, "X-Frame-Options", "framing controlled by CSP frame-ancestors")
+	case xfo == "DENY" || xfo == "SAMEORIGIN":
+		add(SeverityPass, "X-Frame-Options", "%s", xfo)
+	case xfo != "":
+		add(SeverityLow, "X-Frame-Options", "unrecognised value %q (use DENY or SAMEORIGIN)", xfo)
+	default:
+		add(SeverityMedium, "X-Frame-Options", "no X-Frame-Options or frame-ancestors; page can be framed")
+	}
+
+	// X-Content-Type-Options
+	switch v := strings.ToLower(strings.TrimSpace(h.Get("X-Content-Type-Options"))); v {
+	case "nosniff":
+		add(SeverityPass, "X-Content-Type-Options", "nosniff")
+	case "":
+		add(SeverityMedium, "X-Content-Type-Options", "header missing")
+	default:
+		add(SeverityLow, "X-Content-Type-Options", "unexpected value %q (use nosniff)", v)
+	}
+
+	// Referrer-Policy (the last recognised token wins)
+	if v := h.Get("Referrer-Policy"); v == "" {
+		add(SeverityLow, "Referrer-Policy", "header missing")
+	} else {
+		tokens := strings.Split(v, ",")
+		p := strings.ToLower(strings.TrimSpace(tokens[len(tokens)-1]))
+		switch p {
+		case "unsafe-url", "no-referrer-when-downgrade":
+			add(SeverityLow, "Referrer-Policy", "%s leaks full URLs to other origins", p)
+		default:
+			add(SeverityPass, "Referrer-Policy", "%s", p)
+		}
+	}
+
+	// Permissions-Policy
+	if h.Get("Permissions-Policy") == "" {
+		add(SeverityLow, "Permissions-Policy", "header missing")
+	} else {
+		add(SeverityPass, "Permissions-Policy", "present")
+	}
+
+	// Cross-origin isolation
+	switch v := strings.ToLower(h.Get("Cross-Origin-Opener-Policy")); {
+	case v == "":
+		add(SeverityLow, "Cross-Origin-Opener-Policy", "header missing")
+	case v == "unsafe-none":
+		add(SeverityLow, "Cross-Origin-Opener-Policy", "unsafe-none provides no isolation")
+	default:
+		add(SeverityPass, "Cross-Origin-Opener-Policy", "%s", v)
+	}
+	switch v := strings.ToLower(h.Get("Cross-Origin-Embedder-Policy")); {
+	case v == "" || v == "unsafe-none":
+		add(SeverityInfo, "Cross-Origin-Embedder-Policy", "not set; page is not cross-origin isolated")
+	default:
+		add(SeverityPass, "Cross-Origin-Embedder-Policy", "%s", v)
+	}
+
+	// Information disclosure
+	if v := h.Get("X-Powered-By"); v != "" {
+		add(SeverityLow, "X-Powered-By", "discloses %q", v)
+	}
+
+	f = append(f, auditCookies(h, https)...)
+	return f
+}
+
+func auditCSP(d map[string]string) []Finding {
+	var f []Finding
+	add := func(sev, format string, args ...interface{}) {
+		f = append(f, Finding{Severity: sev, Subject: "Content-Security-Policy", Message: fmt.Sprintf(format, args...)})
+	}
+
+	script, ok := d["script-src"]
+	scriptDirective := "script-src"
+	if !ok {
+		script, ok = d["default-src"]
+		scriptDirective = "default-src"
+	}
+	if !ok {
+		add(SeverityMedium, "no default-src or script-src; scripts are unrestricted")
+	} else {
+		sources := strings.Fields(strings.ToLower(script))
+		hasNonceOrHash := false
+		for _, s := range sources {
+			if strings.HasPrefix(s, "'nonce-") || strings.HasPrefix(s, "'sha") || s == "'strict-dynamic'" {
+				hasNonceOrHash = true
+			}
+		}
+		for _, s := range sources {
+			switch s {
+			case "'unsafe-inline'":
+				if !hasNonceOrHash {
+					add(SeverityMedium, "%s allows 'unsafe-inline'", scriptDirective)
+				}
+			case "'unsafe-eval'":
+				add(SeverityMedium, "%s allows 'unsafe-eval'", scriptDirective)
+			case "*", "http:", "https:", "data:":
+				add(SeverityMedium, "%s allows overly broad source %s", scriptDirective, s)
+			}
+		}
+	}
+	if _, ok := d["default-src"]; !ok {
+		add(SeverityLow, "default-src missing")
+	}
+	if _, ok := d["object-src"]; !ok && strings.TrimSpace(d["default-src"]) != "'none'" {
+		add(SeverityLow, "object-src missing (plugins fall back to default-src)")
+	}
+	if _, ok := d["base-uri"]; !ok {
+		add(SeverityLow, "base-uri missing")
+	}
+	if len(f) == 0 {
+		add(SeverityPass, "policy present")
+	}
+	return f
+}
+
+func auditCookies(h http.Header, https bool) []Finding {
+	var f []Finding
+	cookies := (&http.Response{Header: h}).Cookies()
+	for _, c := range cookies {
+		subject := "Set-Cookie " + c.Name
+		var issues []string
+		sev := SeverityPass
+		raise := func(s string) {
+			if severityRank(s) < severityRank(sev) {
+				sev = s
+			}
+		}
+		if !c.Secure {
+			issues = append(issues, "missing Secure")
+			if https {
+				raise(SeverityMedium)
+			} else {
+				raise(SeverityLow)
+			}
+		}
+		if !c.HttpOnly {
+			issues = append(issues, "missing HttpOnly")
+			raise(SeverityLow)
+		}
+		switch c.SameSite {
+		case http.SameSiteDefaultMode:
+			issues = append(issues, "no SameSite")
+			raise(SeverityLow)
+		case http.SameSiteNoneMode:
+			if !c.Secure {
+				issues = append(issues, "SameSite=None without Secure is rejected by browsers")
+				raise(SeverityMedium)
+			}
+		}
+		if strings.HasPrefix(c.Name, "__Host-") && (!c.Secure || c.Domain != "" || c.Path != "/") {
+			issues = append(issues, "__Host- prefix requires Secure, Path=/ and no Domain")
+			raise(SeverityMedium)
+		}
+		if strings.HasPrefix(c.Name, "__Secure-") && !c.Secure {
+			issues = append(issues, "__Secure- prefix requires Secure")
+			raise(SeverityMedium)
+		}
+		if len(issues) == 0 {
+			f = append(f, Finding{Severity: SeverityPass, Subject: subject, Message: "Secure, HttpOnly, SameSite"})
+			continue
+		}
+		f = append(f, Finding{Severity: sev, Subject: subject, Message: strings.Join(issues, "; ")})
+	}
+	return f
+}
+
+// parseDirectives splits a ';'-separated header like "max-age=31536000; includeSubDomains"
+// or a CSP into lower-cased directive names mapped to their (possibly empty) values.
+func parseDirectives(v string) map[string]string {
+	d := map[string]string{}
+	for _, part := range strings.Split(v, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.IndexAny(part, "= "); i >= 0 {
+			name, value = part[:i], strings.TrimSpace(part[i+1:])
+		}
+		name = strings.ToLower(name)
+		if _, dup := d[name]; !dup {
+			d[name] = value
+		}
+	}
+	return d
+}
+
+// gradeFindings turns findings into a 0-100 score and a letter grade. Cookies are
+// graded as one item, at their worst finding, so a site setting many cookies is not
+// failed for repeating the same flag mistake.
+func gradeFindings(f []Finding) (int, string) {
+	score := 100
+	cookiePenalty := 0
+	for _, x := range f {
+		if strings.HasPrefix(x.Subject, "Set-Cookie ") {
+			cookiePenalty = max(cookiePenalty, severityPenalty(x.Severity))
+			continue
+		}
+		score -= severityPenalty(x.Severity)
+	}
+	score -= cookiePenalty
+	if score < 0 {
+		score = 0
+	}
+	switch {
+	case score >= 95:
+		return score, "A+"
+	case score >= 85:
+		return score, "A"
+	case score >= 70:
+		return score, "B"
+	case score >= 55:
+		return score, "C"
+	case score >= 40:
+		return score, "D"
+	}
+	return score, "F"
+}
+
+func sortFindings(f []Finding) {
+	sort.SliceStable(f, func(i, j int) bool { return severityRank(f[i].Severity) < severityRank(f[j].Severity) })
+}
+
+// printSecurityHeaderAudit renders the findings table and the overall grade.
+func printSecurityHeaderAudit(h http.Header, https bool) {
+	findings := auditSecurityHeaders(h, https)
+	sortFindings(findings)
+	rows := make([][]string, 0, len(findings))
+	for _, x := range findings {
+		rows = append(rows, []string{colorSeverity(x.Severity), x.Subject, x.Message})
+	}
+	fmt.Println("")
+	PrintSectionHeader("SECURITY HEADERS")
+	RenderTable([]string{"Severity", "Header", "Finding"}, rows)
+	score, grade := gradeFindings(findings)
+	fmt.Printf("Security header grade: %s (%d/100)\n", grade, score)
+}
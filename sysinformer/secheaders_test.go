@@ -0,0 +1,29 @@
+package sysinformer
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGradeFindingsCapsCookies(t *testing.T) {
+	h := http.Header{}
+	h.Set("Strict-Transport-Security", "max-age=31536000; includeSubDomains")
+	base, _ := gradeFindings(auditSecurityHeaders(h, true))
+
+	one := h.Clone()
+	one.Add("Set-Cookie", "a=1")
+	oneScore, _ := gradeFindings(auditSecurityHeaders(one, true))
+
+	many := one.Clone()
+	for _, name := range []string{"b", "c", "d", "e", "f", "g", "h"} {
+		many.Add("Set-Cookie", name+"=1")
+	}
+	manyScore, _ := gradeFindings(auditSecurityHeaders(many, true))
+
+	if oneScore >= base {
+		t.Errorf("insecure cookie did not lower the score: %d, without cookies %d", oneScore, base)
+	}
+	if manyScore != oneScore {
+		t.Errorf("8 insecure cookies scored %d, one scored %d", manyScore, oneScore)
+	}
+}
@@ -0,0 +1,272 @@
+package sysinformer
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// STARTTLS protocols understood by --starttls.
+const (
+	StartTLSNone     = "none"
+	StartTLSSMTP     = "smtp"
+	StartTLSIMAP     = "imap"
+	StartTLSPOP3     = "pop3"
+	StartTLSLDAP     = "ldap"
+	StartTLSPostgres = "postgres"
+	StartTLSFTP      = "ftp"
+)
+
+const DEFAULT_TLS_PORT = 443
+
+// ldapMaxResponse bounds the LDAP StartTLS response read from the server.
+const ldapMaxResponse = 4096
+
+// starttlsForPort guesses the STARTTLS protocol from a well-known plaintext port. Implicit
+// TLS ports (443, 465, 993, 995, 636, ...) need none.
+func starttlsForPort(port int) string {
+	switch port {
+	case 25, 587:
+		return StartTLSSMTP
+	case 143:
+		return StartTLSIMAP
+	case 110:
+		return StartTLSPOP3
+	case 389:
+		return StartTLSLDAP
+	case 5432:
+		return StartTLSPostgres
+	case 21:
+		return StartTLSFTP
+	}
+	return StartTLSNone
+}
+
+func validStartTLS(proto string) bool {
+	switch proto {
+	case StartTLSNone, StartTLSSMTP, StartTLSIMAP, StartTLSPOP3, StartTLSLDAP, StartTLSPostgres, StartTLSFTP:
+		return true
+	}
+	return false
+}
+
+// tlsEndpoint describes where and how to start a TLS session.
+type tlsEndpoint struct {
+	Addr       string
+	ServerName string // SNI and the name the certificate is verified against
+	StartTLS   string
+}
+
+func (o SSLCheckOptions) endpoint(domain string) tlsEndpoint {
+	port := o.Port
+	if port <= 0 {
+		port = DEFAULT_TLS_PORT
+	}
+	proto := strings.ToLower(o.StartTLS)
+	if proto == "" {
+		proto = starttlsForPort(port)
+	}
+	name := o.SNI
+	if name == "" {
+		name = domain
+	}
+	return tlsEndpoint{Addr: net.JoinHostPort(domain, strconv.Itoa(port)), ServerName: name, StartTLS: proto}
+}
+
+// dialPlain connects to the endpoint and, for STARTTLS protocols, negotiates the upgrade.
+// The returned connection is ready for a TLS ClientHello.
+func (e tlsEndpoint) dialPlain(timeout time.Duration) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", e.Addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := negotiateStartTLS(conn, e.StartTLS); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("STARTTLS (%s): %w", e.StartTLS, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// dialTLS performs the TLS handshake with cfg. ServerName is filled in from the endpoint.
+func (e tlsEndpoint) dialTLS(timeout time.Duration, cfg *tls.Config) (*tls.Conn, error) {
+	raw, err := e.dialPlain(timeout)
+	if err != nil {
+		return nil, err
+	}
+	cfg.ServerName = e.ServerName
+	conn := tls.Client(raw, cfg)
+	conn.SetDeadline(time.Now().Add(timeout))
+	if err := conn.Handshake(); err != nil {
+		raw.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+func negotiateStartTLS(conn net.Conn, proto string) error {
+	switch proto {
+	case "", StartTLSNone:
+		return nil
+	case StartTLSSMTP:
+		r := bufio.NewReader(conn)
+		if err := expectReply(r, "220"); err != nil {
+			return err
+		}
+		fmt.Fprintf(conn, "EHLO sysinformer\r\n")
+		if err := expectReply(r, "250"); err != nil {
+			return err
+		}
+		fmt.Fprintf(conn, "STARTTLS\r\n")
+		return expectReply(r, "220")
+	case StartTLSFTP:
+		r := bufio.NewReader(conn)
+		if err := expectReply(r, "220"); err != nil {
+			return err
+		}
+		fmt.Fprintf(conn, "AUTH TLS\r\n")
+		return expectReply(r, "234")
+	case StartTLSPOP3:
+		r := bufio.NewReader(conn)
+		if err := expectLine(r, "+OK"); err != nil {
+			return err
+		}
+		fmt.Fprintf(conn, "STLS\r\n")
+		return expectLine(r, "+OK")
+	case StartTLSIMAP:
+		r := bufio.NewReader(conn)
+		if err := expectLine(r, "* OK"); err != nil {
+			return err
+		}
+		fmt.Fprintf(conn, "a1 STARTTLS\r\n")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(line, "a1 ") {
+				if !strings.HasPrefix(line, "a1 OK") {
+					return fmt.Errorf("server replied %q", strings.TrimSpace(line))
+				}
+				return nil
+			}
+		}
+	case StartTLSPostgres:
+		// SSLRequest: length 8, code 80877103. The server answers 'S' or 'N'.
+		req := make([]byte, 8)
+		binary.BigEndian.PutUint32(req[0:4], 8)
+		binary.BigEndian.PutUint32(req[4:8], 80877103)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		b := make([]byte, 1)
+		if _, err := io.ReadFull(conn, b); err != nil {
+			return err
+		}
+		if b[0] != 'S' {
+			return fmt.Errorf("server does not accept SSL (replied %q)", b[0])
+		}
+		return nil
+	case StartTLSLDAP:
+		return ldapStartTLS(conn)
+	}
+	return fmt.Errorf("unsupported protocol %q", proto)
+}
+
+// expectReply reads a (possibly multi-line "250-...") SMTP/FTP reply and checks its code.
+func expectReply(r *bufio.Reader, code string) error {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if len(line) >= 4 && line[3] == '-' {
+			continue
+		}
+		if !strings.HasPrefix(line, code) {
+			return fmt.Errorf("expected %s, server replied %q", code, line)
+		}
+		return nil
+	}
+}
+
+func expectLine(r *bufio.Reader, prefix string) error {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, prefix) {
+		return fmt.Errorf("expected %s, server replied %q", prefix, strings.TrimSpace(line))
+	}
+	return nil
+}
+
+// ldapStartTLS sends the StartTLS extended operation (RFC 4511 4.14) and checks the
+// resultCode of the ExtendedResponse.
+func ldapStartTLS(conn net.Conn) error {
+	const oid = "1.3.6.1.4.1.1466.20037"
+	ext := append([]byte{0x80, byte(len(oid))}, oid...) // [0] requestName
+	op := append([]byte{0x77, byte(len(ext))}, ext...)  // [APPLICATION 23] ExtendedRequest
+	msg := append([]byte{0x02, 0x01, 0x01}, op...)      // messageID 1
+	if _, err := conn.Write(append([]byte{0x30, byte(len(msg))}, msg...)); err != nil {
+		return err
+	}
+
+	hdr := make([]byte, 2)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return err
+	}
+	if hdr[0] != 0x30 {
+		return fmt.Errorf("unexpected LDAP response")
+	}
+	n := int(hdr[1])
+	if n&0x80 != 0 {
+		lenBytes := make([]byte, n&0x7f)
+		if len(lenBytes) > 4 {
+			return fmt.Errorf("unexpected LDAP response")
+		}
+		if _, err := io.ReadFull(conn, lenBytes); err != nil {
+			return err
+		}
+		n = 0
+		for _, b := range lenBytes {
+			n = n<<8 | int(b)
+		}
+	}
+	// A StartTLS ExtendedResponse is a few dozen bytes; refuse to allocate for more.
+	if n > ldapMaxResponse {
+		return fmt.Errorf("LDAP response of %d bytes is too large", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return err
+	}
+	// messageID INTEGER, then [APPLICATION 24] ExtendedResponse starting with resultCode.
+	if len(body) < 2 {
+		return fmt.Errorf("unexpected LDAP response")
+	}
+	i := 2 + int(body[1])
+	if len(body) < i+2 || body[i] != 0x78 {
+		return fmt.Errorf("unexpected LDAP response")
+	}
+	i += 2
+	if body[i-1]&0x80 != 0 {
+		i += int(body[i-1] & 0x7f)
+	}
+	if len(body) < i+3 || body[i] != 0x0a {
+		return fmt.Errorf("unexpected LDAP response")
+	}
+	if code := body[i+2]; code != 0 {
+		return fmt.Errorf("server returned resultCode %d", code)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package sysinformer
+
+import (
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+// ldapServer answers the StartTLS request on a pipe with resp.
+func ldapServer(t *testing.T, resp []byte) net.Conn {
+	client, server := net.Pipe()
+	go func() {
+		defer server.Close()
+		hdr := make([]byte, 2)
+		if _, err := io.ReadFull(server, hdr); err != nil {
+			return
+		}
+		io.ReadFull(server, make([]byte, hdr[1]))
+		server.Write(resp)
+	}()
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestLDAPStartTLS(t *testing.T) {
+	// messageID 1, ExtendedResponse with resultCode success (0), empty matchedDN and message.
+	ok := []byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x00, 0x04, 0x00, 0x04, 0x00}
+	if err := ldapStartTLS(ldapServer(t, ok)); err != nil {
+		t.Errorf("success response: %v", err)
+	}
+	// resultCode protocolError (2).
+	refused := []byte{0x30, 0x0c, 0x02, 0x01, 0x01, 0x78, 0x07, 0x0a, 0x01, 0x02, 0x04, 0x00, 0x04, 0x00}
+	if err := ldapStartTLS(ldapServer(t, refused)); err == nil {
+		t.Error("protocolError response was accepted")
+	}
+	// A four-byte length claiming almost 2 GiB must be refused before allocating it.
+	huge := []byte{0x30, 0x84, 0x7f, 0xff, 0xff, 0xff}
+	if err := ldapStartTLS(ldapServer(t, huge)); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("oversized response: err = %v, want a size error", err)
+	}
+}
@@ -2,6 +2,7 @@ package sysinformer
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"strings"
 
@@ -57,9 +58,22 @@ func PrintPanel(title string, subtitle string) {
 	fmt.Println(bot)
 }
 
+// colorCell wraps s in an ANSI colour for use inside a table. tablewriter measures words
+// including escape codes when wrapping, so spaces are made non-breaking to keep a coloured
+// phrase on one line.
+func colorCell(color string, s string) string {
+	return color + strings.ReplaceAll(s, " ", "\u00a0") + "\033[0m"
+}
+
 // RenderTable prints a formatted table with the given headers and rows
 func RenderTable(headers []string, data [][]string) {
-	table := tablewriter.NewWriter(os.Stdout)
+	renderTableTo(os.Stdout, headers, data)
+}
+
+// renderTableTo renders a table like RenderTable but to an arbitrary writer, which lets
+// callers buffer output (e.g. to redraw a live view in place).
+func renderTableTo(w io.Writer, headers []string, data [][]string) {
+	table := tablewriter.NewWriter(w)
 	table.SetHeader(headers)
 	table.SetAutoFormatHeaders(false)
 	table.SetRowLine(false)
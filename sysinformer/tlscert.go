@@ -0,0 +1,227 @@
+package sysinformer
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	SSL_WARN_DAYS = 30
+	SSL_CRIT_DAYS = 7
+)
+
+// loadCertPool returns the roots to verify against: the system pool, or the PEM bundle at
+// caFile when one is given.
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	if caFile == "" {
+		return x509.SystemCertPool()
+	}
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in %s", caFile)
+	}
+	return pool, nil
+}
+
+// certInspection is what inspectCert learned about one endpoint.
+type certInspection struct {
+	Endpoint tlsEndpoint
+	State    tls.ConnectionState
+	Problems []string // verification failures, empty when the chain is trusted
+	Now      time.Time
+}
+
+// inspectCert connects to the endpoint described by domain and opts and verifies the
+// presented chain against roots. Verification is done separately from the handshake so
+// that an untrusted or mismatched certificate can still be inspected and the reason
+// reported.
+func inspectCert(domain string, timeout time.Duration, opts SSLCheckOptions, roots *x509.CertPool) (*certInspection, error) {
+	ep := opts.endpoint(domain)
+	conn, err := ep.dialTLS(timeout, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	state := conn.ConnectionState()
+	if len(state.PeerCertificates) == 0 {
+		return nil, errors.New("no peer certificate presented")
+	}
+	now := time.Now()
+	return &certInspection{
+		Endpoint: ep,
+		State:    state,
+		Problems: verifyChain(state.PeerCertificates, ep.ServerName, roots, now),
+		Now:      now,
+	}, nil
+}
+
+// verifyChain checks the presented chain the way a browser would and returns one
+// human-readable reason per problem found. An empty result means the chain is trusted.
+func verifyChain(chain []*x509.Certificate, serverName string, roots *x509.CertPool, now time.Time) []string {
+	if len(chain) == 0 {
+		return []string{"no certificate presented"}
+	}
+	leaf := chain[0]
+	var reasons []string
+
+	if serverName != "" {
+		if err := leaf.VerifyHostname(serverName); err != nil {
+			reasons = append(reasons, fmt.Sprintf("hostname mismatch: certificate is not valid for %s (valid for %s)",
+				serverName, strings.Join(limitStrings(certNames(leaf), 5), ", ")))
+		}
+	}
+	for i, c := range chain {
+		switch {
+		case now.After(c.NotAfter):
+			reasons = append(reasons, fmt.Sprintf("expired: %s expired on %s", certLabel(i, c), c.NotAfter.Format("2006-01-02")))
+		case now.Before(c.NotBefore):
+			reasons = append(reasons, fmt.Sprintf("not yet valid: %s is valid from %s", certLabel(i, c), c.NotBefore.Format("2006-01-02")))
+		}
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range chain[1:] {
+		intermediates.AddCert(c)
+	}
+	// Verify at a time inside the leaf's validity window so date problems (already
+	// reported above) don't hide trust problems.
+	verifyAt := now
+	if now.After(leaf.NotAfter) || now.Before(leaf.NotBefore) {
+		verifyAt = leaf.NotBefore.Add(leaf.NotAfter.Sub(leaf.NotBefore) / 2)
+	}
+	_, err := leaf.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   verifyAt,
+	})
+	if err != nil {
+		var ua x509.UnknownAuthorityError
+		var ci x509.CertificateInvalidError
+		last := chain[len(chain)-1]
+		switch {
+		case errors.As(err, &ua):
+			if isSelfSigned(last) {
+				if len(chain) == 1 {
+					reasons = append(reasons, "untrusted root: certificate is self-signed")
+				} else {
+					reasons = append(reasons, fmt.Sprintf("untrusted root: %s is not in the trust store", describeName(last.Subject.CommonName, last.Subject.Organization)))
+				}
+			} else {
+				reasons = append(reasons, fmt.Sprintf("missing intermediate or untrusted root: issuer %q of %s was not sent and is not trusted",
+					describeName(last.Issuer.CommonName, last.Issuer.Organization), certLabel(len(chain)-1, last)))
+			}
+		case errors.As(err, &ci) && ci.Reason == x509.Expired:
+			// Already reported from the dates above.
+		default:
+			reasons = append(reasons, err.Error())
+		}
+	}
+	return reasons
+}
+
+func isSelfSigned(c *x509.Certificate) bool {
+	if !bytes.Equal(c.RawIssuer, c.RawSubject) {
+		return false
+	}
+	return c.CheckSignatureFrom(c) == nil
+}
+
+func certNames(c *x509.Certificate) []string {
+	names := append([]string{}, c.DNSNames...)
+	for _, ip := range c.IPAddresses {
+		names = append(names, ip.String())
+	}
+	if len(names) == 0 && c.Subject.CommonName != "" {
+		names = append(names, c.Subject.CommonName)
+	}
+	return names
+}
+
+func certLabel(i int, c *x509.Certificate) string {
+	role := "intermediate"
+	if i == 0 {
+		role = "leaf"
+	} else if isSelfSigned(c) {
+		role = "root"
+	}
+	return fmt.Sprintf("#%d %s (%s)", i+1, describeName(c.Subject.CommonName, c.Subject.Organization), role)
+}
+
+func describeName(cn string, org []string) string {
+	if cn != "" {
+		return cn
+	}
+	if len(org) > 0 {
+		return org[0]
+	}
+	return "(unnamed)"
+}
+
+func describeKey(c *x509.Certificate) string {
+	switch k := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA %d", k.N.BitLen())
+	case *ecdsa.PublicKey:
+		return fmt.Sprintf("ECDSA %s", k.Curve.Params().Name)
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return c.PublicKeyAlgorithm.String()
+}
+
+func certFingerprint(c *x509.Certificate) string {
+	sum := sha256.Sum256(c.Raw)
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// daysUntil returns the whole days from now until t, rounded down so that a certificate
+// that expired an hour ago is at -1 rather than 0.
+func daysUntil(t time.Time, now time.Time) int {
+	return int(math.Floor(t.Sub(now).Hours() / 24))
+}
+
+// expiryStatus colours the days-left figure using the warn/crit thresholds.
+func expiryStatus(days int, warnDays int, critDays int) string {
+	switch {
+	case days < 0:
+		return colorCell("\033[91m", fmt.Sprintf("expired %d days ago", -days))
+	case days <= critDays:
+		return colorCell("\033[91m", fmt.Sprintf("%d days", days))
+	case days <= warnDays:
+		return colorCell("\033[93m", fmt.Sprintf("%d days", days))
+	}
+	return fmt.Sprintf("%d days", days)
+}
+
+// printCertChain renders one row per certificate in the presented chain.
+func printCertChain(chain []*x509.Certificate, now time.Time) {
+	rows := make([][]string, 0, len(chain))
+	for i, c := range chain {
+		fp := certFingerprint(c)
+		rows = append(rows, []string{
+			certLabel(i, c),
+			describeName(c.Issuer.CommonName, c.Issuer.Organization),
+			describeKey(c) + "\n" + c.SignatureAlgorithm.String(),
+			c.NotAfter.Format("2006-01-02") + "\n" + expiryStatus(daysUntil(c.NotAfter, now), SSL_WARN_DAYS, SSL_CRIT_DAYS),
+			fp[:32] + "\n" + fp[32:],
+		})
+	}
+	RenderTable([]string{"Certificate", "Issuer", "Key / Signature", "Expires", "SHA-256"}, rows)
+}
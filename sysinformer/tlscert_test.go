@@ -0,0 +1,25 @@
+package sysinformer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDaysUntil(t *testing.T) {
+	now := time.Date(2026, 1, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   time.Duration
+		want int
+	}{
+		{30*24*time.Hour + time.Hour, 30},
+		{23 * time.Hour, 0},
+		{0, 0},
+		{-time.Hour, -1},
+		{-25 * time.Hour, -2},
+	}
+	for _, tt := range tests {
+		if got := daysUntil(now.Add(tt.in), now); got != tt.want {
+			t.Errorf("daysUntil(now%+v) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
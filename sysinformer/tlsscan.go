@@ -0,0 +1,424 @@
+package sysinformer
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Verdicts used by the TLS scan table.
+const (
+	VerdictPass = "PASS"
+	VerdictWarn = "WARN"
+	VerdictFail = "FAIL"
+	VerdictInfo = "INFO"
+)
+
+const tlsScanConcurrency = 8
+
+// tls13Suites are the TLS 1.3 cipher suites (RFC 8446 B.4). crypto/tls cannot restrict
+// them, so they are probed with a hand-built ClientHello.
+var tls13Suites = []struct {
+	id   uint16
+	name string
+}{
+	{0x1301, "TLS_AES_128_GCM_SHA256"},
+	{0x1302, "TLS_AES_256_GCM_SHA384"},
+	{0x1303, "TLS_CHACHA20_POLY1305_SHA256"},
+	{0x1304, "TLS_AES_128_CCM_SHA256"},
+	{0x1305, "TLS_AES_128_CCM_8_SHA256"},
+}
+
+type tlsScanRow struct {
+	Category string
+	Item     string
+	Result   string
+	Verdict  string
+}
+
+var tlsScanVersions = []struct {
+	version uint16
+	name    string
+	legacy  bool
+}{
+	{tls.VersionTLS10, "TLS 1.0", true},
+	{tls.VersionTLS11, "TLS 1.1", true},
+	{tls.VersionTLS12, "TLS 1.2", false},
+	{tls.VersionTLS13, "TLS 1.3", false},
+}
+
+func colorVerdict(v string) string {
+	switch v {
+	case VerdictPass:
+		return colorCell("\033[92m", v)
+	case VerdictWarn:
+		return colorCell("\033[93m", v)
+	case VerdictFail:
+		return colorCell("\033[91m", v)
+	}
+	return v
+}
+
+// verdictFinding is one row of a Check/Severity/Finding table.
+type verdictFinding struct {
+	Check   string
+	Verdict string
+	Detail  string
+}
+
+// renderVerdictFindings prints findings as a table followed by the number of passes,
+// warnings and errors.
+func renderVerdictFindings(findings []verdictFinding) {
+	rows := make([][]string, 0, len(findings))
+	counts := map[string]int{}
+	for _, f := range findings {
+		counts[f.Verdict]++
+		rows = append(rows, []string{f.Check, colorVerdict(f.Verdict), f.Detail})
+	}
+	RenderTable([]string{"Check", "Severity", "Finding"}, rows)
+	fmt.Printf("%d passed, %d warnings, %d errors\n", counts[VerdictPass], counts[VerdictWarn], counts[VerdictFail])
+}
+
+// tlsProbe performs a handshake restricted by the given settings and reports whether the
+// server accepted it.
+func tlsProbe(ep tlsEndpoint, timeout time.Duration, cfg *tls.Config) (tls.ConnectionState, bool) {
+	cfg.InsecureSkipVerify = true
+	conn, err := ep.dialTLS(timeout, cfg)
+	if err != nil {
+		return tls.ConnectionState{}, false
+	}
+	defer conn.Close()
+	return conn.ConnectionState(), true
+}
+
+// cipherVerdict rates a TLS 1.0-1.2 suite the server accepted. Suites crypto/tls lists as
+// insecure always fail; the note says why.
+func cipherVerdict(s *tls.CipherSuite, insecure bool) (string, string) {
+	name := s.Name
+	verdict, note := VerdictPass, "accepted"
+	switch {
+	case strings.Contains(name, "_RC4_"), strings.Contains(name, "_3DES_"):
+		verdict, note = VerdictFail, "weak cipher"
+	case strings.HasPrefix(name, "TLS_RSA_"):
+		verdict, note = VerdictWarn, "no forward secrecy"
+	case strings.Contains(name, "_CBC_"):
+		verdict, note = VerdictWarn, "CBC mode"
+	}
+	if insecure {
+		verdict = VerdictFail
+		if note == "accepted" {
+			note = "insecure"
+		}
+	}
+	return verdict, note
+}
+
+// ScanTLS enumerates the protocol versions, cipher suites and ALPN protocols the server
+// accepts and prints a verdict for each.
+func ScanTLS(domain string, timeout time.Duration, opts SSLCheckOptions) {
+	fmt.Println("")
+	PrintSectionHeader("TLS PROTOCOLS & CIPHERS")
+	scanTLSEndpoint(opts.endpoint(domain), timeout)
+}
+
+func scanTLSEndpoint(ep tlsEndpoint, timeout time.Duration) {
+	var rows []tlsScanRow
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, tlsScanConcurrency)
+	run := func(f func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			f()
+		}()
+	}
+
+	// Protocol versions
+	versionRows := make([]tlsScanRow, len(tlsScanVersions))
+	var tls13Suite string
+	for i, v := range tlsScanVersions {
+		run(func() {
+			state, ok := tlsProbe(ep, timeout, &tls.Config{MinVersion: v.version, MaxVersion: v.version})
+			row := tlsScanRow{Category: "Protocol", Item: v.name}
+			switch {
+			case ok && v.legacy:
+				row.Result, row.Verdict = "accepted (deprecated)", VerdictFail
+			case ok:
+				row.Result, row.Verdict = "accepted", VerdictPass
+			case v.legacy:
+				row.Result, row.Verdict = "rejected", VerdictPass
+			default:
+				row.Result, row.Verdict = "not supported", VerdictWarn
+			}
+			if ok && v.version == tls.VersionTLS13 {
+				mu.Lock()
+				tls13Suite = tls.CipherSuiteName(state.CipherSuite)
+				mu.Unlock()
+			}
+			versionRows[i] = row
+		})
+	}
+
+	// TLS 1.0-1.2 cipher suites, one handshake per suite.
+	type suite struct {
+		s        *tls.CipherSuite
+		insecure bool
+	}
+	var suites []suite
+	for _, s := range tls.CipherSuites() {
+		if !onlyTLS13(s) {
+			suites = append(suites, suite{s, false})
+		}
+	}
+	for _, s := range tls.InsecureCipherSuites() {
+		if !onlyTLS13(s) {
+			suites = append(suites, suite{s, true})
+		}
+	}
+	accepted := make([]bool, len(suites))
+	for i, s := range suites {
+		run(func() {
+			_, accepted[i] = tlsProbe(ep, timeout, &tls.Config{
+				MinVersion:   tls.VersionTLS10,
+				MaxVersion:   tls.VersionTLS12,
+				CipherSuites: []uint16{s.s.ID},
+			})
+		})
+	}
+
+	// TLS 1.3 cipher suites, one ServerHello per suite.
+	accepted13 := make([]bool, len(tls13Suites))
+	for i, s := range tls13Suites {
+		run(func() {
+			chosen, err := serverHelloCipher(ep, timeout, []uint16{s.id}, true)
+			accepted13[i] = err == nil && chosen == s.id
+		})
+	}
+
+	// ALPN
+	alpn := []string{"h2", "http/1.1"}
+	alpnOK := make([]bool, len(alpn))
+	for i, p := range alpn {
+		run(func() {
+			state, ok := tlsProbe(ep, timeout, &tls.Config{NextProtos: []string{p}})
+			alpnOK[i] = ok && state.NegotiatedProtocol == p
+		})
+	}
+	wg.Wait()
+
+	rows = append(rows, versionRows...)
+	var acceptedIDs []uint16
+	forwardSecret := false
+	for i, s := range suites {
+		if !accepted[i] {
+			continue
+		}
+		acceptedIDs = append(acceptedIDs, s.s.ID)
+		verdict, note := cipherVerdict(s.s, s.insecure)
+		if strings.HasPrefix(s.s.Name, "TLS_ECDHE_") {
+			forwardSecret = true
+		}
+		rows = append(rows, tlsScanRow{Category: "Cipher (≤1.2)", Item: s.s.Name, Result: note, Verdict: verdict})
+	}
+	found13 := false
+	for i, s := range tls13Suites {
+		if !accepted13[i] {
+			continue
+		}
+		found13 = true
+		row := tlsScanRow{Category: "Cipher (1.3)", Item: s.name, Result: "accepted", Verdict: VerdictPass}
+		if s.id == 0x1305 {
+			row.Result, row.Verdict = "short 8-byte tag", VerdictWarn
+		}
+		rows = append(rows, row)
+	}
+	if tls13Suite != "" && !found13 {
+		// The hand-built hello was refused (e.g. by a server needing other extensions), so
+		// only the suite crypto/tls negotiated is known.
+		rows = append(rows, tlsScanRow{Category: "Cipher (1.3)", Item: tls13Suite, Result: "negotiated (other 1.3 suites not enumerated)", Verdict: VerdictPass})
+	}
+	if len(acceptedIDs) > 0 && !forwardSecret {
+		rows = append(rows, tlsScanRow{Category: "Cipher (≤1.2)", Item: "Forward secrecy", Result: "no ECDHE suite accepted", Verdict: VerdictFail})
+	}
+
+	if len(acceptedIDs) >= 2 {
+		row := tlsScanRow{Category: "Cipher order", Item: "Server preference"}
+		pref, err := serverCipherPreference(ep, timeout, acceptedIDs[0], acceptedIDs[len(acceptedIDs)-1])
+		switch {
+		case err != nil:
+			row.Result, row.Verdict = "could not determine: "+err.Error(), VerdictInfo
+		case pref:
+			row.Result, row.Verdict = "server order", VerdictPass
+		default:
+			row.Result, row.Verdict = "client order", VerdictWarn
+		}
+		rows = append(rows, row)
+	}
+
+	for i, p := range alpn {
+		row := tlsScanRow{Category: "ALPN", Item: p}
+		switch {
+		case alpnOK[i]:
+			row.Result, row.Verdict = "supported", VerdictPass
+		case p == "h2":
+			row.Result, row.Verdict = "not supported", VerdictWarn
+		default:
+			row.Result, row.Verdict = "not negotiated", VerdictInfo
+		}
+		rows = append(rows, row)
+	}
+
+	data := make([][]string, 0, len(rows))
+	counts := map[string]int{}
+	for _, r := range rows {
+		data = append(data, []string{r.Category, r.Item, r.Result, colorVerdict(r.Verdict)})
+		counts[r.Verdict]++
+	}
+	RenderTable([]string{"Category", "Item", "Result", "Verdict"}, data)
+	fmt.Printf("%d pass, %d warn, %d fail\n", counts[VerdictPass], counts[VerdictWarn], counts[VerdictFail])
+}
+
+func onlyTLS13(s *tls.CipherSuite) bool {
+	for _, v := range s.SupportedVersions {
+		if v != tls.VersionTLS13 {
+			return false
+		}
+	}
+	return true
+}
+
+// serverCipherPreference offers the same two suites in both orders. If the server picks
+// the same suite each time it enforces its own order. crypto/tls ignores the configured
+// suite order, so this sends a minimal hand-built TLS 1.2 ClientHello instead.
+func serverCipherPreference(ep tlsEndpoint, timeout time.Duration, a, b uint16) (bool, error) {
+	first, err := serverHelloCipher(ep, timeout, []uint16{a, b}, false)
+	if err != nil {
+		return false, err
+	}
+	second, err := serverHelloCipher(ep, timeout, []uint16{b, a}, false)
+	if err != nil {
+		return false, err
+	}
+	return first == second, nil
+}
+
+// serverHelloCipher sends a ClientHello offering suites and returns the suite the
+// ServerHello selects. With tls13 set only TLS 1.3 is offered.
+func serverHelloCipher(ep tlsEndpoint, timeout time.Duration, suites []uint16, tls13 bool) (uint16, error) {
+	conn, err := ep.dialPlain(timeout)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	hello, err := buildClientHello(ep.ServerName, suites, tls13)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := conn.Write(hello); err != nil {
+		return 0, err
+	}
+	hdr := make([]byte, 5)
+	if _, err := io.ReadFull(conn, hdr); err != nil {
+		return 0, err
+	}
+	if hdr[0] == 0x15 {
+		return 0, errors.New("server sent an alert")
+	}
+	if hdr[0] != 0x16 {
+		return 0, errors.New("unexpected TLS record")
+	}
+	body := make([]byte, binary.BigEndian.Uint16(hdr[3:5]))
+	if _, err := io.ReadFull(conn, body); err != nil {
+		return 0, err
+	}
+	// handshake type(1) len(3) version(2) random(32) session_id_len(1)
+	if len(body) < 39 || body[0] != 0x02 {
+		return 0, errors.New("no ServerHello")
+	}
+	off := 38 + 1 + int(body[38])
+	if len(body) < off+2 {
+		return 0, errors.New("short ServerHello")
+	}
+	return binary.BigEndian.Uint16(body[off : off+2]), nil
+}
+
+// buildClientHello returns a TLS 1.2 ClientHello record offering exactly suites, in order.
+// With tls13 set it offers TLS 1.3 only, with an X25519 key share (RFC 8446 4.1.2).
+func buildClientHello(serverName string, suites []uint16, tls13 bool) ([]byte, error) {
+	u16 := func(b []byte, v int) []byte { return append(b, byte(v>>8), byte(v)) }
+	ext := func(b []byte, typ int, data []byte) []byte {
+		b = u16(b, typ)
+		b = u16(b, len(data))
+		return append(b, data...)
+	}
+
+	var exts []byte
+	if serverName != "" && net.ParseIP(serverName) == nil {
+		var sni []byte
+		sni = u16(sni, len(serverName)+3)
+		sni = append(sni, 0)
+		sni = u16(sni, len(serverName))
+		sni = append(sni, serverName...)
+		exts = ext(exts, 0x0000, sni)
+	}
+	exts = ext(exts, 0x000a, []byte{0x00, 0x06, 0x00, 0x1d, 0x00, 0x17, 0x00, 0x18}) // x25519, P-256, P-384
+	exts = ext(exts, 0x000b, []byte{0x01, 0x00})                                     // uncompressed points
+	exts = ext(exts, 0x000d, []byte{0x00, 0x12,
+		0x04, 0x03, 0x08, 0x04, 0x04, 0x01, 0x05, 0x03, 0x08, 0x05,
+		0x05, 0x01, 0x08, 0x06, 0x06, 0x01, 0x02, 0x01}) // signature algorithms
+	exts = ext(exts, 0xff01, []byte{0x00}) // renegotiation_info
+	sessionID := []byte{}
+	if tls13 {
+		key, err := ecdh.X25519().GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		pub := key.PublicKey().Bytes()
+		var share []byte
+		share = u16(share, len(pub)+4)
+		share = u16(share, 0x001d)
+		share = u16(share, len(pub))
+		share = append(share, pub...)
+		exts = ext(exts, 0x002b, []byte{0x02, 0x03, 0x04}) // supported_versions: TLS 1.3
+		exts = ext(exts, 0x0033, share)                    // key_share
+		exts = ext(exts, 0x002d, []byte{0x01, 0x01})       // psk_key_exchange_modes: psk_dhe_ke
+		// A legacy session ID, as sent for middlebox compatibility (RFC 8446 D.4).
+		sessionID = make([]byte, 32)
+		rand.Read(sessionID)
+	}
+
+	var hello []byte
+	hello = append(hello, 0x03, 0x03)
+	random := make([]byte, 32)
+	rand.Read(random)
+	hello = append(hello, random...)
+	hello = append(hello, byte(len(sessionID)))
+	hello = append(hello, sessionID...)
+	hello = u16(hello, len(suites)*2)
+	for _, s := range suites {
+		hello = u16(hello, int(s))
+	}
+	hello = append(hello, 0x01, 0x00) // null compression
+	hello = u16(hello, len(exts))
+	hello = append(hello, exts...)
+
+	hs := []byte{0x01, byte(len(hello) >> 16), byte(len(hello) >> 8), byte(len(hello))}
+	hs = append(hs, hello...)
+
+	rec := []byte{0x16, 0x03, 0x01}
+	rec = u16(rec, len(hs))
+	return append(rec, hs...), nil
+}
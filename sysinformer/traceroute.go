@@ -0,0 +1,604 @@
+package sysinformer
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/icmp"
+	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
+)
+
+// Traceroute probe protocols.
+const (
+	TraceProtoUDP  = "udp"
+	TraceProtoICMP = "icmp"
+	TraceProtoTCP  = "tcp"
+)
+
+const (
+	TRACE_MAX_HOPS      = 30
+	TRACE_PROBES        = 3
+	TRACE_PROBE_TIMEOUT = 2 * time.Second
+	traceUDPBasePort    = 33434
+	traceTCPDefaultPort = 80
+	traceReadBackoffMax = 500 * time.Millisecond
+)
+
+// errRawSocketUnavailable is returned when the native engine cannot open the raw ICMP
+// socket it needs to see Time Exceeded replies (usually a missing privilege).
+var errRawSocketUnavailable = errors.New("raw ICMP socket unavailable")
+
+// errTCPProbeUnsupported is returned for TCP probes on platforms where the engine cannot
+// set the TTL on an outgoing connection attempt.
+var errTCPProbeUnsupported = errors.New("tcp traceroute probes are not supported on this platform")
+
+// TraceOptions configures the native traceroute engine.
+type TraceOptions struct {
+	Protocol string // udp, icmp or tcp
+	Port     int    // destination port for udp/tcp probes (0 uses the protocol default)
+	Network  string // "ip4", "ip6" or "" to use whatever the target resolves to first
+	MaxHops  int
+	Probes   int
+	Timeout  time.Duration // per probe
+}
+
+// TraceHop is one TTL step of a traceroute. RTTs holds one entry per answered probe.
+type TraceHop struct {
+	TTL      int
+	IP       string
+	Hostname string
+	RTTs     []time.Duration
+	Lost     int
+	Reached  bool
+}
+
+func (h TraceHop) row() []string {
+	ip := h.IP
+	hostname := h.Hostname
+	if ip == "" {
+		ip = "*"
+		hostname = "*"
+	} else if hostname == "" {
+		hostname = ip
+	}
+	times := make([]string, 0, len(h.RTTs)+h.Lost)
+	for _, rtt := range h.RTTs {
+		times = append(times, fmt.Sprintf("%.2f ms", float64(rtt.Microseconds())/1000))
+	}
+	for i := 0; i < h.Lost; i++ {
+		times = append(times, "*")
+	}
+	return []string{strconv.Itoa(h.TTL), ip, hostname, strings.Join(times, ", ")}
+}
+
+func (o TraceOptions) withDefaults() TraceOptions {
+	o.Protocol = strings.ToLower(o.Protocol)
+	if o.Protocol == "" {
+		o.Protocol = TraceProtoUDP
+	}
+	if o.Port <= 0 {
+		switch o.Protocol {
+		case TraceProtoTCP:
+			o.Port = traceTCPDefaultPort
+		case TraceProtoUDP:
+			o.Port = traceUDPBasePort
+		}
+	}
+	if o.MaxHops <= 0 {
+		o.MaxHops = TRACE_MAX_HOPS
+	}
+	if o.Probes <= 0 {
+		o.Probes = TRACE_PROBES
+	}
+	if o.Timeout <= 0 {
+		o.Timeout = TRACE_PROBE_TIMEOUT
+	}
+	return o
+}
+
+// traceReply is what the ICMP reader (or a completed TCP handshake) reports for a probe.
+type traceReply struct {
+	from    net.IP
+	at      time.Time
+	reached bool
+}
+
+// tracer sends TTL-limited probes and matches the ICMP errors that come back. Probes are
+// keyed by a 16-bit value echoed back inside the quoted packet: the echo sequence number
+// for ICMP and the local source port for UDP and TCP.
+type tracer struct {
+	opts    TraceOptions
+	dst     net.IP
+	v6      bool
+	conn    *icmp.PacketConn
+	id      int
+	sendMu  sync.Mutex
+	mu      sync.Mutex
+	pending map[uint16]chan traceReply
+	seq     uint16
+	done    chan struct{}
+}
+
+func resolveTraceTarget(ctx context.Context, host string, network string) (net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return ip, nil
+	}
+	lookup := "ip"
+	if network == "ip4" || network == "ip6" {
+		lookup = network
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, lookup, host)
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses for %s", host)
+	}
+	return ips[0], nil
+}
+
+func newTracer(ctx context.Context, host string, opts TraceOptions) (*tracer, error) {
+	opts = opts.withDefaults()
+	switch opts.Protocol {
+	case TraceProtoUDP, TraceProtoICMP, TraceProtoTCP:
+	default:
+		return nil, fmt.Errorf("unknown traceroute protocol %q (use udp, icmp or tcp)", opts.Protocol)
+	}
+	if opts.Protocol == TraceProtoTCP && !tcpProbeSupported {
+		return nil, errTCPProbeUnsupported
+	}
+	dst, err := resolveTraceTarget(ctx, host, opts.Network)
+	if err != nil {
+		return nil, err
+	}
+	t := &tracer{
+		opts:    opts,
+		dst:     dst,
+		v6:      dst.To4() == nil,
+		id:      os.Getpid() & 0xffff,
+		pending: map[uint16]chan traceReply{},
+		done:    make(chan struct{}),
+	}
+	network, addr := "ip4:icmp", "0.0.0.0"
+	if t.v6 {
+		network, addr = "ip6:ipv6-icmp", "::"
+	}
+	t.conn, err = icmp.ListenPacket(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errRawSocketUnavailable, err)
+	}
+	go t.readLoop()
+	return t, nil
+}
+
+func (t *tracer) Close() {
+	close(t.done)
+	t.conn.Close()
+}
+
+func (t *tracer) register(key uint16) chan traceReply {
+	ch := make(chan traceReply, 1)
+	t.mu.Lock()
+	t.pending[key] = ch
+	t.mu.Unlock()
+	return ch
+}
+
+func (t *tracer) unregister(key uint16) {
+	t.mu.Lock()
+	delete(t.pending, key)
+	t.mu.Unlock()
+}
+
+func (t *tracer) deliver(key uint16, r traceReply) {
+	t.mu.Lock()
+	ch, ok := t.pending[key]
+	if ok {
+		delete(t.pending, key)
+	}
+	t.mu.Unlock()
+	if ok {
+		ch <- r
+	}
+}
+
+func (t *tracer) readLoop() {
+	proto := 1 // ICMPv4
+	if t.v6 {
+		proto = 58 // ICMPv6
+	}
+	buf := make([]byte, 1500)
+	failures := 0
+	for {
+		n, peer, err := t.conn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			// Back off on repeated errors instead of spinning on a broken socket.
+			failures++
+			backoff := min(time.Duration(failures)*10*time.Millisecond, traceReadBackoffMax)
+			select {
+			case <-t.done:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		failures = 0
+		at := time.Now()
+		msg, err := icmp.ParseMessage(proto, buf[:n])
+		if err != nil {
+			continue
+		}
+		from := peerIP(peer)
+
+		var quoted []byte
+		switch body := msg.Body.(type) {
+		case *icmp.Echo:
+			if t.opts.Protocol == TraceProtoICMP && body.ID == t.id &&
+				(msg.Type == ipv4.ICMPTypeEchoReply || msg.Type == ipv6.ICMPTypeEchoReply) {
+				t.deliver(uint16(body.Seq), traceReply{from: from, at: at, reached: true})
+			}
+			continue
+		case *icmp.TimeExceeded:
+			quoted = body.Data
+		case *icmp.DstUnreach:
+			quoted = body.Data
+		default:
+			continue
+		}
+		if key, ok := t.quotedKey(quoted); ok {
+			t.deliver(key, traceReply{from: from, at: at, reached: from.Equal(t.dst)})
+		}
+	}
+}
+
+func peerIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.IPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// quotedKey extracts the probe key from the original datagram quoted in an ICMP error.
+func (t *tracer) quotedKey(data []byte) (uint16, bool) {
+	var proto byte
+	var inner []byte
+	if t.v6 {
+		if len(data) < 40 {
+			return 0, false
+		}
+		proto, inner = data[6], data[40:]
+	} else {
+		if len(data) < 20 {
+			return 0, false
+		}
+		ihl := int(data[0]&0x0f) * 4
+		if len(data) < ihl {
+			return 0, false
+		}
+		proto, inner = data[9], data[ihl:]
+	}
+	if len(inner) < 8 {
+		return 0, false
+	}
+	switch {
+	case t.opts.Protocol == TraceProtoICMP && (proto == 1 || proto == 58):
+		if int(binary.BigEndian.Uint16(inner[4:6])) != t.id {
+			return 0, false
+		}
+		return binary.BigEndian.Uint16(inner[6:8]), true
+	case t.opts.Protocol == TraceProtoUDP && proto == 17, t.opts.Protocol == TraceProtoTCP && proto == 6:
+		return binary.BigEndian.Uint16(inner[0:2]), true
+	}
+	return 0, false
+}
+
+// probe sends a single probe with the given TTL and waits for its answer. ok is false
+// when nothing came back before the probe timeout.
+func (t *tracer) probe(ctx context.Context, ttl int) (reply traceReply, rtt time.Duration, ok bool) {
+	switch t.opts.Protocol {
+	case TraceProtoICMP:
+		return t.probeICMP(ctx, ttl)
+	case TraceProtoTCP:
+		return t.probeTCP(ctx, ttl)
+	default:
+		return t.probeUDP(ctx, ttl)
+	}
+}
+
+func (t *tracer) wait(ctx context.Context, ch chan traceReply, key uint16, start time.Time) (traceReply, time.Duration, bool) {
+	timer := time.NewTimer(t.opts.Timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r, r.at.Sub(start), true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	t.unregister(key)
+	return traceReply{}, 0, false
+}
+
+func (t *tracer) probeICMP(ctx context.Context, ttl int) (traceReply, time.Duration, bool) {
+	t.sendMu.Lock()
+	t.seq++
+	key := t.seq
+	var typ icmp.Type = ipv4.ICMPTypeEcho
+	if t.v6 {
+		typ = ipv6.ICMPTypeEchoRequest
+	}
+	msg := icmp.Message{Type: typ, Body: &icmp.Echo{ID: t.id, Seq: int(key), Data: []byte("sysinformer")}}
+	b, err := msg.Marshal(nil)
+	if err != nil {
+		t.sendMu.Unlock()
+		return traceReply{}, 0, false
+	}
+	if t.v6 {
+		err = t.conn.IPv6PacketConn().SetHopLimit(ttl)
+	} else {
+		err = t.conn.IPv4PacketConn().SetTTL(ttl)
+	}
+	if err != nil {
+		t.sendMu.Unlock()
+		return traceReply{}, 0, false
+	}
+	ch := t.register(key)
+	start := time.Now()
+	_, err = t.conn.WriteTo(b, &net.IPAddr{IP: t.dst})
+	t.sendMu.Unlock()
+	if err != nil {
+		t.unregister(key)
+		return traceReply{}, 0, false
+	}
+	return t.wait(ctx, ch, key, start)
+}
+
+func (t *tracer) probeUDP(ctx context.Context, ttl int) (traceReply, time.Duration, bool) {
+	network, laddr := "udp4", "0.0.0.0:0"
+	if t.v6 {
+		network, laddr = "udp6", "[::]:0"
+	}
+	c, err := net.ListenPacket(network, laddr)
+	if err != nil {
+		return traceReply{}, 0, false
+	}
+	// Keep the socket open until the probe completes so its source port stays unique.
+	defer c.Close()
+	if t.v6 {
+		err = ipv6.NewPacketConn(c).SetHopLimit(ttl)
+	} else {
+		err = ipv4.NewPacketConn(c).SetTTL(ttl)
+	}
+	if err != nil {
+		return traceReply{}, 0, false
+	}
+	key := uint16(c.LocalAddr().(*net.UDPAddr).Port)
+	ch := t.register(key)
+	start := time.Now()
+	if _, err := c.WriteTo([]byte("sysinformer"), &net.UDPAddr{IP: t.dst, Port: t.opts.Port}); err != nil {
+		t.unregister(key)
+		return traceReply{}, 0, false
+	}
+	return t.wait(ctx, ch, key, start)
+}
+
+// tcpProbeSocket is what the dialer's Control hook registered for a TCP probe.
+type tcpProbeSocket struct {
+	key   uint16
+	ch    chan traceReply
+	start time.Time
+}
+
+type dialResult struct {
+	conn net.Conn
+	err  error
+}
+
+func (t *tracer) probeTCP(ctx context.Context, ttl int) (traceReply, time.Duration, bool) {
+	ctx, cancel := context.WithTimeout(ctx, t.opts.Timeout)
+	defer cancel()
+	registered := make(chan tcpProbeSocket, 1)
+	dialer := &net.Dialer{
+		Control: func(network, address string, c syscall.RawConn) error {
+			port, err := prepareTCPProbeSocket(c, ttl, t.v6)
+			if err != nil {
+				return err
+			}
+			select {
+			case registered <- tcpProbeSocket{key: port, ch: t.register(port), start: time.Now()}:
+			default:
+			}
+			return nil
+		},
+	}
+	network := "tcp4"
+	if t.v6 {
+		network = "tcp6"
+	}
+	done := make(chan dialResult, 1)
+	go func() {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(t.dst.String(), strconv.Itoa(t.opts.Port)))
+		done <- dialResult{conn, err}
+	}()
+	closeConn := func(res dialResult) {
+		if res.conn != nil {
+			res.conn.Close()
+		}
+	}
+
+	var sock tcpProbeSocket
+	select {
+	case sock = <-registered:
+	case res := <-done:
+		// The socket could not be prepared, or the dial failed before sending.
+		closeConn(res)
+		return traceReply{}, 0, false
+	}
+
+	// An intermediate hop answers with an ICMP error while the dial is still waiting
+	// for a SYN-ACK, so the dial is abandoned as soon as that reply is matched.
+	select {
+	case r := <-sock.ch:
+		cancel()
+		closeConn(<-done)
+		return r, r.at.Sub(sock.start), true
+	case res := <-done:
+		closeConn(res)
+		if res.err == nil || isConnRefused(res.err) {
+			// A SYN-ACK or RST means the probe reached the destination.
+			t.unregister(sock.key)
+			return traceReply{from: t.dst, reached: true}, time.Since(sock.start), true
+		}
+		select {
+		case r := <-sock.ch:
+			return r, r.at.Sub(sock.start), true
+		default:
+			t.unregister(sock.key)
+			return traceReply{}, 0, false
+		}
+	}
+}
+
+// NativeTraceroute traces the path to host by sending TTL-limited probes itself. It returns
+// errRawSocketUnavailable (wrapped) when the process lacks the privilege to do so.
+func NativeTraceroute(ctx context.Context, host string, opts TraceOptions) ([]TraceHop, error) {
+	t, err := newTracer(ctx, host, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	return t.trace(ctx)
+}
+
+func (t *tracer) trace(ctx context.Context) ([]TraceHop, error) {
+	hops := []TraceHop{}
+	for ttl := 1; ttl <= t.opts.MaxHops && ctx.Err() == nil; ttl++ {
+		hop := TraceHop{TTL: ttl}
+		for p := 0; p < t.opts.Probes; p++ {
+			r, rtt, ok := t.probe(ctx, ttl)
+			if !ok {
+				hop.Lost++
+				continue
+			}
+			if hop.IP == "" {
+				hop.IP = r.from.String()
+			}
+			hop.RTTs = append(hop.RTTs, rtt)
+			hop.Reached = hop.Reached || r.reached
+		}
+		if ctx.Err() != nil && !hop.Reached {
+			// The probes were cut short, so the hop's losses are not real.
+			break
+		}
+		hops = append(hops, hop)
+		if hop.Reached {
+			break
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		// The partial path is still worth naming; the lookups have their own timeout.
+		resolveHopNames(context.Background(), hops)
+		return hops, err
+	}
+	resolveHopNames(ctx, hops)
+	return hops, nil
+}
+
+// resolveHopNames fills in reverse DNS names for all hops concurrently.
+func resolveHopNames(ctx context.Context, hops []TraceHop) {
+	names := map[string]string{}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, h := range hops {
+		if h.IP == "" {
+			continue
+		}
+		mu.Lock()
+		_, seen := names[h.IP]
+		names[h.IP] = ""
+		mu.Unlock()
+		if seen {
+			continue
+		}
+		wg.Add(1)
+		go func(ip string) {
+			defer wg.Done()
+			lctx, cancel := context.WithTimeout(ctx, TRACE_PROBE_TIMEOUT)
+			defer cancel()
+			if ptr, err := net.DefaultResolver.LookupAddr(lctx, ip); err == nil && len(ptr) > 0 {
+				mu.Lock()
+				names[ip] = strings.TrimSuffix(ptr[0], ".")
+				mu.Unlock()
+			}
+		}(h.IP)
+	}
+	wg.Wait()
+	for i := range hops {
+		hops[i].Hostname = names[hops[i].IP]
+	}
+}
+
+// traceRows runs the native engine and falls back to the system binary when raw sockets
+// are unavailable. The returned note explains a fallback, if one happened.
+func traceRows(domain string, opts TraceOptions, timeout time.Duration) (rows [][]string, raw string, note string, err error) {
+	effectiveTimeout := timeout
+	if effectiveTimeout < 30*time.Second {
+		effectiveTimeout = 30 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), effectiveTimeout)
+	defer cancel()
+
+	hops, err := NativeTraceroute(ctx, domain, opts)
+	if err == nil || (len(hops) > 0 && errors.Is(err, context.DeadlineExceeded)) {
+		for _, h := range hops {
+			rows = append(rows, h.row())
+		}
+		if err != nil {
+			note = fmt.Sprintf("Trace stopped after %d hops: the %s limit was reached before the destination answered.", len(hops), effectiveTimeout)
+		}
+		return rows, "", note, nil
+	}
+	if !errors.Is(err, errRawSocketUnavailable) && !errors.Is(err, errTCPProbeUnsupported) {
+		return nil, "", "", fmt.Errorf("traceroute failed: %v", err)
+	}
+	rows, raw, err = runTraceroute(domain, timeout)
+	note = "Native traceroute unavailable (raw sockets need root or CAP_NET_RAW); using system traceroute."
+	if ignored := opts.systemIgnored(); len(ignored) > 0 {
+		note += fmt.Sprintf("\nThe system traceroute runs with its own defaults and ignores %s.", strings.Join(ignored, ", "))
+	}
+	return rows, raw, note, err
+}
+
+// systemIgnored returns the flags behind the options the system traceroute fallback does
+// not honour.
+func (o TraceOptions) systemIgnored() []string {
+	var flags []string
+	if p := strings.ToLower(o.Protocol); p != "" && p != TraceProtoUDP {
+		flags = append(flags, "--trace-proto "+p)
+	}
+	if o.Port > 0 {
+		flags = append(flags, "--trace-port")
+	}
+	switch o.Network {
+	case "ip4":
+		flags = append(flags, "--ipv4")
+	case "ip6":
+		flags = append(flags, "--ipv6")
+	}
+	return flags
+}
@@ -0,0 +1,53 @@
+//go:build !windows
+
+package sysinformer
+
+import (
+	"errors"
+	"syscall"
+)
+
+const tcpProbeSupported = true
+
+// prepareTCPProbeSocket sets the TTL on a socket that is about to send a SYN and binds it
+// to an ephemeral port, returning that port so ICMP errors can be matched to the probe.
+func prepareTCPProbeSocket(c syscall.RawConn, ttl int, v6 bool) (uint16, error) {
+	var port uint16
+	var opErr error
+	err := c.Control(func(fd uintptr) {
+		s := int(fd)
+		if v6 {
+			if opErr = syscall.SetsockoptInt(s, syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, ttl); opErr != nil {
+				return
+			}
+			opErr = syscall.Bind(s, &syscall.SockaddrInet6{})
+		} else {
+			if opErr = syscall.SetsockoptInt(s, syscall.IPPROTO_IP, syscall.IP_TTL, ttl); opErr != nil {
+				return
+			}
+			opErr = syscall.Bind(s, &syscall.SockaddrInet4{})
+		}
+		if opErr != nil {
+			return
+		}
+		sa, err := syscall.Getsockname(s)
+		if err != nil {
+			opErr = err
+			return
+		}
+		switch a := sa.(type) {
+		case *syscall.SockaddrInet4:
+			port = uint16(a.Port)
+		case *syscall.SockaddrInet6:
+			port = uint16(a.Port)
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	return port, opErr
+}
+
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
@@ -0,0 +1,15 @@
+//go:build windows
+
+package sysinformer
+
+import "syscall"
+
+const tcpProbeSupported = false
+
+func prepareTCPProbeSocket(c syscall.RawConn, ttl int, v6 bool) (uint16, error) {
+	return 0, errTCPProbeUnsupported
+}
+
+func isConnRefused(err error) bool {
+	return false
+}
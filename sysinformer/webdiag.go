@@ -5,11 +5,11 @@ import (
 	"crypto/tls"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"os/exec"
+	"regexp"
 	"runtime"
 	"sort"
 	"strconv"
@@ -18,20 +18,164 @@ import (
 )
 
 type WebDiagOptions struct {
-	Target     string
-	Ping       bool
-	Latency    bool
-	DNS        bool
-	HTTP       bool
-	SSL        bool
-	Whois      bool
-	Trace      bool
-	Full       bool
-	TimeoutSec int
-	Count      int
+	Target       string
+	Ping         bool
+	Latency      bool
+	DNS          bool
+	HTTP         bool
+	SSL          bool
+	Whois        bool
+	Trace        bool
+	MTR          bool
+	Full         bool
+	TimeoutSec   int
+	Count        int
+	LatencyCount int
+	Cycles       int
+	MTRJSON      string
+	TraceProto   string
+	TracePort    int
+	IPVersion    int // 4 or 6 to force an address family for traceroute/MTR, 0 for either
+	ASNDBs       []string
+	MaxRedirects int
+	NoFollow     bool
+	CAFile       string
+	TLSScan      bool
+	Port         int // port for the SSL check and TLS scan, 443 when unset
+	StartTLS     string
+	SNI          string
+	Revocation   bool
+	OCSPURL      string
+	Resolver     string   // DNS server for the DNS check, system resolver when empty
+	Compare      []string // resolvers to compare; "system" is the system resolver
+	DNSSEC       bool
+	TrustAnchor  string // DS records or a file of them for the root, IANA anchors when empty
+	Email        bool
+	DKIM         []string // DKIM selectors for the email check
+	RDAP         string   // RDAP bootstrap file to use instead of the embedded IANA data
+	WhoisServer  string   // WHOIS server to query instead of RDAP and whois.iana.org
+	TargetsFile  string   // file of targets for a batch run ("-" for stdin); Target is ignored
+	Concurrency  int      // targets checked at once in a batch run
+	Detail       bool     // print per-target detail after the batch summary
+	Assertions   WebAssertions
+	AssertFile   string // spec file of further assertions, see LoadAssertions
+	Method       string
+	Headers      []string
+	BasicAuth    string // user:password
+	Bearer       string
+	Body         []byte
+	UserAgent    string
+	ClientCert   string
+	ClientKey    string
+	Insecure     bool
+	Proxy        string
+	Resolve      []string // host:port:ip pins for the HTTP requests
+	Protocols    bool
+	HTTP3        bool // also try HTTP/3 in the protocol check
+	DualStack    bool
+	PerIP        bool // check every resolved address as a separate backend
+	Page         bool
+	PageDepth    int // link levels crawled by the page check
+	WellKnown    bool
+}
+
+func (o WebDiagOptions) dnsOptions() (DNSCheckOptions, error) {
+	var d DNSCheckOptions
+	if o.Resolver != "" {
+		s, err := ParseDNSServer(o.Resolver)
+		if err != nil {
+			return d, fmt.Errorf("--resolver: %w", err)
+		}
+		d.Resolver = s
+	}
+	for _, spec := range o.Compare {
+		if strings.EqualFold(spec, "system") {
+			d.Compare = append(d.Compare, nil)
+			continue
+		}
+		s, err := ParseDNSServer(spec)
+		if err != nil {
+			return d, fmt.Errorf("--compare-resolvers: %w", err)
+		}
+		d.Compare = append(d.Compare, s)
+	}
+	return d, nil
+}
+
+func (o WebDiagOptions) sslOptions() SSLCheckOptions {
+	return SSLCheckOptions{
+		CAFile:     o.CAFile,
+		Port:       o.Port,
+		StartTLS:   o.StartTLS,
+		SNI:        o.SNI,
+		Revocation: o.Revocation,
+		OCSPURL:    o.OCSPURL,
+	}
+}
+
+// sslOptionsFor returns the certificate check options for a check against u. Like CheckSSL,
+// the certificate is read from --port (default 443) whatever the scheme, and an https URL
+// with its own port is used when --port is not given. SNI defaults to u's host so that the
+// right certificate comes back when an address is dialled instead of the name.
+func (o WebDiagOptions) sslOptionsFor(u *url.URL) SSLCheckOptions {
+	s := o.sslOptions()
+	if s.Port == 0 && u.Scheme == "https" && u.Port() != "" {
+		s.Port, _ = strconv.Atoi(u.Port())
+	}
+	if s.SNI == "" {
+		s.SNI = u.Hostname()
+	}
+	return s
+}
+
+func (o WebDiagOptions) requestOptions() HTTPRequestOptions {
+	return HTTPRequestOptions{
+		Method:    o.Method,
+		Headers:   o.Headers,
+		BasicAuth: o.BasicAuth,
+		Bearer:    o.Bearer,
+		Body:      o.Body,
+		UserAgent: o.UserAgent,
+		CertFile:  o.ClientCert,
+		KeyFile:   o.ClientKey,
+		CAFile:    o.CAFile,
+		Insecure:  o.Insecure,
+		Proxy:     o.Proxy,
+		Resolve:   o.Resolve,
+	}
+}
+
+func (o WebDiagOptions) traceOptions() TraceOptions {
+	t := TraceOptions{Protocol: o.TraceProto, Port: o.TracePort}
+	switch o.IPVersion {
+	case 4:
+		t.Network = "ip4"
+	case 6:
+		t.Network = "ip6"
+	}
+	return t
 }
 
 func ValidateTarget(ctx context.Context, raw string) (normalizedURL string, domain string, err error) {
+	return validateTargetWith(ctx, raw, net.DefaultResolver)
+}
+
+// validateTargetWith is ValidateTarget resolving through r, so that names only a custom
+// --resolver knows about (split horizon) are accepted.
+func validateTargetWith(ctx context.Context, raw string, r *net.Resolver) (normalizedURL string, domain string, err error) {
+	normalizedURL, domain, err = parseTarget(raw)
+	if err != nil {
+		return "", "", err
+	}
+	// Resolve to ensure it exists
+	if _, err := r.LookupHost(ctx, domain); err != nil {
+		return "", "", err
+	}
+	return normalizedURL, domain, nil
+}
+
+// parseTarget normalizes raw to a URL (http:// when no scheme is given) and extracts its host.
+func parseTarget(raw string) (normalizedURL string, domain string, err error) {
 	if raw == "" {
 		return "", "", errors.New("empty target")
 	}
@@ -52,11 +196,6 @@ func ValidateTarget(ctx context.Context, raw string) (normalizedURL string, doma
 	if host == "" {
 		return "", "", fmt.Errorf("invalid host: %q", raw)
 	}
-
-	// Resolve to ensure it exists
-	if _, err := net.DefaultResolver.LookupHost(ctx, host); err != nil {
-		return "", "", err
-	}
 	return u.String(), host, nil
 }
 
@@ -67,63 +206,152 @@ func RunWebDiagnostics(opts WebDiagOptions) error {
 	if opts.Count <= 0 {
 		opts.Count = 4
 	}
+	if opts.LatencyCount <= 0 {
+		opts.LatencyCount = 3
+	}
+	if opts.MaxRedirects == 0 {
+		opts.MaxRedirects = DEFAULT_MAX_REDIRECTS
+	}
 
 	// Create a context with timeout for DNS validation
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(opts.TimeoutSec)*time.Second)
 	defer cancel()
 
-	nURL, domain, err := ValidateTarget(ctx, opts.Target)
+	if opts.StartTLS != "" && !validStartTLS(strings.ToLower(opts.StartTLS)) {
+		return fmt.Errorf("unknown --starttls protocol %q (use smtp, imap, pop3, ldap, postgres, ftp or none)", opts.StartTLS)
+	}
+
+	if err := opts.requestOptions().validate(); err != nil {
+		return err
+	}
+
+	if opts.TargetsFile != "" {
+		// Assertions are reported and enforced for one target only.
+		if !opts.Assertions.empty() || opts.AssertFile != "" {
+			return errors.New("assertions (--expect-*, --max-latency, --min-cert-days, --assert-file) cannot be combined with --targets-file")
+		}
+		return RunBatchWebDiagnostics(opts)
+	}
+
+	dnsOpts, err := opts.dnsOptions()
 	if err != nil {
 		return err
 	}
 
+	assertions := opts.Assertions
+	if opts.AssertFile != "" {
+		spec, err := LoadAssertions(opts.AssertFile)
+		if err != nil {
+			return fmt.Errorf("loading assertions: %w", err)
+		}
+		assertions = assertions.merge(spec)
+	}
+
+	nURL, domain, err := validateTargetWith(ctx, opts.Target, dnsOpts.Resolver.Resolver())
+	if err != nil {
+		// A host pinned with --resolve need not be in DNS at all.
+		if pURL, pHost, perr := parseTarget(opts.Target); perr == nil && opts.requestOptions().pinned(pHost) {
+			nURL, domain, err = pURL, pHost, nil
+		} else {
+			return dnsOpts.Resolver.annotateErr(err)
+		}
+	}
+
+	enrich, err := LoadIPEnricher(opts.ASNDBs)
+	if err != nil {
+		return fmt.Errorf("loading ASN database: %w", err)
+	}
+
 	subtitle := nURL
 	PrintPanel("Website Diagnostic", subtitle)
 
-	runAll := opts.Full || !(opts.Ping || opts.Latency || opts.DNS || opts.HTTP || opts.SSL || opts.Whois || opts.Trace)
+	runAll := opts.Full || !(opts.Ping || opts.Latency || opts.DNS || opts.HTTP || opts.SSL || opts.Whois || opts.Trace || opts.MTR || opts.TLSScan || opts.DNSSEC || opts.Email || opts.Protocols || opts.HTTP3 || opts.DualStack || opts.PerIP || opts.Page || opts.WellKnown || len(opts.Compare) > 0 || !assertions.empty())
 
 	if opts.Ping || runAll {
 		PingWebsite(domain, opts.Count, time.Duration(opts.TimeoutSec)*time.Second)
 	}
 	if opts.Latency || runAll {
-		CheckLatency(nURL, 3, time.Duration(opts.TimeoutSec)*time.Second)
+		CheckLatency(nURL, opts.LatencyCount, time.Duration(opts.TimeoutSec)*time.Second, opts.requestOptions())
 	}
-	if opts.DNS || runAll {
-		CheckDNS(domain, time.Duration(opts.TimeoutSec)*time.Second)
+	if opts.DNS || runAll || len(dnsOpts.Compare) > 0 {
+		CheckDNS(domain, time.Duration(opts.TimeoutSec)*time.Second, enrich, dnsOpts)
 	}
 	if opts.HTTP || runAll {
-		CheckHTTPStatusAndHeaders(nURL, time.Duration(opts.TimeoutSec)*time.Second)
+		CheckHTTPStatusAndHeaders(nURL, time.Duration(opts.TimeoutSec)*time.Second, HTTPCheckOptions{
+			MaxRedirects: opts.MaxRedirects,
+			NoFollow:     opts.NoFollow,
+			Request:      opts.requestOptions(),
+		})
 	}
 	if opts.SSL || runAll {
-		CheckSSL(domain, time.Duration(opts.TimeoutSec)*time.Second)
+		CheckSSL(domain, time.Duration(opts.TimeoutSec)*time.Second, opts.sslOptions())
 	}
 	if opts.Whois || runAll {
-		CheckWhois(domain, time.Duration(opts.TimeoutSec)*time.Second)
+		CheckWhois(domain, time.Duration(opts.TimeoutSec)*time.Second, WhoisOptions{Bootstrap: opts.RDAP, Server: opts.WhoisServer})
 	}
 	if opts.Trace || runAll {
-		TraceRoute(domain, time.Duration(opts.TimeoutSec)*time.Second)
+		TraceRoute(domain, opts.traceOptions(), time.Duration(opts.TimeoutSec)*time.Second, enrich)
+	}
+	// Mail domains are often not web hosts, so the email check only runs when requested.
+	if opts.Email {
+		CheckEmail(domain, time.Duration(opts.TimeoutSec)*time.Second, EmailCheckOptions{
+			Selectors: opts.DKIM,
+			Resolver:  dnsOpts.Resolver,
+			CAFile:    opts.CAFile,
+		})
+	}
+	// The dual-stack check repeats ping, connect, HTTP and TLS for every address, so it
+	// only runs when requested.
+	if opts.DualStack {
+		CheckDualStack(nURL, opts, dnsOpts.Resolver.Resolver())
+	}
+	if opts.PerIP {
+		CheckBackends(nURL, opts, dnsOpts.Resolver.Resolver())
+	}
+	// The page check downloads every resource the page loads and crawls its links, so it
+	// only runs when requested.
+	if opts.Page {
+		CheckPage(nURL, opts.PageDepth, time.Duration(opts.TimeoutSec)*time.Second, opts.requestOptions())
+	}
+	// The protocol check repeats the request over HTTP/1.1 and HTTP/2 (and HTTP/3), so it
+	// only runs when requested.
+	if opts.Protocols || opts.HTTP3 {
+		CheckHTTPProtocols(nURL, opts.LatencyCount, time.Duration(opts.TimeoutSec)*time.Second, opts.requestOptions(), opts.HTTP3)
+	}
+	// The well-known check fetches several endpoints and every sitemap, so it only runs
+	// when requested.
+	if opts.WellKnown {
+		CheckWellKnown(nURL, time.Duration(opts.TimeoutSec)*time.Second, opts.requestOptions())
+	}
+	// DNSSEC validation walks every zone from the root, so it only runs when requested.
+	if opts.DNSSEC {
+		CheckDNSSEC(domain, time.Duration(opts.TimeoutSec)*time.Second, dnsOpts.Resolver, opts.TrustAnchor)
+	}
+	// The TLS scan makes dozens of handshakes, so like MTR it only runs when requested.
+	if opts.TLSScan {
+		ScanTLS(domain, time.Duration(opts.TimeoutSec)*time.Second, opts.sslOptions())
+	}
+	// MTR runs for several cycles, so it is only run when explicitly requested.
+	if opts.MTR {
+		PrintMTR(domain, opts.traceOptions(), opts.Cycles, time.Duration(opts.TimeoutSec)*time.Second, opts.MTRJSON)
+	}
+	// Assertions run last so their verdicts are the final thing printed.
+	if !assertions.empty() {
+		err = CheckAssertions(assertions, nURL, domain, opts, dnsOpts.Resolver.Resolver())
 	}
 
 	PrintPanel("Diagnostic complete", "")
-	return nil
+	return err
 }
 
 func PingWebsite(domain string, count int, timeout time.Duration) {
 	fmt.Println("")
 	PrintSectionHeader("PING")
 
-	pingParam := "-c"
-	if runtime.GOOS == "windows" {
-		pingParam = "-n"
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-	cmd := exec.CommandContext(ctx, "ping", pingParam, fmt.Sprintf("%d", count), domain)
-	out, err := cmd.CombinedOutput()
+	text, err := runPing(domain, count, timeout)
 	// If the context timed out or was canceled, report and return.
-	if ctx.Err() != nil {
-		fmt.Printf("Ping canceled or timed out: %v\n", ctx.Err())
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+		fmt.Printf("Ping canceled or timed out: %v\n", err)
 		return
 	}
 	// Some ping implementations return a non-zero exit code even when providing
@@ -132,7 +360,6 @@ func PingWebsite(domain string, count int, timeout time.Duration) {
 	if err != nil {
 		fmt.Printf("Ping reported error (continuing to parse output): %v\n", err)
 	}
-	text := string(out)
 
 	// Best-effort summaries across OSes
 	summary := []string{}
@@ -150,51 +377,138 @@ func PingWebsite(domain string, count int, timeout time.Duration) {
 	}
 }
 
-func CheckLatency(targetURL string, count int, timeout time.Duration) {
+// runPing runs the system ping and returns its output. When the timeout expires the
+// context error is returned instead of the exit status.
+func runPing(domain string, count int, timeout time.Duration) (string, error) {
+	pingParam := "-c"
+	if runtime.GOOS == "windows" {
+		pingParam = "-n"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "ping", pingParam, fmt.Sprintf("%d", count), domain)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return string(out), ctx.Err()
+	}
+	return string(out), err
+}
+
+// pingLossRe matches "25% packet loss" (Linux, macOS) and "(25% loss)" (Windows).
+var pingLossRe = regexp.MustCompile(`([0-9.]+)% (?:packet )?loss`)
+
+// parsePingLoss extracts the packet loss percentage from ping output.
+func parsePingLoss(text string) (float64, bool) {
+	m := pingLossRe.FindStringSubmatch(text)
+	if m == nil {
+		return 0, false
+	}
+	loss, err := strconv.ParseFloat(m[1], 64)
+	return loss, err == nil
+}
+
+func CheckLatency(targetURL string, count int, timeout time.Duration, reqOpts HTTPRequestOptions) {
 	fmt.Println("")
 	PrintSectionHeader("LATENCY")
 
-	client := &http.Client{Timeout: timeout}
+	// Keep-alives are disabled so every request pays for its own DNS lookup, connect and
+	// handshake, which is what makes the per-phase breakdown meaningful.
+	client, err := reqOpts.client(timeout, false)
+	if err != nil {
+		fmt.Printf("Could not set up requests: %v\n", err)
+		return
+	}
+	if reqOpts.custom() {
+		fmt.Printf("Request: %s\n", reqOpts.describe())
+	}
 
-	headers := []string{"Request #", "Response Time (ms)", "Status"}
+	headers := []string{"Request #", "DNS", "Connect", "TLS", "TTFB", "Transfer", "Total (ms)", "Status"}
 	rows := make([][]string, 0, count)
 
+	var timings []httpTiming
 	var total float64
-	var ok int
 	for i := 1; i <= count; i++ {
-		start := time.Now()
-		resp, err := client.Get(targetURL)
+		req, err := reqOpts.request(targetURL)
+		if err != nil {
+			fmt.Printf("Could not build request: %v\n", err)
+			return
+		}
+		t, resp, err := timedRequest(client, req)
 		if err != nil {
-			rows = append(rows, []string{fmt.Sprintf("%d", i), "N/A", "Failed"})
+			rows = append(rows, []string{fmt.Sprintf("%d", i), "-", "-", "-", "-", "-", "N/A", "Failed"})
 			continue
 		}
-		io.Copy(io.Discard, resp.Body)
-		resp.Body.Close()
 
-		ms := float64(time.Since(start).Milliseconds())
 		status := fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
-		rows = append(rows, []string{fmt.Sprintf("%d", i), fmt.Sprintf("%.0f", ms), status})
-		total += ms
-		ok++
+		rows = append(rows, []string{
+			fmt.Sprintf("%d", i),
+			formatMs(t.DNS),
+			formatMs(t.Connect),
+			formatMs(t.TLS),
+			formatMs(t.TTFB),
+			formatMs(t.Transfer),
+			formatMs(t.Total),
+			status,
+		})
+		timings = append(timings, t)
+		total += float64(t.Total.Microseconds()) / 1000
 	}
 
 	RenderTable(headers, rows)
-	if ok > 0 {
-		fmt.Printf("Average response time: %.2f ms\n", total/float64(ok))
+	if len(timings) > 0 {
+		RenderTable([]string{"Phase", "Min (ms)", "Avg (ms)", "Max (ms)"}, phaseSummaryRows(timings))
+		fmt.Printf("Average response time: %.2f ms\n", total/float64(len(timings)))
 	} else {
 		fmt.Println("Could not measure latency - all requests failed")
 	}
 }
 
-func CheckDNS(domain string, timeout time.Duration) {
+// DNSCheckOptions selects the resolver the DNS check queries.
+type DNSCheckOptions struct {
+	Resolver *DNSServer   // nil for the system resolver
+	Compare  []*DNSServer // resolvers to compare side by side; nil entries mean the system resolver
+}
+
+func CheckDNS(domain string, timeout time.Duration, enrich *IPEnricher, opts DNSCheckOptions) {
 	fmt.Println("")
 	PrintSectionHeader("DNS")
 
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
 
+	server := opts.Resolver
+	if server != nil {
+		fmt.Printf("Resolver: %s (%s)\n", server, server.Transport)
+	} else if s, err := systemDNSServer(); err == nil {
+		server = s
+	}
+	var records []dnsRecord
+	var lookupErrs map[string]string
+	var err error
+	if server != nil {
+		records, lookupErrs, err = lookupDNSRecords(ctx, server, domain)
+	}
+	switch {
+	case server == nil || (err != nil && opts.Resolver == nil):
+		// No nameserver to query directly (e.g. Windows), or the name only resolves
+		// through the hosts file or mDNS: use the platform resolver.
+		checkDNSWithResolver(ctx, domain, net.DefaultResolver, enrich)
+	case err != nil:
+		fmt.Printf("DNS lookup failed: %v\n", server.annotateErr(err))
+	default:
+		printDNSRecords(records, lookupErrs, enrich)
+	}
+
+	if len(opts.Compare) > 0 {
+		CompareResolvers(domain, opts.Compare, timeout)
+	}
+}
+
+// checkDNSWithResolver shows A/AAAA, MX, NS and TXT through r, without TTLs.
+func checkDNSWithResolver(ctx context.Context, domain string, resolver *net.Resolver, enrich *IPEnricher) {
 	// A/AAAA via net
-	if ips, err := net.DefaultResolver.LookupIPAddr(ctx, domain); err == nil {
+	if ips, err := resolver.LookupIPAddr(ctx, domain); err == nil {
 		sort.Slice(ips, func(i, j int) bool { return ips[i].IP.String() < ips[j].IP.String() })
 		rows := [][]string{}
 		for _, ip := range ips {
@@ -202,15 +516,24 @@ func CheckDNS(domain string, timeout time.Duration) {
 			if ip.IP.To4() == nil {
 				kind = "AAAA"
 			}
-			rows = append(rows, []string{kind, ip.IP.String()})
+			row := []string{kind, ip.IP.String()}
+			if enrich.Enabled() {
+				info, _ := enrich.Lookup(ip.IP)
+				row = append(row, info.asnString(), orDash(info.Org), orDash(info.Country))
+			}
+			rows = append(rows, row)
+		}
+		if enrich.Enabled() {
+			RenderTable([]string{"Record", "Value", "ASN", "AS Name", "Country"}, rows)
+		} else {
+			RenderTable([]string{"Record", "Value"}, rows)
 		}
-		RenderTable([]string{"Record", "Value"}, rows)
 	} else {
 		fmt.Printf("DNS lookup failed: %v\n", err)
 	}
 
 	// MX / NS via net
-	if mx, err := net.DefaultResolver.LookupMX(ctx, domain); err == nil {
+	if mx, err := resolver.LookupMX(ctx, domain); err == nil {
 		rows := [][]string{}
 		sort.Slice(mx, func(i, j int) bool { return mx[i].Pref < mx[j].Pref })
 		for _, r := range mx {
@@ -220,7 +543,7 @@ func CheckDNS(domain string, timeout time.Duration) {
 			RenderTable([]string{"Record", "Value"}, rows)
 		}
 	}
-	if ns, err := net.DefaultResolver.LookupNS(ctx, domain); err == nil {
+	if ns, err := resolver.LookupNS(ctx, domain); err == nil {
 		rows := [][]string{}
 		for _, r := range ns {
 			rows = append(rows, []string{"NS", strings.TrimSuffix(r.Host, ".")})
@@ -229,7 +552,7 @@ func CheckDNS(domain string, timeout time.Duration) {
 			RenderTable([]string{"Record", "Value"}, rows)
 		}
 	}
-	if txt, err := net.DefaultResolver.LookupTXT(ctx, domain); err == nil {
+	if txt, err := resolver.LookupTXT(ctx, domain); err == nil {
 		rows := [][]string{}
 		for _, r := range txt {
 			rows = append(rows, []string{"TXT", r})
@@ -240,20 +563,40 @@ func CheckDNS(domain string, timeout time.Duration) {
 	}
 }
 
-func CheckHTTPStatusAndHeaders(targetURL string, timeout time.Duration) {
+// HTTPCheckOptions controls how the HTTP status check issues its request.
+type HTTPCheckOptions struct {
+	MaxRedirects int
+	NoFollow     bool
+	Request      HTTPRequestOptions
+}
+
+func CheckHTTPStatusAndHeaders(targetURL string, timeout time.Duration, opts HTTPCheckOptions) {
 	fmt.Println("")
 	PrintSectionHeader("HTTP STATUS & HEADERS")
 
-	client := &http.Client{Timeout: timeout}
-	resp, err := client.Get(targetURL)
+	client, err := opts.Request.client(timeout, true)
+	if err != nil {
+		fmt.Printf("Could not set up requests: %v\n", err)
+		return
+	}
+	if opts.Request.custom() {
+		fmt.Printf("Request: %s\n", opts.Request.describe())
+	}
+	chain, err := followRedirects(client, opts.Request, targetURL, opts.MaxRedirects, opts.NoFollow)
+	if chain != nil {
+		printRedirectChain(chain, opts.MaxRedirects)
+	}
 	if err != nil {
 		fmt.Printf("HTTP request failed: %v\n", err)
 		return
 	}
-	io.Copy(io.Discard, resp.Body)
-	resp.Body.Close()
+	resp := chain.Final
 
 	fmt.Printf("Status: %d %s\n", resp.StatusCode, http.StatusText(resp.StatusCode))
+	fmt.Printf("Protocol: %s\n", resp.Proto)
+	if len(chain.Hops) > 1 {
+		fmt.Printf("Final URL: %s (%d redirects)\n", resp.Request.URL, len(chain.Hops)-1)
+	}
 
 	rows := [][]string{}
 	keys := make([]string, 0, len(resp.Header))
@@ -270,31 +613,41 @@ func CheckHTTPStatusAndHeaders(targetURL string, timeout time.Duration) {
 		rows = append(rows, []string{k, val})
 	}
 	RenderKeyValueTable("Header", "Value", rows)
+
+	printSecurityHeaderAudit(resp.Header, resp.Request.URL.Scheme == "https")
+}
+
+// SSLCheckOptions controls how the certificate check connects and verifies.
+type SSLCheckOptions struct {
+	CAFile   string // PEM bundle to trust instead of the system roots
+	Port     int    // defaults to 443
+	StartTLS string // protocol to upgrade with; empty guesses from the port
+	SNI      string // server name to send and verify instead of the target
+
+	Revocation bool   // also query the OCSP responders and CRLs listed in the leaf
+	OCSPURL    string // OCSP responder to query instead of the one in the certificate
 }
 
-func CheckSSL(domain string, timeout time.Duration) {
+func CheckSSL(domain string, timeout time.Duration, opts SSLCheckOptions) {
 	fmt.Println("")
 	PrintSectionHeader("SSL/TLS CERTIFICATE")
 
-	dialer := &net.Dialer{Timeout: timeout}
-	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(domain, "443"), &tls.Config{ServerName: domain})
+	roots, err := loadCertPool(opts.CAFile)
 	if err != nil {
-		fmt.Printf("SSL check failed: %v\n", err)
+		fmt.Printf("Could not load trust roots: %v\n", err)
 		return
 	}
-	defer conn.Close()
 
-	state := conn.ConnectionState()
-	if len(state.PeerCertificates) == 0 {
-		fmt.Println("No peer certificate presented")
+	insp, err := inspectCert(domain, timeout, opts, roots)
+	if err != nil {
+		fmt.Printf("SSL check failed: %v\n", err)
 		return
 	}
+	ep, state, problems, now := insp.Endpoint, insp.State, insp.Problems, insp.Now
 	leaf := state.PeerCertificates[0]
-
-	isValid := time.Now().After(leaf.NotBefore) && time.Now().Before(leaf.NotAfter)
-	status := "Valid"
-	if !isValid {
-		status = "Invalid"
+	status := "\033[92mValid\033[0m"
+	if len(problems) > 0 {
+		status = "\033[91mInvalid\033[0m"
 	}
 
 	issuer := leaf.Issuer.Organization
@@ -315,17 +668,49 @@ func CheckSSL(domain string, timeout time.Duration) {
 		sanStr = sanStr + fmt.Sprintf("\n... and %d more", len(sans)-5)
 	}
 
+	days := daysUntil(leaf.NotAfter, now)
+	endpoint := ep.Addr
+	if ep.StartTLS != StartTLSNone {
+		endpoint += " (STARTTLS " + ep.StartTLS + ")"
+	}
 	rows := [][]string{
+		{"Endpoint", endpoint},
+		{"Server Name", ep.ServerName},
+		{"Protocol", tls.VersionName(state.Version)},
 		{"Common Name", leaf.Subject.CommonName},
 		{"Issuer", issuerStr},
 		{"Valid From", leaf.NotBefore.Format("2006-01-02 15:04:05")},
 		{"Valid Until", leaf.NotAfter.Format("2006-01-02 15:04:05")},
+		{"Days Until Expiry", expiryStatus(days, SSL_WARN_DAYS, SSL_CRIT_DAYS)},
 		{"Status", status},
 	}
 	if sanStr != "" {
 		rows = append(rows, []string{"Subject Alternative Names", sanStr})
 	}
 	RenderTable([]string{"Field", "Value"}, rows)
+
+	printCertChain(state.PeerCertificates, now)
+
+	trustedBy := "system roots"
+	if opts.CAFile != "" {
+		trustedBy = opts.CAFile
+	}
+	if len(problems) == 0 {
+		fmt.Printf("\033[92mChain verified against %s\033[0m\n", trustedBy)
+	} else {
+		fmt.Printf("\033[91mVerification against %s failed:\033[0m\n", trustedBy)
+		for _, p := range problems {
+			fmt.Printf("  - %s\n", p)
+		}
+	}
+	for i, c := range state.PeerCertificates {
+		d := daysUntil(c.NotAfter, now)
+		if d >= 0 && d <= SSL_WARN_DAYS {
+			fmt.Printf("\033[93mWarning: %s expires in %d days\033[0m\n", certLabel(i, c), d)
+		}
+	}
+
+	printRevocation(checkRevocation(state.PeerCertificates, state.OCSPResponse, opts.Revocation, opts.OCSPURL, timeout))
 }
 
 func limitStrings(in []string, n int) []string {
@@ -338,10 +723,37 @@ func limitStrings(in []string, n int) []string {
 	return in[:n]
 }
 
-func TraceRoute(domain string, timeout time.Duration) {
+func TraceRoute(domain string, opts TraceOptions, timeout time.Duration, enrich *IPEnricher) {
 	fmt.Println("")
 	PrintSectionHeader("TRACEROUTE")
 
+	rows, text, note, err := traceRows(domain, opts, timeout)
+	if note != "" {
+		fmt.Println(note)
+	}
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if len(rows) == 0 && text == "" {
+		fmt.Println("No traceroute output")
+		return
+	}
+	if len(rows) == 0 {
+		fmt.Println(text)
+		return
+	}
+	if enrich.Enabled() {
+		RenderTable([]string{"Hop", "IP", "Hostname", "Time", "ASN", "AS Name", "Country"}, enrich.annotateTraceRows(rows))
+		fmt.Println("» marks the first hop in a new autonomous system")
+		return
+	}
+	RenderTable([]string{"Hop", "IP", "Hostname", "Time"}, rows)
+}
+
+// runTraceroute runs the system traceroute/tracert and returns the parsed hop rows
+// ([hop, ip, hostname, time]) along with the raw output. Errors are phrased for display.
+func runTraceroute(domain string, timeout time.Duration) ([][]string, string, error) {
 	cmdName := "traceroute"
 	args := []string{domain}
 	isWindows := runtime.GOOS == "windows"
@@ -351,8 +763,7 @@ func TraceRoute(domain string, timeout time.Duration) {
 	}
 
 	if _, err := exec.LookPath(cmdName); err != nil {
-		fmt.Printf("%s not found on PATH. Install it (e.g. 'brew install traceroute' on macOS) or omit --trace.\n", cmdName)
-		return
+		return nil, "", fmt.Errorf("%s not found on PATH. Install it (e.g. 'brew install traceroute' on macOS) or omit --trace.", cmdName)
 	}
 
 	// Traceroute can take a while; use a more forgiving timeout.
@@ -367,24 +778,15 @@ func TraceRoute(domain string, timeout time.Duration) {
 	out, err := cmd.CombinedOutput()
 	if err != nil {
 		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
-			fmt.Printf("Traceroute timed out after %s\n", effectiveTimeout)
-			return
+			return nil, "", fmt.Errorf("Traceroute timed out after %s", effectiveTimeout)
 		}
-		fmt.Printf("Traceroute failed: %v\n", err)
-		return
+		return nil, "", fmt.Errorf("Traceroute failed: %v", err)
 	}
 	text := strings.TrimSpace(string(out))
 	if text == "" {
-		fmt.Println("No traceroute output")
-		return
-	}
-
-	rows := parseTraceOutput(text, isWindows)
-	if len(rows) == 0 {
-		fmt.Println(text)
-		return
+		return nil, "", nil
 	}
-	RenderTable([]string{"Hop", "IP", "Hostname", "Time"}, rows)
+	return parseTraceOutput(text, isWindows), text, nil
 }
 
 func parseTraceOutput(text string, isWindows bool) [][]string {
@@ -492,37 +894,7 @@ func stripDelims(s string) string {
 }
 
 func isIPLike(s string) bool {
-	if s == "" {
-		return false
-	}
-	// IPv4
-	if strings.Count(s, ".") == 3 {
-		parts := strings.Split(s, ".")
-		if len(parts) == 4 {
-			ok := true
-			for _, p := range parts {
-				if p == "" {
-					ok = false
-					break
-				}
-				for _, r := range p {
-					if r < '0' || r > '9' {
-						ok = false
-						break
-					}
-				}
-				if !ok {
-					break
-				}
-			}
-			return ok
-		}
-	}
-	// IPv6 (best-effort)
-	if strings.Contains(s, ":") {
-		return true
-	}
-	return false
+	return net.ParseIP(s) != nil
 }
 
 func truncateForDisplay(s string, max int) string {
@@ -544,59 +916,3 @@ func normalizeWhitespace(s string) string {
 	// Normalize whitespace so wrapping is predictable.
 	return strings.Join(strings.Fields(s), " ")
 }
-
-func CheckWhois(domain string, timeout time.Duration) {
-	fmt.Println("")
-	PrintSectionHeader("WHOIS")
-
-	if _, err := exec.LookPath("whois"); err != nil {
-		fmt.Println("whois not found on PATH. Install it (e.g. 'brew install whois' on macOS, 'apt install whois' on Linux) or omit --whois.")
-		return
-	}
-
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	// Use system whois to avoid pulling in a heavy dependency and to keep portability.
-	cmd := exec.CommandContext(ctx, "whois", domain)
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		fmt.Printf("WHOIS failed: %v\n", err)
-		return
-	}
-	text := string(out)
-	// Print a curated subset of lines (best-effort across registries)
-	wantPrefixes := []string{
-		"Domain Name:",
-		"Registrar:",
-		"Registry Expiry Date:",
-		"Expiration Date:",
-		"Creation Date:",
-		"Updated Date:",
-		"Name Server:",
-		"DNSSEC:",
-		"Registrar WHOIS Server:",
-	}
-
-	rows := [][]string{}
-	for _, line := range strings.Split(text, "\n") {
-		l := strings.TrimSpace(line)
-		for _, p := range wantPrefixes {
-			if strings.HasPrefix(l, p) {
-				val := strings.TrimSpace(strings.TrimPrefix(l, p))
-				rows = append(rows, []string{strings.TrimSuffix(p, ":"), val})
-				break
-			}
-		}
-		if len(rows) >= 25 {
-			break
-		}
-	}
-
-	if len(rows) == 0 {
-		fmt.Println("WHOIS output (raw):")
-		fmt.Println(text)
-		return
-	}
-	RenderTable([]string{"Field", "Value"}, rows)
-}
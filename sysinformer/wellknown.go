@@ -0,0 +1,548 @@
+package sysinformer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	WELLKNOWN_MAX_BODY      = 10 << 20 // bytes read from any one file
+	SITEMAP_MAX_URLS        = 50000    // per sitemap file, from the sitemaps.org protocol
+	SITEMAP_MAX_CHILDREN    = 10       // sitemaps fetched from a sitemap index
+	SECURITY_TXT_MAX_EXPIRY = 366 * 24 * time.Hour
+)
+
+type wellKnownChecker struct {
+	client   *http.Client // follows redirects
+	noFollow *http.Client // reports redirects
+	reqOpts  HTTPRequestOptions
+	base     *url.URL // scheme://host[:port] of the target
+	now      time.Time
+
+	endpoints [][]string
+	findings  []verdictFinding
+}
+
+func (c *wellKnownChecker) add(check, verdict, format string, args ...interface{}) {
+	c.findings = append(c.findings, verdictFinding{Check: check, Verdict: verdict, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (c *wellKnownChecker) endpoint(path, status, summary string) {
+	c.endpoints = append(c.endpoints, []string{path, status, summary})
+}
+
+// wellKnownResponse is a fetched file. Status is 0 when the request failed.
+type wellKnownResponse struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	FinalURL *url.URL
+	Err      error
+}
+
+func (r wellKnownResponse) statusText() string {
+	if r.Err != nil {
+		return colorCell("\033[91m", "failed")
+	}
+	return strconv.Itoa(r.Status)
+}
+
+// mediaType returns the response's media type without parameters, lower case.
+func (r wellKnownResponse) mediaType() string {
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return strings.ToLower(mt)
+}
+
+// found reports whether the file exists. Many sites answer any path with their HTML
+// error or home page, so an HTML response to a text or XML file counts as missing.
+func (r wellKnownResponse) found() bool {
+	return r.Err == nil && r.Status == http.StatusOK && r.mediaType() != "text/html"
+}
+
+// get fetches target. The request options (headers, credentials) only go to the target's
+// own host, not to sitemaps or policies hosted elsewhere.
+func (c *wellKnownChecker) get(client *http.Client, target string) wellKnownResponse {
+	req, err := c.reqOpts.newRequestFor(c.base.Hostname(), http.MethodGet, target, nil)
+	if err != nil {
+		return wellKnownResponse{Err: err}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return wellKnownResponse{Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, WELLKNOWN_MAX_BODY))
+	return wellKnownResponse{Status: resp.StatusCode, Header: resp.Header, Body: body, FinalURL: resp.Request.URL, Err: err}
+}
+
+// missing records an endpoint that was not found, explaining what came back instead.
+func (c *wellKnownChecker) missing(path string, r wellKnownResponse) string {
+	switch {
+	case r.Err != nil:
+		c.endpoint(path, r.statusText(), "fetch failed")
+		return fmt.Sprintf("could not fetch %s: %v", path, r.Err)
+	case r.Status == http.StatusOK:
+		c.endpoint(path, r.statusText(), "missing (HTML page served instead)")
+		return fmt.Sprintf("%s is answered with an HTML page, so it does not exist", path)
+	}
+	c.endpoint(path, r.statusText(), "missing")
+	return fmt.Sprintf("%s not found (%d)", path, r.Status)
+}
+
+// robotsGroup is one User-agent group of robots.txt.
+type robotsGroup struct {
+	Agents   []string
+	Allow    int
+	Disallow int
+	BlockAll bool // "Disallow: /"
+}
+
+// checkRobots fetches and parses /robots.txt and returns the sitemaps it references.
+func (c *wellKnownChecker) checkRobots() []string {
+	const path = "/robots.txt"
+	r := c.get(c.client, c.base.String()+path)
+	if !r.found() {
+		c.add("robots.txt", VerdictInfo, "%s; crawlers may fetch everything", c.missing(path, r))
+		return nil
+	}
+	if mt := r.mediaType(); mt != "text/plain" {
+		c.add("robots.txt", VerdictWarn, "served as %q instead of text/plain", orDash(mt))
+	}
+
+	var groups []*robotsGroup
+	var sitemaps []string
+	var cur *robotsGroup
+	inAgents := false // consecutive User-agent lines share one group
+	for i, line := range strings.Split(string(r.Body), "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		key, value = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if !ok {
+			c.add("robots.txt", VerdictWarn, "line %d is not a \"field: value\" line: %s", i+1, truncateForDisplay(line, 60))
+			continue
+		}
+		switch key {
+		case "user-agent":
+			if !inAgents {
+				cur = &robotsGroup{}
+				groups = append(groups, cur)
+			}
+			cur.Agents = append(cur.Agents, value)
+			inAgents = true
+			continue
+		case "allow", "disallow":
+			if cur == nil {
+				c.add("robots.txt", VerdictWarn, "line %d: %s rule before any User-agent line is ignored", i+1, key)
+				break
+			}
+			if key == "allow" {
+				cur.Allow++
+			} else if value != "" {
+				cur.Disallow++
+				cur.BlockAll = cur.BlockAll || value == "/"
+			}
+		case "sitemap":
+			u, err := url.Parse(value)
+			if err != nil || !u.IsAbs() {
+				c.add("robots.txt", VerdictWarn, "line %d: sitemap must be an absolute URL: %s", i+1, truncateForDisplay(value, 60))
+				break
+			}
+			sitemaps = append(sitemaps, value)
+		case "crawl-delay", "host", "clean-param", "noindex":
+			// Non-standard but widely understood.
+		default:
+			c.add("robots.txt", VerdictWarn, "line %d: unknown field %q", i+1, key)
+		}
+		inAgents = false
+	}
+
+	rules := 0
+	for _, g := range groups {
+		rules += g.Allow + g.Disallow
+		for _, a := range g.Agents {
+			if a == "*" && g.BlockAll {
+				c.add("robots.txt", VerdictWarn, "\"Disallow: /\" for every crawler blocks the whole site from search engines")
+			}
+		}
+	}
+	c.endpoint(path, r.statusText(), fmt.Sprintf("%d user-agent groups, %d rules, %d sitemaps", len(groups), rules, len(sitemaps)))
+	if len(groups) == 0 {
+		c.add("robots.txt", VerdictInfo, "no User-agent groups; nothing is disallowed")
+	} else {
+		c.add("robots.txt", VerdictPass, "%d user-agent groups with %d rules", len(groups), rules)
+	}
+	return sitemaps
+}
+
+// sitemapFile is a urlset or a sitemapindex, told apart by XMLName.
+type sitemapFile struct {
+	XMLName xml.Name
+	URLs    []sitemapEntry `xml:"url"`
+	Maps    []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// validLastMod accepts the W3C datetime forms the sitemap protocol allows.
+func validLastMod(v string) bool {
+	for _, layout := range []string{"2006-01-02", "2006-01", "2006", time.RFC3339, "2006-01-02T15:04Z07:00"} {
+		if _, err := time.Parse(layout, v); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// invalidEntries counts entries whose loc is not an absolute http(s) URL on the sitemap's
+// own host, or whose lastmod is not a W3C datetime, describing the first one.
+func invalidEntries(entries []sitemapEntry, host string) (int, string) {
+	n, first := 0, ""
+	for _, e := range entries {
+		reason := ""
+		loc := strings.TrimSpace(e.Loc)
+		u, err := url.Parse(loc)
+		switch {
+		case loc == "":
+			reason = "entry without <loc>"
+		case err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https"):
+			reason = "not an absolute http(s) URL: " + loc
+		case !strings.EqualFold(u.Hostname(), host):
+			reason = "URL on another host: " + loc
+		case e.LastMod != "" && !validLastMod(strings.TrimSpace(e.LastMod)):
+			reason = "invalid lastmod " + strconv.Quote(e.LastMod) + " for " + loc
+		}
+		if reason != "" {
+			n++
+			if first == "" {
+				first = reason
+			}
+		}
+	}
+	return n, first
+}
+
+// parseSitemap fetches and decodes one sitemap, which may be gzipped.
+func (c *wellKnownChecker) parseSitemap(target string) (wellKnownResponse, *sitemapFile, error) {
+	r := c.get(c.client, target)
+	if !r.found() {
+		return r, nil, nil
+	}
+	body := r.Body
+	if bytes.HasPrefix(body, []byte{0x1f, 0x8b}) {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return r, nil, err
+		}
+		body, err = io.ReadAll(io.LimitReader(zr, WELLKNOWN_MAX_BODY))
+		if err != nil {
+			return r, nil, err
+		}
+	}
+	var f sitemapFile
+	if err := xml.Unmarshal(body, &f); err != nil {
+		return r, nil, err
+	}
+	if f.XMLName.Local != "urlset" && f.XMLName.Local != "sitemapindex" {
+		return r, nil, fmt.Errorf("root element is <%s>, not <urlset> or <sitemapindex>", f.XMLName.Local)
+	}
+	return r, &f, nil
+}
+
+// checkSitemaps validates the sitemaps referenced from robots.txt, or /sitemap.xml when
+// there are none, following sitemap indexes one level down.
+func (c *wellKnownChecker) checkSitemaps(refs []string) {
+	if len(refs) == 0 {
+		refs = []string{c.base.String() + "/sitemap.xml"}
+	}
+	for _, ref := range refs {
+		label := ref
+		if u, err := url.Parse(ref); err == nil && u.Host == c.base.Host {
+			label = u.RequestURI()
+		}
+		r, f, err := c.parseSitemap(ref)
+		switch {
+		case err != nil:
+			c.endpoint(label, r.statusText(), "malformed")
+			c.add("sitemap", VerdictFail, "%s: %v", label, err)
+			continue
+		case f == nil:
+			c.add("sitemap", VerdictInfo, "%s", c.missing(label, r))
+			continue
+		}
+		host := r.FinalURL.Hostname()
+
+		if f.XMLName.Local == "urlset" {
+			c.checkURLSet(label, r.statusText(), f, host)
+			continue
+		}
+		bad, first := invalidEntries(f.Maps, host)
+		if bad > 0 {
+			c.add("sitemap", VerdictWarn, "%s: %d invalid sitemap entries, e.g. %s", label, bad, truncateForDisplay(first, 80))
+		}
+		urls, children, broken := 0, 0, 0
+		for i, m := range f.Maps {
+			if i >= SITEMAP_MAX_CHILDREN {
+				break
+			}
+			children++
+			_, child, err := c.parseSitemap(strings.TrimSpace(m.Loc))
+			if err != nil || child == nil || child.XMLName.Local != "urlset" {
+				broken++
+				continue
+			}
+			urls += len(child.URLs)
+			if n, first := invalidEntries(child.URLs, host); n > 0 {
+				c.add("sitemap", VerdictWarn, "%s: %d invalid entries, e.g. %s", strings.TrimSpace(m.Loc), n, truncateForDisplay(first, 80))
+			}
+		}
+		summary := fmt.Sprintf("index of %d sitemaps; %d URLs in the first %d", len(f.Maps), urls, children)
+		c.endpoint(label, r.statusText(), summary)
+		if broken > 0 {
+			c.add("sitemap", VerdictFail, "%s: %d of %d listed sitemaps are missing or malformed", label, broken, children)
+		} else {
+			c.add("sitemap", VerdictPass, "%s: %s", label, summary)
+		}
+	}
+}
+
+func (c *wellKnownChecker) checkURLSet(label, status string, f *sitemapFile, host string) {
+	c.endpoint(label, status, fmt.Sprintf("%d URLs", len(f.URLs)))
+	bad, first := invalidEntries(f.URLs, host)
+	switch {
+	case len(f.URLs) == 0:
+		c.add("sitemap", VerdictWarn, "%s lists no URLs", label)
+	case len(f.URLs) > SITEMAP_MAX_URLS:
+		c.add("sitemap", VerdictFail, "%s lists %d URLs; the limit is %d per file", label, len(f.URLs), SITEMAP_MAX_URLS)
+	case bad > 0:
+		c.add("sitemap", VerdictWarn, "%s: %d of %d entries invalid, e.g. %s", label, bad, len(f.URLs), truncateForDisplay(first, 80))
+	default:
+		c.add("sitemap", VerdictPass, "%s: %d URLs", label, len(f.URLs))
+	}
+}
+
+// checkSecurityTxt validates /.well-known/security.txt against RFC 9116.
+func (c *wellKnownChecker) checkSecurityTxt() {
+	const path = "/.well-known/security.txt"
+	r := c.get(c.client, c.base.String()+path)
+	if !r.found() {
+		reason := c.missing(path, r)
+		if legacy := c.get(c.client, c.base.String()+"/security.txt"); legacy.found() {
+			c.add("security.txt", VerdictWarn, "%s; only the legacy /security.txt location exists", reason)
+			r = legacy
+		} else {
+			c.add("security.txt", VerdictWarn, "%s; there is no published way to report vulnerabilities", reason)
+			return
+		}
+	}
+	if r.FinalURL.Scheme != "https" {
+		c.add("security.txt", VerdictFail, "served over %s; RFC 9116 requires https", r.FinalURL.Scheme)
+	}
+	if mt := r.mediaType(); mt != "text/plain" {
+		c.add("security.txt", VerdictWarn, "served as %q instead of text/plain", orDash(mt))
+	}
+
+	text := string(r.Body)
+	signed := strings.Contains(text, "-----BEGIN PGP SIGNED MESSAGE-----")
+	if signed {
+		// Only the signed part counts; the signature block follows it.
+		text, _, _ = strings.Cut(text, "-----BEGIN PGP SIGNATURE-----")
+	}
+	fields := map[string][]string{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "-----") || strings.HasPrefix(line, "Hash:") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		fields[key] = append(fields[key], strings.TrimSpace(value))
+	}
+
+	summary := []string{}
+	contacts := fields["contact"]
+	if len(contacts) == 0 {
+		c.add("security.txt", VerdictFail, "no Contact field; at least one is required")
+	} else {
+		summary = append(summary, fmt.Sprintf("%d contacts", len(contacts)))
+		c.add("security.txt", VerdictPass, "contact: %s", truncateForDisplay(strings.Join(contacts, ", "), 100))
+		for _, contact := range contacts {
+			if u, err := url.Parse(contact); err != nil || (u.Scheme != "mailto" && u.Scheme != "tel" && u.Scheme != "https") {
+				c.add("security.txt", VerdictWarn, "Contact should be a mailto:, tel: or https: URI: %s", contact)
+			}
+		}
+	}
+
+	expires := fields["expires"]
+	switch {
+	case len(expires) == 0:
+		c.add("security.txt", VerdictFail, "no Expires field; it is required")
+	case len(expires) > 1:
+		c.add("security.txt", VerdictFail, "Expires appears %d times; it must appear once", len(expires))
+	default:
+		t, err := time.Parse(time.RFC3339, expires[0])
+		switch {
+		case err != nil:
+			c.add("security.txt", VerdictFail, "Expires is not an RFC 3339 date: %s", expires[0])
+		case t.Before(c.now):
+			summary = append(summary, "expired")
+			c.add("security.txt", VerdictFail, "expired on %s", t.Format("2006-01-02"))
+		case t.Sub(c.now) > SECURITY_TXT_MAX_EXPIRY:
+			summary = append(summary, "expires "+t.Format("2006-01-02"))
+			c.add("security.txt", VerdictWarn, "expires %s, more than a year ahead; RFC 9116 recommends less", t.Format("2006-01-02"))
+		default:
+			summary = append(summary, "expires "+t.Format("2006-01-02"))
+			c.add("security.txt", VerdictPass, "expires %s (%d days)", t.Format("2006-01-02"), daysUntil(t, c.now))
+		}
+	}
+	for _, key := range []string{"canonical", "policy", "encryption"} {
+		if len(fields[key]) > 0 {
+			summary = append(summary, key)
+		}
+	}
+	if signed {
+		summary = append(summary, "PGP signed")
+	}
+	c.endpoint(r.FinalURL.Path, r.statusText(), strings.Join(summary, ", "))
+}
+
+// checkChangePassword checks /.well-known/change-password, which should redirect to the
+// site's change-password page.
+func (c *wellKnownChecker) checkChangePassword() {
+	const path = "/.well-known/change-password"
+	r := c.get(c.noFollow, c.base.String()+path)
+	switch {
+	case r.Err == nil && r.Status >= 300 && r.Status < 400 && r.Header.Get("Location") != "":
+		loc := r.Header.Get("Location")
+		c.endpoint(path, r.statusText(), "redirects to "+truncateForDisplay(loc, 60))
+		target, err := r.FinalURL.Parse(loc)
+		if err != nil {
+			c.add("change-password", VerdictWarn, "invalid redirect target %s", loc)
+			break
+		}
+		if t := c.get(c.client, target.String()); t.Err != nil || t.Status >= 400 {
+			c.add("change-password", VerdictFail, "redirects to %s, which returns %s", target, t.statusText())
+		} else {
+			c.add("change-password", VerdictPass, "redirects to %s", target)
+		}
+	case r.Err == nil && r.Status == http.StatusOK:
+		c.endpoint(path, r.statusText(), "served directly")
+		c.add("change-password", VerdictInfo, "answered with 200; a redirect to the change-password page is expected, unless this is a catch-all page")
+	default:
+		c.add("change-password", VerdictInfo, "%s; password managers cannot link to the change-password page", c.missing(path, r))
+	}
+}
+
+// checkOpenIDConfiguration validates an OpenID Connect discovery document.
+func (c *wellKnownChecker) checkOpenIDConfiguration() {
+	const path = "/.well-known/openid-configuration"
+	r := c.get(c.client, c.base.String()+path)
+	if !r.found() {
+		c.add("openid-configuration", VerdictInfo, "%s; the site is not an OpenID provider", c.missing(path, r))
+		return
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(r.Body, &doc); err != nil {
+		c.endpoint(path, r.statusText(), "malformed")
+		c.add("openid-configuration", VerdictFail, "not valid JSON: %v", err)
+		return
+	}
+	issuer, _ := doc["issuer"].(string)
+	c.endpoint(path, r.statusText(), "issuer "+orDash(truncateForDisplay(issuer, 60)))
+
+	var missing []string
+	for _, key := range []string{"issuer", "authorization_endpoint", "jwks_uri", "response_types_supported", "subject_types_supported", "id_token_signing_alg_values_supported"} {
+		if _, ok := doc[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		c.add("openid-configuration", VerdictFail, "missing required fields: %s", strings.Join(missing, ", "))
+	}
+	// The issuer must be the URL the document was fetched under, minus the well-known path.
+	// That is the final URL: an http target usually redirects to https.
+	fetched := *r.FinalURL
+	fetched.Path = strings.TrimSuffix(fetched.Path, path)
+	fetched.RawPath, fetched.RawQuery, fetched.Fragment = "", "", ""
+	if want := strings.TrimSuffix(fetched.String(), "/"); issuer != "" && strings.TrimSuffix(issuer, "/") != want {
+		c.add("openid-configuration", VerdictWarn, "issuer %s does not match %s", issuer, want)
+	}
+	if len(missing) == 0 {
+		c.add("openid-configuration", VerdictPass, "discovery document with issuer %s", issuer)
+	}
+}
+
+// checkJSONFile reports whether a well-known JSON file (app links and the like) is present
+// and parses.
+func (c *wellKnownChecker) checkJSONFile(check, path string) {
+	r := c.get(c.client, c.base.String()+path)
+	if !r.found() {
+		c.missing(path, r)
+		return
+	}
+	var doc interface{}
+	if err := json.Unmarshal(r.Body, &doc); err != nil {
+		c.endpoint(path, r.statusText(), "malformed")
+		c.add(check, VerdictFail, "not valid JSON: %v", err)
+		return
+	}
+	c.endpoint(path, r.statusText(), "present, valid JSON")
+	c.add(check, VerdictPass, "present and valid JSON")
+}
+
+// CheckWellKnown fetches and validates robots.txt, the sitemaps, security.txt and the
+// change-password, OpenID discovery and app-link well-known endpoints of the target's
+// origin, reporting what is present, missing or malformed.
+func CheckWellKnown(targetURL string, timeout time.Duration, reqOpts HTTPRequestOptions) {
+	fmt.Println("")
+	PrintSectionHeader("WELL-KNOWN")
+
+	u, err := url.Parse(targetURL)
+	if err != nil {
+		fmt.Printf("Invalid URL: %v\n", err)
+		return
+	}
+	client, err := reqOpts.client(timeout, true)
+	if err != nil {
+		fmt.Printf("Could not set up requests: %v\n", err)
+		return
+	}
+	noFollow, _ := reqOpts.client(timeout, true)
+	noFollow.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+
+	c := &wellKnownChecker{
+		client:   client,
+		noFollow: noFollow,
+		reqOpts:  reqOpts,
+		base:     &url.URL{Scheme: u.Scheme, Host: u.Host},
+		now:      time.Now(),
+	}
+	c.checkSitemaps(c.checkRobots())
+	c.checkSecurityTxt()
+	c.checkChangePassword()
+	c.checkOpenIDConfiguration()
+	c.checkJSONFile("assetlinks.json", "/.well-known/assetlinks.json")
+	c.checkJSONFile("apple-app-site-association", "/.well-known/apple-app-site-association")
+
+	RenderTable([]string{"Endpoint", "HTTP", "Found"}, c.endpoints)
+	renderVerdictFindings(c.findings)
+}
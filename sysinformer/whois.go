@@ -0,0 +1,669 @@
+package sysinformer
+
+import (
+	"bufio"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+const (
+	DOMAIN_WARN_DAYS = 60
+	DOMAIN_CRIT_DAYS = 14
+)
+
+const (
+	WHOIS_PORT        = "43"
+	whoisRootServer   = "whois.iana.org"
+	whoisMaxReferrals = 3
+	maxWhoisBody      = 1 << 20
+)
+
+// rdapBootstrapJSON is the IANA RDAP bootstrap file for domain names, refreshed by
+// gen_rdap_bootstrap.go.
+//
+//go:generate go run gen_rdap_bootstrap.go
+//go:embed rdap_bootstrap.json
+var rdapBootstrapJSON []byte
+
+const (
+	rdapBootstrapURL    = "https://data.iana.org/rdap/dns.json"
+	rdapBootstrapMaxAge = 7 * 24 * time.Hour
+)
+
+// WhoisOptions selects where registration data is looked up.
+type WhoisOptions struct {
+	Bootstrap string // RDAP bootstrap file (IANA dns.json format) instead of the embedded one
+	Server    string // WHOIS server to start from instead of whois.iana.org
+}
+
+// WhoisInfo is registration data normalized from RDAP or WHOIS.
+type WhoisInfo struct {
+	Domain      string
+	Source      string
+	Registrar   string
+	Registrant  string
+	Created     time.Time
+	Updated     time.Time
+	Expires     time.Time
+	Status      []string
+	Nameservers []string
+	DNSSEC      string
+	Raw         string // WHOIS text when nothing could be normalized
+}
+
+func (w *WhoisInfo) empty() bool {
+	return w.Registrar == "" && w.Expires.IsZero() && w.Created.IsZero() && len(w.Nameservers) == 0
+}
+
+// rdapBootstrap maps TLDs to RDAP base URLs (RFC 9224).
+type rdapBootstrap struct {
+	Services [][][]string `json:"services"`
+}
+
+func loadRDAPBootstrap(path string) (map[string]string, error) {
+	data := rdapBootstrapJSON
+	if path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return parseRDAPBootstrap(data)
+}
+
+// fetchRDAPBootstrap returns the live IANA bootstrap file, kept in the user cache directory
+// for rdapBootstrapMaxAge. It covers TLDs the embedded copy does not list.
+func fetchRDAPBootstrap(ctx context.Context, client *http.Client) (map[string]string, error) {
+	var cache string
+	if dir, err := os.UserCacheDir(); err == nil {
+		cache = filepath.Join(dir, "sysinformer", "rdap-dns.json")
+		if fi, err := os.Stat(cache); err == nil && time.Since(fi.ModTime()) < rdapBootstrapMaxAge {
+			if data, err := os.ReadFile(cache); err == nil {
+				if services, err := parseRDAPBootstrap(data); err == nil && len(services) > 0 {
+					return services, nil
+				}
+			}
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rdapBootstrapURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", rdapBootstrapURL, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+	services, err := parseRDAPBootstrap(data)
+	if err != nil {
+		return nil, err
+	}
+	if cache != "" && os.MkdirAll(filepath.Dir(cache), 0o755) == nil {
+		_ = os.WriteFile(cache, data, 0o644)
+	}
+	return services, nil
+}
+
+func parseRDAPBootstrap(data []byte) (map[string]string, error) {
+	var b rdapBootstrap
+	if err := json.Unmarshal(data, &b); err != nil {
+		return nil, fmt.Errorf("parsing RDAP bootstrap: %w", err)
+	}
+	out := map[string]string{}
+	for _, svc := range b.Services {
+		if len(svc) < 2 || len(svc[1]) == 0 {
+			continue
+		}
+		// Prefer an https base URL when several are listed.
+		base := svc[1][0]
+		for _, u := range svc[1] {
+			if strings.HasPrefix(u, "https://") {
+				base = u
+				break
+			}
+		}
+		for _, tld := range svc[0] {
+			out[strings.ToLower(tld)] = base
+		}
+	}
+	return out, nil
+}
+
+// rdapBaseFor returns the RDAP service for the longest matching label suffix of domain.
+func rdapBaseFor(services map[string]string, domain string) string {
+	labels := strings.Split(domain, ".")
+	for i := range labels {
+		if base, ok := services[strings.Join(labels[i:], ".")]; ok {
+			return base
+		}
+	}
+	return ""
+}
+
+type rdapEvent struct {
+	Action string `json:"eventAction"`
+	Date   string `json:"eventDate"`
+}
+
+type rdapEntity struct {
+	Roles      []string        `json:"roles"`
+	VCardArray json.RawMessage `json:"vcardArray"`
+	Entities   []rdapEntity    `json:"entities"`
+}
+
+type rdapLink struct {
+	Rel  string `json:"rel"`
+	Href string `json:"href"`
+	Type string `json:"type"`
+}
+
+type rdapDomain struct {
+	LDHName     string       `json:"ldhName"`
+	Status      []string     `json:"status"`
+	Events      []rdapEvent  `json:"events"`
+	Entities    []rdapEntity `json:"entities"`
+	Nameservers []struct {
+		LDHName string `json:"ldhName"`
+	} `json:"nameservers"`
+	SecureDNS *struct {
+		DelegationSigned bool `json:"delegationSigned"`
+	} `json:"secureDNS"`
+	Links []rdapLink `json:"links"`
+}
+
+// vcardField returns the text value of a jCard property (RFC 7095), e.g. "fn" or "org".
+func vcardField(raw json.RawMessage, name string) string {
+	var card []interface{}
+	if json.Unmarshal(raw, &card) != nil || len(card) < 2 {
+		return ""
+	}
+	props, _ := card[1].([]interface{})
+	for _, p := range props {
+		prop, _ := p.([]interface{})
+		if len(prop) < 4 || prop[0] != name {
+			continue
+		}
+		switch v := prop[3].(type) {
+		case string:
+			return v
+		case []interface{}:
+			if len(v) > 0 {
+				s, _ := v[0].(string)
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func (e rdapEntity) hasRole(role string) bool {
+	for _, r := range e.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// findEntity searches entities, including nested ones, for the first with role.
+func findEntity(entities []rdapEntity, role string) *rdapEntity {
+	for i := range entities {
+		if entities[i].hasRole(role) {
+			return &entities[i]
+		}
+		if e := findEntity(entities[i].Entities, role); e != nil {
+			return e
+		}
+	}
+	return nil
+}
+
+func entityName(e *rdapEntity) string {
+	if e == nil {
+		return ""
+	}
+	if org := vcardField(e.VCardArray, "org"); org != "" {
+		return org
+	}
+	return vcardField(e.VCardArray, "fn")
+}
+
+func fetchRDAP(ctx context.Context, client *http.Client, url string) (*rdapDomain, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/rdap+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errors.New("domain not found")
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("RDAP server returned %s", resp.Status)
+	}
+	var d rdapDomain
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxWhoisBody)).Decode(&d); err != nil {
+		return nil, fmt.Errorf("decoding RDAP response: %w", err)
+	}
+	return &d, nil
+}
+
+// lookupRDAP queries the registry's RDAP service and, when it links to the registrar's
+// RDAP service, fills registrant and registrar details from there.
+func lookupRDAP(ctx context.Context, client *http.Client, base, domain string) (*WhoisInfo, error) {
+	url := strings.TrimSuffix(base, "/") + "/domain/" + domain
+	d, err := fetchRDAP(ctx, client, url)
+	if err != nil {
+		return nil, err
+	}
+	info := &WhoisInfo{Domain: strings.ToLower(d.LDHName), Source: "RDAP " + url, Status: d.Status}
+	if info.Domain == "" {
+		info.Domain = domain
+	}
+	applyRDAP(info, d)
+
+	for _, l := range d.Links {
+		if l.Rel != "related" || l.Type != "application/rdap+json" || l.Href == url {
+			continue
+		}
+		if rd, err := fetchRDAP(ctx, client, l.Href); err == nil {
+			applyRDAP(info, rd)
+			info.Source += "\nRDAP " + l.Href
+		}
+		break
+	}
+	return info, nil
+}
+
+// applyRDAP fills fields of info that are still empty from d.
+func applyRDAP(info *WhoisInfo, d *rdapDomain) {
+	for _, ev := range d.Events {
+		t, err := time.Parse(time.RFC3339, ev.Date)
+		if err != nil {
+			continue
+		}
+		switch ev.Action {
+		case "registration":
+			setTime(&info.Created, t)
+		case "expiration":
+			setTime(&info.Expires, t)
+		case "last changed":
+			setTime(&info.Updated, t)
+		}
+	}
+	if info.Registrar == "" {
+		info.Registrar = entityName(findEntity(d.Entities, "registrar"))
+	}
+	if info.Registrant == "" {
+		info.Registrant = entityName(findEntity(d.Entities, "registrant"))
+	}
+	if len(info.Nameservers) == 0 {
+		for _, ns := range d.Nameservers {
+			info.Nameservers = append(info.Nameservers, strings.ToLower(strings.TrimSuffix(ns.LDHName, ".")))
+		}
+	}
+	if info.DNSSEC == "" && d.SecureDNS != nil {
+		info.DNSSEC = "unsigned"
+		if d.SecureDNS.DelegationSigned {
+			info.DNSSEC = "signed"
+		}
+	}
+}
+
+func setTime(dst *time.Time, t time.Time) {
+	if dst.IsZero() {
+		*dst = t
+	}
+}
+
+// queryWhois sends query to a WHOIS server (RFC 3912) and returns the response text.
+func queryWhois(ctx context.Context, server, query string) (string, error) {
+	addr := server
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		addr = net.JoinHostPort(server, WHOIS_PORT)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := io.WriteString(conn, query+"\r\n"); err != nil {
+		return "", err
+	}
+	body, err := io.ReadAll(io.LimitReader(conn, maxWhoisBody))
+	return string(body), err
+}
+
+// whoisFields maps normalized field names to the labels registries use for them.
+var whoisFields = map[string][]string{
+	"registrar":  {"registrar", "sponsoring registrar", "registrar name"},
+	"registrant": {"registrant organization", "registrant organisation", "registrant", "org", "registrant name"},
+	"created":    {"creation date", "created", "created on", "registered on", "registration time", "domain registration date", "registered"},
+	"updated":    {"updated date", "last updated", "last modified", "changed", "last-update", "updated"},
+	"expires": {
+		"registry expiry date", "registrar registration expiration date", "expiration date", "expiry date",
+		"expires on", "expires", "paid-till", "expiration time", "renewal date",
+	},
+	"status":     {"domain status", "status", "state"},
+	"nameserver": {"name server", "nserver", "nameservers", "name servers"},
+	"dnssec":     {"dnssec"},
+	"referral":   {"refer", "whois", "registrar whois server", "referralserver"},
+}
+
+var whoisDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02",
+	"02-Jan-2006",
+	"2006.01.02",
+	"2006/01/02",
+	"02.01.2006",
+}
+
+func parseWhoisDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if f := strings.Fields(s); len(f) > 0 && len(f[0]) >= 10 {
+		// Drop trailing annotations such as "2026-05-01 (YYYY-MM-DD)".
+		for _, layout := range whoisDateLayouts {
+			if t, err := time.Parse(layout, f[0]); err == nil {
+				return t
+			}
+		}
+	}
+	for _, layout := range whoisDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// parseWhois normalizes "Key: value" WHOIS text and returns the referral server, if any.
+func parseWhois(text string) (*WhoisInfo, string) {
+	labels := map[string]string{}
+	for field, names := range whoisFields {
+		for _, n := range names {
+			labels[n] = field
+		}
+	}
+	info := &WhoisInfo{}
+	referral := ""
+	seenNS := map[string]bool{}
+	sc := bufio.NewScanner(strings.NewReader(text))
+	for sc.Scan() {
+		k, v, ok := strings.Cut(strings.TrimSpace(sc.Text()), ":")
+		v = strings.TrimSpace(v)
+		if !ok || v == "" || strings.HasPrefix(k, "%") || strings.HasPrefix(k, "#") {
+			continue
+		}
+		switch labels[strings.ToLower(strings.TrimSpace(k))] {
+		case "registrar":
+			if info.Registrar == "" {
+				info.Registrar = v
+			}
+		case "registrant":
+			if info.Registrant == "" {
+				info.Registrant = v
+			}
+		case "created":
+			setTime(&info.Created, parseWhoisDate(v))
+		case "updated":
+			setTime(&info.Updated, parseWhoisDate(v))
+		case "expires":
+			setTime(&info.Expires, parseWhoisDate(v))
+		case "status":
+			// "clientTransferProhibited https://icann.org/epp#clientTransferProhibited"
+			status := strings.Fields(v)[0]
+			if !containsFold(info.Status, status) {
+				info.Status = append(info.Status, status)
+			}
+		case "nameserver":
+			ns := strings.ToLower(strings.TrimSuffix(strings.Fields(v)[0], "."))
+			if !seenNS[ns] {
+				seenNS[ns] = true
+				info.Nameservers = append(info.Nameservers, ns)
+			}
+		case "dnssec":
+			if info.DNSSEC == "" {
+				info.DNSSEC = v
+			}
+		case "referral":
+			if referral == "" {
+				referral = strings.TrimPrefix(strings.TrimPrefix(v, "whois://"), "rwhois://")
+				referral = strings.TrimSuffix(referral, "/")
+			}
+		}
+	}
+	return info, referral
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupWhois queries server (whois.iana.org by default) and follows referrals to the
+// registry and then the registrar, merging what each reports.
+func lookupWhois(ctx context.Context, server, domain string) (*WhoisInfo, error) {
+	if server == "" {
+		server = whoisRootServer
+	}
+	var merged *WhoisInfo
+	var sources []string
+	visited := map[string]bool{}
+	for hop := 0; hop <= whoisMaxReferrals && server != "" && !visited[strings.ToLower(server)]; hop++ {
+		visited[strings.ToLower(server)] = true
+		text, err := queryWhois(ctx, server, domain)
+		if err != nil {
+			if merged != nil {
+				// The registry answered; a failing registrar server is not fatal.
+				break
+			}
+			return nil, fmt.Errorf("%s: %w", server, err)
+		}
+		info, referral := parseWhois(text)
+		if strings.EqualFold(server, whoisRootServer) && referral != "" {
+			// IANA describes the TLD itself; only its referral to the registry matters.
+			server = referral
+			continue
+		}
+		sources = append(sources, "WHOIS "+server)
+		if merged == nil {
+			merged = info
+			merged.Raw = text
+		} else {
+			mergeWhois(merged, info)
+			if !info.empty() {
+				merged.Raw = text
+			}
+		}
+		server = referral
+	}
+	if merged == nil {
+		return nil, fmt.Errorf("no WHOIS server found for %s", domain)
+	}
+	merged.Domain = domain
+	merged.Source = strings.Join(sources, "\n")
+	if !merged.empty() {
+		merged.Raw = ""
+	}
+	return merged, nil
+}
+
+// mergeWhois fills empty fields of dst from src; registrar servers often know the
+// registrant while the registry is authoritative for dates and status.
+func mergeWhois(dst, src *WhoisInfo) {
+	if dst.Registrar == "" {
+		dst.Registrar = src.Registrar
+	}
+	if dst.Registrant == "" {
+		dst.Registrant = src.Registrant
+	}
+	setTime(&dst.Created, src.Created)
+	setTime(&dst.Updated, src.Updated)
+	setTime(&dst.Expires, src.Expires)
+	if len(dst.Status) == 0 {
+		dst.Status = src.Status
+	}
+	if len(dst.Nameservers) == 0 {
+		dst.Nameservers = src.Nameservers
+	}
+	if dst.DNSSEC == "" {
+		dst.DNSSEC = src.DNSSEC
+	}
+}
+
+// LookupRegistration returns registration data for domain from RDAP, falling back to
+// WHOIS when the TLD has no RDAP service or the RDAP query fails.
+func LookupRegistration(ctx context.Context, domain string, timeout time.Duration, opts WhoisOptions) (*WhoisInfo, error) {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	var rdapErr error
+	if net.ParseIP(domain) == nil && opts.Server == "" {
+		services, err := loadRDAPBootstrap(opts.Bootstrap)
+		if err != nil {
+			return nil, err
+		}
+		client := &http.Client{Timeout: timeout}
+		base := rdapBaseFor(services, domain)
+		if base == "" && opts.Bootstrap == "" {
+			// The embedded copy can lag IANA; a TLD it does not know may have gained RDAP since.
+			if live, err := fetchRDAPBootstrap(ctx, client); err == nil {
+				base = rdapBaseFor(live, domain)
+			}
+		}
+		if base != "" {
+			info, err := lookupRDAP(ctx, client, base, domain)
+			if err == nil {
+				return info, nil
+			}
+			rdapErr = fmt.Errorf("RDAP: %w", err)
+		}
+	}
+	info, err := lookupWhois(ctx, opts.Server, domain)
+	if err != nil {
+		if rdapErr != nil {
+			return nil, errors.Join(rdapErr, err)
+		}
+		return nil, err
+	}
+	if rdapErr != nil {
+		info.Source += fmt.Sprintf("\n(%v)", rdapErr)
+	}
+	return info, nil
+}
+
+// registeredDomain returns the domain registered under a public suffix, e.g. example.co.uk
+// for www.example.co.uk. A name that is itself a public suffix is returned unchanged.
+func registeredDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	if d, err := publicsuffix.EffectiveTLDPlusOne(domain); err == nil {
+		return d
+	}
+	return domain
+}
+
+// holdStatuses are EPP statuses under which a domain does not resolve or is about to be lost.
+var holdStatuses = []string{"clientHold", "serverHold", "pendingDelete", "redemptionPeriod", "inactive"}
+
+func formatWhoisDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format("2006-01-02")
+}
+
+func CheckWhois(domain string, timeout time.Duration, opts WhoisOptions) {
+	fmt.Println("")
+	PrintSectionHeader("WHOIS")
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Registration data lives at the registered domain, not at www.example.com.
+	if net.ParseIP(domain) == nil {
+		domain = registeredDomain(domain)
+	}
+	info, err := LookupRegistration(ctx, domain, timeout, opts)
+	if err != nil {
+		fmt.Printf("WHOIS failed: %v\n", err)
+		return
+	}
+	if info.Raw != "" {
+		fmt.Printf("Could not normalize the response from %s; raw output:\n", strings.ReplaceAll(info.Source, "\n", ", "))
+		fmt.Println(info.Raw)
+		return
+	}
+
+	now := time.Now()
+	expires := formatWhoisDate(info.Expires)
+	if !info.Expires.IsZero() {
+		expires += "\u00a0(" + expiryStatus(daysUntil(info.Expires, now), DOMAIN_WARN_DAYS, DOMAIN_CRIT_DAYS) + ")"
+	}
+	sort.Strings(info.Nameservers)
+	rows := [][]string{
+		{"Domain", info.Domain},
+		{"Source", info.Source},
+		{"Registrar", orDash(info.Registrar)},
+		{"Registrant", orDash(info.Registrant)},
+		{"Created", formatWhoisDate(info.Created)},
+		{"Updated", formatWhoisDate(info.Updated)},
+		{"Expires", expires},
+		{"Status", orDash(strings.Join(info.Status, "\n"))},
+		{"Name Servers", orDash(strings.Join(info.Nameservers, "\n"))},
+		{"DNSSEC", orDash(info.DNSSEC)},
+	}
+	RenderKeyValueTable("Field", "Value", rows)
+
+	if !info.Expires.IsZero() {
+		switch days := daysUntil(info.Expires, now); {
+		case days < 0:
+			fmt.Printf("\033[91mDomain registration expired %d days ago\033[0m\n", -days)
+		case days <= DOMAIN_CRIT_DAYS:
+			fmt.Printf("\033[91mDomain registration expires in %d days\033[0m\n", days)
+		case days <= DOMAIN_WARN_DAYS:
+			fmt.Printf("\033[93mDomain registration expires in %d days\033[0m\n", days)
+		}
+	}
+	for _, s := range info.Status {
+		for _, h := range holdStatuses {
+			if strings.EqualFold(strings.ReplaceAll(s, " ", ""), h) {
+				fmt.Printf("\033[91mDomain status %s: the domain may not resolve or is about to be released\033[0m\n", s)
+			}
+		}
+	}
+}